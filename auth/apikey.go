@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const hashPrefix = "sha256:"
+
+// APIKey is a client's static API key in the API keys file. KeyHash is the hash of the key returned by HashAPIKey, so that the keys
+// themselves are not kept in the config.
+type APIKey struct {
+	ClientID string   `json:"clientId"`
+	KeyHash  string   `json:"keyHash"`
+	Scopes   []string `json:"scopes"`
+}
+
+// APIKeys authenticates the clients by their static API keys.
+type APIKeys struct {
+	principals map[string]*Principal
+}
+
+// HashAPIKey returns the hash of the API key to put in the API keys file. The keys are expected to be long random strings, so a
+// single SHA-256 is enough to keep them from being recovered from the file.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// LoadAPIKeys reads the API keys from the JSON file at the path, which has an array of APIKey.
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []*APIKey
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return nil, fmt.Errorf("invalid api keys file: %v", err)
+	}
+	return NewAPIKeys(keys)
+}
+
+// NewAPIKeys returns the authenticator for the API keys. Each key should have a client ID, a valid hash and known scopes.
+func NewAPIKeys(keys []*APIKey) (*APIKeys, error) {
+	principals := make(map[string]*Principal, len(keys))
+	for i, key := range keys {
+		if key.ClientID == "" {
+			return nil, fmt.Errorf("api key %v has no client id", i)
+		}
+		hash := strings.ToLower(key.KeyHash)
+		if decoded, err := hex.DecodeString(strings.TrimPrefix(hash, hashPrefix)); !strings.HasPrefix(hash, hashPrefix) || err != nil ||
+			len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("api key of client %v has an invalid hash. expected %v followed by 64 hex digits", key.ClientID, hashPrefix)
+		}
+		if _, ok := principals[hash]; ok {
+			return nil, fmt.Errorf("api key of client %v is a duplicate", key.ClientID)
+		}
+		for _, scope := range key.Scopes {
+			if !knownScope(scope) {
+				return nil, fmt.Errorf("api key of client %v has unknown scope %q", key.ClientID, scope)
+			}
+		}
+		principals[hash] = &Principal{ClientID: key.ClientID, Scopes: key.Scopes}
+	}
+	return &APIKeys{principals: principals}, nil
+}
+
+// Authenticate looks the client up by the hash of the API key. The lookup can take longer for some hashes than others, which reveals
+// nothing about the keys themselves.
+func (keys *APIKeys) Authenticate(credentials Credentials) (*Principal, error) {
+	if credentials.APIKey == "" {
+		return nil, ErrNoCredentials
+	}
+	principal, ok := keys.principals[HashAPIKey(credentials.APIKey)]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return principal, nil
+}
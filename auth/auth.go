@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/SDJLee/mercedes-benz/util"
+)
+
+var (
+	// ErrNoCredentials is returned when the request has no credentials for the authenticator.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned when the credentials of the request are unknown, expired or not signed by a trusted key.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Scopes are the scopes a client can be granted. Each scope is independent, so admin doesn't grant the others.
+var Scopes = []string{util.ScopeComputeRoute, util.ScopeBatch, util.ScopeAdmin}
+
+// Credentials are the credentials sent with a request. APIKey is the static API key, Token is the JWT bearer token and CertSubject is
+// the subject of the client certificate verified in the TLS handshake.
+type Credentials struct {
+	APIKey      string
+	Token       string
+	CertSubject string
+}
+
+// Principal is an authenticated client and the scopes it is granted.
+type Principal struct {
+	ClientID string
+	Scopes   []string
+}
+
+// HasScope reports whether the client is granted the scope.
+func (p *Principal) HasScope(scope string) bool {
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator authenticates the client of a request by its credentials. It returns ErrNoCredentials when the request has none of the
+// credentials it checks, so that another authenticator can be tried.
+type Authenticator interface {
+	Authenticate(credentials Credentials) (*Principal, error)
+}
+
+// Chain authenticates with the first authenticator that finds its credentials in the request.
+type Chain []Authenticator
+
+func (chain Chain) Authenticate(credentials Credentials) (*Principal, error) {
+	for _, authenticator := range chain {
+		principal, err := authenticator.Authenticate(credentials)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
+
+func knownScope(scope string) bool {
+	for _, known := range Scopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestAPIKeys(t *testing.T) {
+	invalid := []struct {
+		name string
+		key  *APIKey
+	}{
+		{"no client id", &APIKey{KeyHash: HashAPIKey("key")}},
+		{"invalid hash", &APIKey{ClientID: "fleet", KeyHash: "sha256:abc"}},
+		{"unknown scope", &APIKey{ClientID: "fleet", KeyHash: HashAPIKey("key"), Scopes: []string{"everything"}}},
+	}
+	for _, testCase := range invalid {
+		if _, err := NewAPIKeys([]*APIKey{testCase.key}); err == nil {
+			t.Errorf("%v: expected the api key to be rejected", testCase.name)
+		}
+	}
+	if _, err := NewAPIKeys([]*APIKey{{ClientID: "a", KeyHash: HashAPIKey("key")}, {ClientID: "b", KeyHash: HashAPIKey("key")}}); err == nil {
+		t.Error("expected the duplicate api key to be rejected")
+	}
+
+	keys, err := NewAPIKeys([]*APIKey{{ClientID: "fleet", KeyHash: strings.ToUpper(HashAPIKey("key")), Scopes: []string{util.ScopeBatch}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err := keys.Authenticate(Credentials{APIKey: "key"})
+	if err != nil || principal.ClientID != "fleet" || !principal.HasScope(util.ScopeBatch) || principal.HasScope(util.ScopeAdmin) {
+		t.Errorf("expected the client with the batch scope but got %+v %v", principal, err)
+	}
+	if _, err := keys.Authenticate(Credentials{APIKey: "other"}); err != ErrInvalidCredentials {
+		t.Errorf("expected the unknown key to be invalid but got %v", err)
+	}
+	if _, err := keys.Authenticate(Credentials{}); err != ErrNoCredentials {
+		t.Errorf("expected no credentials but got %v", err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	keys, err := NewAPIKeys([]*APIKey{{ClientID: "fleet", KeyHash: HashAPIKey("key")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := NewClientCerts([]*ClientCert{{Subject: "CN=fleet-app", ClientID: "fleet-app"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := Chain{keys, certs}
+
+	// the first authenticator with credentials in the request decides
+	if principal, err := chain.Authenticate(Credentials{CertSubject: "CN=fleet-app"}); err != nil || principal.ClientID != "fleet-app" {
+		t.Errorf("expected the client of the certificate but got %+v %v", principal, err)
+	}
+	if _, err := chain.Authenticate(Credentials{APIKey: "other", CertSubject: "CN=fleet-app"}); err != ErrInvalidCredentials {
+		t.Errorf("expected the invalid api key to fail the request but got %v", err)
+	}
+	if _, err := chain.Authenticate(Credentials{}); err != ErrNoCredentials {
+		t.Errorf("expected no credentials but got %v", err)
+	}
+}
+
+// writeJWKS writes the JWKS with the key of testSecret to a temporary file and returns its path.
+func writeJWKS(t *testing.T, dir string) string {
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hmac", "alg": "HS256", "k": base64.RawURLEncoding.EncodeToString(testSecret)},
+	}}
+	content, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = "hmac"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWT(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeJWKS(t, dir)
+	if _, err := NewJWT(path, "none", "", ""); err == nil {
+		t.Error("expected the none algorithm to be rejected")
+	}
+	if _, err := NewJWT(path, "RS256", "", ""); err == nil {
+		t.Error("expected the jwks without keys for the algorithm to be rejected")
+	}
+	authenticator, err := NewJWT(path, "HS256", "https://issuer", "route-checker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "fleet", "iss": "https://issuer", "aud": "route-checker", "exp": time.Now().Add(time.Hour).Unix(),
+			"scp": []string{util.ScopeComputeRoute}}
+	}
+	principal, err := authenticator.Authenticate(Credentials{Token: signToken(t, jwt.SigningMethodHS256, testSecret, valid())})
+	if err != nil || principal.ClientID != "fleet" || !principal.HasScope(util.ScopeComputeRoute) {
+		t.Fatalf("expected the client of the token but got %+v %v", principal, err)
+	}
+
+	invalid := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    interface{}
+		change func(claims jwt.MapClaims)
+	}{
+		{"expired", jwt.SigningMethodHS256, testSecret, func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"no expiry", jwt.SigningMethodHS256, testSecret, func(claims jwt.MapClaims) { delete(claims, "exp") }},
+		{"other issuer", jwt.SigningMethodHS256, testSecret, func(claims jwt.MapClaims) { claims["iss"] = "https://other" }},
+		{"other audience", jwt.SigningMethodHS256, testSecret, func(claims jwt.MapClaims) { claims["aud"] = "other" }},
+		{"no client id", jwt.SigningMethodHS256, testSecret, func(claims jwt.MapClaims) { delete(claims, "sub") }},
+		{"other key", jwt.SigningMethodHS256, []byte("another secret of the same length"), func(claims jwt.MapClaims) {}},
+		{"other algorithm", jwt.SigningMethodHS512, testSecret, func(claims jwt.MapClaims) {}},
+	}
+	for _, testCase := range invalid {
+		claims := valid()
+		testCase.change(claims)
+		_, err := authenticator.Authenticate(Credentials{Token: signToken(t, testCase.method, testCase.key, claims)})
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%v: expected the token to be invalid but got %v", testCase.name, err)
+		}
+	}
+}
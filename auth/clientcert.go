@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// ClientCert is a client's certificate in the client certificates file. Subject is the subject of the certificate as it is logged,
+// such as "CN=fleet-app,O=Acme".
+type ClientCert struct {
+	Subject  string   `json:"subject"`
+	ClientID string   `json:"clientId"`
+	Scopes   []string `json:"scopes"`
+}
+
+// ClientCerts authenticates the clients by the subject of the certificate verified in the TLS handshake.
+type ClientCerts struct {
+	principals map[string]*Principal
+}
+
+// LoadClientCerts reads the client certificates from the JSON file at the path, which has an array of ClientCert.
+func LoadClientCerts(path string) (*ClientCerts, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*ClientCert
+	if err := json.Unmarshal(content, &certs); err != nil {
+		return nil, fmt.Errorf("invalid client certificates file: %v", err)
+	}
+	return NewClientCerts(certs)
+}
+
+// NewClientCerts returns the authenticator for the client certificates. Each certificate should have a subject, a client ID and known
+// scopes.
+func NewClientCerts(certs []*ClientCert) (*ClientCerts, error) {
+	principals := make(map[string]*Principal, len(certs))
+	for i, cert := range certs {
+		if cert.Subject == "" || cert.ClientID == "" {
+			return nil, fmt.Errorf("client certificate %v has no subject or client id", i)
+		}
+		if _, ok := principals[cert.Subject]; ok {
+			return nil, fmt.Errorf("client certificate %v is a duplicate", cert.Subject)
+		}
+		for _, scope := range cert.Scopes {
+			if !knownScope(scope) {
+				return nil, fmt.Errorf("client certificate of client %v has unknown scope %q", cert.ClientID, scope)
+			}
+		}
+		principals[cert.Subject] = &Principal{ClientID: cert.ClientID, Scopes: cert.Scopes}
+	}
+	return &ClientCerts{principals: principals}, nil
+}
+
+// Authenticate looks the client up by the subject of its certificate. The certificate is verified by the TLS handshake, so a subject
+// that is not in the file is invalid.
+func (certs *ClientCerts) Authenticate(credentials Credentials) (*Principal, error) {
+	if credentials.CertSubject == "" {
+		return nil, ErrNoCredentials
+	}
+	principal, ok := certs.principals[credentials.CertSubject]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return principal, nil
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// jsonWebKey is a key of a JWKS file. Only the members needed to verify the signatures are read.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// JWT authenticates the clients by the bearer tokens signed by a key of a local JWKS file. Only the tokens signed with the configured
+// algorithm are accepted, so a token can't pick a weaker one. The client ID is the client_id claim, or the sub claim when there is no
+// client_id, and the scopes are the space separated scope claim or the scp array claim.
+type JWT struct {
+	algorithm string
+	keys      map[string]interface{}
+	issuer    string
+	audience  string
+	parser    *jwt.Parser
+}
+
+// NewJWT reads the keys for the algorithm from the JWKS file at the path. The issuer and audience are checked when they are not empty.
+func NewJWT(jwksPath string, algorithm string, issuer string, audience string) (*JWT, error) {
+	if jwt.GetSigningMethod(algorithm) == nil || algorithm == jwt.SigningMethodNone.Alg() {
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", algorithm)
+	}
+	content, err := ioutil.ReadFile(jwksPath)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &jwks); err != nil {
+		return nil, fmt.Errorf("invalid jwks file: %v", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range jwks.Keys {
+		if (jwk.Use != "" && jwk.Use != "sig") || (jwk.Alg != "" && jwk.Alg != algorithm) {
+			continue
+		}
+		key, err := jwk.publicKey(algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk %q: %v", jwk.Kid, err)
+		}
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwks file has no keys for %v", algorithm)
+	}
+	return &JWT{
+		algorithm: algorithm,
+		keys:      keys,
+		issuer:    issuer,
+		audience:  audience,
+		parser:    &jwt.Parser{ValidMethods: []string{algorithm}},
+	}, nil
+}
+
+// publicKey returns the key to verify the signatures of the algorithm, or nil if the key is of another type.
+func (jwk *jsonWebKey) publicKey(algorithm string) (interface{}, error) {
+	switch {
+	case jwk.Kty == "RSA" && (strings.HasPrefix(algorithm, "RS") || strings.HasPrefix(algorithm, "PS")):
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case jwk.Kty == "EC" && strings.HasPrefix(algorithm, "ES"):
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[jwk.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case jwk.Kty == "OKP" && algorithm == jwt.SigningMethodEdDSA.Alg():
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	case jwk.Kty == "oct" && strings.HasPrefix(algorithm, "HS"):
+		return base64.RawURLEncoding.DecodeString(jwk.K)
+	default:
+		return nil, nil
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(decoded) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
+
+// Authenticate verifies the signature, expiry, issuer and audience of the token. Tokens without an expiry are rejected.
+func (j *JWT) Authenticate(credentials Credentials) (*Principal, error) {
+	if credentials.Token == "" {
+		return nil, ErrNoCredentials
+	}
+	claims := jwt.MapClaims{}
+	if _, err := j.parser.ParseWithClaims(credentials.Token, claims, j.key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: token has no expiry", ErrInvalidCredentials)
+	}
+	if j.issuer != "" && !claims.VerifyIssuer(j.issuer, true) {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidCredentials)
+	}
+	if j.audience != "" && !claims.VerifyAudience(j.audience, true) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidCredentials)
+	}
+
+	clientId, _ := claims["client_id"].(string)
+	if clientId == "" {
+		clientId, _ = claims["sub"].(string)
+	}
+	if clientId == "" {
+		return nil, fmt.Errorf("%w: token has no client id", ErrInvalidCredentials)
+	}
+	return &Principal{ClientID: clientId, Scopes: tokenScopes(claims)}, nil
+}
+
+// key returns the key with the kid of the token, or the only key when the token has no kid.
+func (j *JWT) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+func tokenScopes(claims jwt.MapClaims) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	var scopes []string
+	if scp, ok := claims["scp"].([]interface{}); ok {
+		for _, scope := range scp {
+			if name, ok := scope.(string); ok {
+				scopes = append(scopes, name)
+			}
+		}
+	}
+	return scopes
+}
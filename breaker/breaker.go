@@ -0,0 +1,124 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned when the call is rejected because the breaker is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Config configures a Breaker. The breaker opens after FailureThreshold consecutive failures and lets a trial call through after
+// OpenTimeout. OnChange, when set, is called with the breaker locked on every change of state.
+type Config struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	OnChange         func(from State, to State)
+}
+
+// Breaker stops the calls to a failing dependency. It is closed while the calls succeed, and opens after consecutive failures, rejecting
+// the calls right away. Once the open timeout elapses it is half-open and lets a single trial call through, which closes it on success
+// and opens it again on failure.
+type Breaker struct {
+	config   Config
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func New(config Config) *Breaker {
+	if config.FailureThreshold < 1 {
+		config.FailureThreshold = 1
+	}
+	return &Breaker{config: config}
+}
+
+// Allow returns ErrOpen when the call should not be made. Otherwise the call is made and its outcome is passed to Done.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open {
+		if time.Since(b.openedAt) < b.config.OpenTimeout {
+			return ErrOpen
+		}
+		b.setState(HalfOpen)
+	}
+	if b.state == HalfOpen {
+		if b.trial {
+			return ErrOpen
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// Done records the outcome of a call let through by Allow.
+func (b *Breaker) Done(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if success {
+		b.failures = 0
+		if b.state == HalfOpen {
+			b.trial = false
+			b.setState(Closed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || (b.state == Closed && b.failures >= b.config.FailureThreshold) {
+		b.trial = false
+		b.openedAt = time.Now()
+		b.setState(Open)
+	}
+}
+
+// Reset closes the breaker and forgets the failures.
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures, b.trial = 0, false
+	b.setState(Closed)
+}
+
+// State returns the state of the breaker. An open breaker whose timeout elapsed is half-open, even before a call is let through.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && time.Since(b.openedAt) >= b.config.OpenTimeout {
+		b.setState(HalfOpen)
+	}
+	return b.state
+}
+
+func (b *Breaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	if b.config.OnChange != nil {
+		b.config.OnChange(from, state)
+	}
+}
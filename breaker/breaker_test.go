@@ -0,0 +1,74 @@
+package breaker
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBreakerHalfOpen(t *testing.T) {
+	var changes []string
+	b := New(Config{FailureThreshold: 2, OpenTimeout: 20 * time.Millisecond, OnChange: func(from State, to State) {
+		changes = append(changes, from.String()+">"+to.String())
+	}})
+
+	// a success forgets the failures before it, so only consecutive failures open the breaker
+	for _, success := range []bool{false, true, false} {
+		if err := b.Allow(); err != nil {
+			t.Fatal(err)
+		}
+		b.Done(success)
+	}
+	if b.State() != Closed {
+		t.Fatalf("expected the breaker to stay closed but got %v", b.State())
+	}
+	b.Allow()
+	b.Done(false)
+	if err := b.Allow(); err != ErrOpen {
+		t.Fatalf("expected the open breaker to reject the call but got %v", err)
+	}
+
+	// once the timeout elapses, a single trial call is let through and its failure opens the breaker again
+	time.Sleep(30 * time.Millisecond)
+	if b.State() != HalfOpen {
+		t.Fatalf("expected the breaker to be half-open but got %v", b.State())
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expected the trial call to be let through but got %v", err)
+	}
+	if err := b.Allow(); err != ErrOpen {
+		t.Fatalf("expected the calls during the trial to be rejected but got %v", err)
+	}
+	b.Done(false)
+	if err := b.Allow(); err != ErrOpen {
+		t.Fatalf("expected the failed trial to open the breaker but got %v", err)
+	}
+
+	// the success of the next trial closes it
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expected the trial call to be let through but got %v", err)
+	}
+	b.Done(true)
+	if err := b.Allow(); err != nil || b.State() != Closed {
+		t.Fatalf("expected the successful trial to close the breaker but got %v %v", b.State(), err)
+	}
+
+	expected := "closed>open,open>half-open,half-open>open,open>half-open,half-open>closed"
+	if actual := strings.Join(changes, ","); actual != expected {
+		t.Errorf("expected the changes %v but got %v", expected, actual)
+	}
+}
+
+func TestBreakerReset(t *testing.T) {
+	b := New(Config{FailureThreshold: 1, OpenTimeout: time.Hour})
+	b.Allow()
+	b.Done(false)
+	if b.State() != Open {
+		t.Fatalf("expected the breaker to open but got %v", b.State())
+	}
+	b.Reset()
+	if err := b.Allow(); err != nil || b.State() != Closed {
+		t.Errorf("expected the reset breaker to be closed but got %v %v", b.State(), err)
+	}
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/SDJLee/mercedes-benz/auth"
+	"github.com/spf13/cobra"
+)
+
+var hashKeyCmd = &cobra.Command{
+	Use:   "hash-key <api-key>",
+	Short: "prints the hash of an API key to put in the API keys file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(auth.HashAPIKey(args[0]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hashKeyCmd)
+}
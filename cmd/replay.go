@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/SDJLee/mercedes-benz/handler"
+	"github.com/spf13/cobra"
+)
+
+var replayVersion string
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <transaction-id>",
+	Short: "replays a plan from the plan history and prints the differences with the original plan",
+	Long: `replays a plan from the plan history with the upstream responses it was computed with, and prints the original and replayed
+plans with their differences. The plan history is locked by a running server, so replay a copy of the file or use the replay API instead.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		transId, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid transaction id %q", args[0])
+		}
+		// the plan history is opened without the pruner of the server, so that replaying a plan doesn't delete the old ones
+		store, err := handler.OpenPlanHistory()
+		if err != nil {
+			return fmt.Errorf("failed to open plan history. %v", err)
+		}
+		defer store.Close()
+		replay, err := handler.ReplayStoredPlan(store, transId, replayVersion)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(replay)
+	},
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replayVersion, "version", "", "algorithm version to replay the plan with. the original version by default")
+	rootCmd.AddCommand(replayCmd)
+}
@@ -24,8 +24,18 @@ func Execute() {
 	}
 }
 
+// serveCmd serves the service like the root command, so that the service is served with or without the serve argument.
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "serves the merc-benz-route-checker service",
+	Run: func(cmd *cobra.Command, args []string) {
+		serve()
+	},
+}
+
 func init() {
 	loadConfig()
+	rootCmd.AddCommand(serveCmd)
 }
 
 func loadConfig() {
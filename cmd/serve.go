@@ -1,14 +1,24 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/SDJLee/mercedes-benz/handler"
 	log "github.com/SDJLee/mercedes-benz/logger"
+	"github.com/SDJLee/mercedes-benz/metrics"
+	"github.com/SDJLee/mercedes-benz/tlsconfig"
 	"github.com/SDJLee/mercedes-benz/util"
 	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 var logger = log.Logger()
@@ -26,15 +36,183 @@ func serve() {
 	}
 	logger.Infof("attempting to serve in port '%d' \n", port)
 	router := handler.SetupRouter()
+	handler.StartJobWorkers()
+	reloader := serverTLS()
+	grpcServer := serveGRPC(reloader)
 	srv := &http.Server{
 		Handler:      router,
 		Addr:         fmt.Sprintf(":%d", port),
 		WriteTimeout: time.Duration(writeTimeout) * time.Second,
 		ReadTimeout:  time.Duration(readTimeout) * time.Second,
 	}
+	failed := make(chan error, 1)
+	go func() {
+		var err error
+		if reloader != nil {
+			srv.TLSConfig = reloader.Config("h2", "http/1.1")
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			failed <- err
+		}
+	}()
 	logger.Info("Server started and listening on the port: ", port)
-	if err := srv.ListenAndServe(); err != nil {
+	admin := serveAdmin()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case sig := <-signals:
+		logger.Infof("received %v. shutting down", sig)
+		shutdown(srv, grpcServer, admin, true)
+	case err := <-failed:
 		logger.Error("failed to start merc-benz-route-checker", err)
+		// the service never served, so there is no load balancer to wait for
+		shutdown(srv, grpcServer, admin, false)
+		os.Exit(1)
+	}
+}
+
+// flushTimeout is the time the metrics and logs left in the queues have to be shipped on shutdown.
+const flushTimeout = 5 * time.Second
+
+// shutdown drains the service. When delay is set, the health checks fail for SHUTDOWN_DELAY seconds first, so the load balancer stops
+// sending requests before the listeners are closed. The requests in flight and the running jobs then complete within SHUTDOWN_TIMEOUT
+// seconds, after which the metrics and logs left in the queues are shipped within their own deadline, so that a slow drain doesn't
+// drop them. The admin API is served until then.
+func shutdown(srv *http.Server, grpcServer *grpc.Server, admin *http.Server, delay bool) {
+	viper.SetDefault(util.ShutdownDelay, util.DefaultShutDelay)
+	viper.SetDefault(util.ShutdownTimeout, util.DefaultShutTimeout)
+	handler.StartDraining()
+	if delay {
+		time.Sleep(time.Duration(viper.GetInt(util.ShutdownDelay)) * time.Second)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(viper.GetInt(util.ShutdownTimeout))*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("failed to drain http requests", err)
+	}
+	stopGRPC(ctx, grpcServer)
+	if err := handler.Shutdown(ctx); err != nil {
+		logger.Error("failed to drain jobs", err)
+	}
+	if admin != nil {
+		if err := admin.Shutdown(ctx); err != nil {
+			logger.Error("failed to stop admin api", err)
+		}
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancelFlush()
+	if err := metrics.Flush(flushCtx); err != nil {
+		logger.Error("failed to flush metrics", err)
+	}
+	logger.Info("merc-benz-route-checker stopped")
+	if err := log.Flush(flushCtx); err != nil {
+		fmt.Println("failed to flush logs", err)
+	}
+}
+
+// stopGRPC waits for the calls in flight, and cancels them once ctx is done.
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		logger.Error("failed to drain grpc calls", ctx.Err())
+		server.Stop()
+	}
+}
+
+// serveAdmin serves the admin API in the background on ADMIN_BIND_ADDRESS and ADMIN_PORT, the loopback interface and 9091 by default.
+// It returns nil when the admin API is not configured or can't be served, which doesn't stop the service.
+func serveAdmin() *http.Server {
+	router, err := handler.NewAdminRouter()
+	if err != nil {
+		logger.Error("invalid admin config. the admin api is not served", err)
+		return nil
+	}
+	if router == nil {
+		logger.Warnf("%v is not set. the admin api is not served", util.AdminApiKeysPath)
+		return nil
+	}
+	port := viper.GetInt(util.AdminPort)
+	if port == 0 {
+		port = util.DefaultAdminPort
+	}
+	bind := viper.GetString(util.AdminBindAddress)
+	if bind == "" {
+		bind = util.DefaultAdminBind
+	}
+	// no write timeout, as the CPU profile and the trace take as long as asked
+	srv := &http.Server{
+		Handler:     router,
+		Addr:        net.JoinHostPort(bind, strconv.Itoa(port)),
+		ReadTimeout: 15 * time.Second,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("failed to serve admin api", err)
+		}
+	}()
+	logger.Info("admin api listening on: ", srv.Addr)
+	return srv
+}
+
+// serverTLS loads the TLS files configured with the TLS_* settings and reloads them when they change. It returns nil when TLS_CERT_PATH
+// is not set, in which case the APIs are served without TLS.
+func serverTLS() *tlsconfig.Reloader {
+	if viper.GetString(util.TlsCertPath) == "" {
+		return nil
+	}
+	reloader, err := tlsconfig.New(tlsconfig.Options{
+		CertFile:     viper.GetString(util.TlsCertPath),
+		KeyFile:      viper.GetString(util.TlsKeyPath),
+		MinVersion:   viper.GetString(util.TlsMinVersion),
+		CipherPolicy: viper.GetString(util.TlsCipherPolicy),
+		ClientCAFile: viper.GetString(util.TlsClientCaPath),
+		ClientAuth:   viper.GetString(util.TlsClientAuth),
+	})
+	if err != nil {
+		logger.Error("invalid TLS config", err)
+		panic(err)
+	}
+	interval := viper.GetInt(util.TlsReloadSeconds)
+	if interval <= 0 {
+		interval = util.DefaultTlsReload
+	}
+	go reloader.Watch(context.Background(), time.Duration(interval)*time.Second)
+	return reloader
+}
+
+// serveGRPC serves the gRPC API in the background on its own port, with the TLS of the reloader when it is not nil.
+func serveGRPC(reloader *tlsconfig.Reloader) *grpc.Server {
+	port := viper.GetInt(util.GrpcPort)
+	if port == 0 {
+		port = util.DefaultGrpcPort
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		logger.Error("failed to listen for grpc", err)
 		panic(err)
 	}
+	var opts []grpc.ServerOption
+	if reloader != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.Config("h2"))))
+	}
+	server := handler.NewGRPCServer(opts...)
+	logger.Info("gRPC server listening on the port: ", port)
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			logger.Error("failed to serve grpc", err)
+		}
+	}()
+	return server
 }
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"regexp"
+	"runtime"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/auth"
+	"github.com/SDJLee/mercedes-benz/breaker"
+	log "github.com/SDJLee/mercedes-benz/logger"
+	"github.com/SDJLee/mercedes-benz/metrics"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// secretSettings are the settings whose values are redacted from the effective configuration.
+var secretSettings = regexp.MustCompile(`SECRET|PASSWORD|TOKEN|CREDENTIAL|_KEY$`)
+
+// startedAt is the time the service started, reported with the build info.
+var startedAt = time.Now()
+
+// adminCaches invalidate the caches by name. The outcome of the readiness checks is cached too, so that a fixed dependency is seen
+// right away.
+var adminCaches = map[string]func(){
+	"idempotency":      func() { getIdempotencyStore().invalidate() },
+	"vehicle-profiles": invalidateVehicleProfiles,
+	"readiness":        func() { getReadiness().Invalidate() },
+}
+
+// NewAdminRouter returns the router of the admin API, served on its own listener. Every request needs one of the API keys of the
+// ADMIN_API_KEYS_PATH file in the X-API-Key header. It returns nil when the file is not configured, so that the admin API is never
+// served without authentication.
+func NewAdminRouter() (http.Handler, error) {
+	path := viper.GetString(util.AdminApiKeysPath)
+	if path == "" {
+		return nil, nil
+	}
+	keys, err := auth.LoadAPIKeys(path)
+	if err != nil {
+		return nil, err
+	}
+	router := gin.New()
+	router.Use(TransactionMiddleware())
+	router.Use(metrics.MeasureApiComputationTime())
+	router.Use(AdminAuthMiddleware(keys))
+
+	router.Any(util.AdminPprof, HandlePprof)
+	router.GET(util.AdminLogLevel, HandleLogLevel)
+	router.PUT(util.AdminLogLevel, HandleLogLevel)
+	router.DELETE(util.AdminCache, HandleInvalidateCache)
+	router.GET(util.AdminBreakers, HandleBreakers)
+	router.POST(util.AdminBreakerReset, HandleResetBreakers)
+	router.GET(util.AdminConfig, HandleConfig)
+	router.GET(util.AdminBuild, HandleBuildInfo)
+	router.GET(util.AdminWebhooks, HandleWebhookDeliveries)
+	return router, nil
+}
+
+// AdminAuthMiddleware authenticates the operator by the API key in the X-API-Key header. The keys of the admin API are not the keys of
+// the public API, so a leaked client key doesn't open the admin API.
+func AdminAuthMiddleware(keys *auth.APIKeys) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := keys.Authenticate(auth.Credentials{APIKey: c.GetHeader(util.ApiKeyHeader)})
+		if err != nil {
+			metrics.StatCount("counters.admin.unauthorized", 1)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(util.ClientIdKey, principal.ClientID)
+		c.Request = c.Request.WithContext(withClient(c.Request.Context(), principal.ClientID))
+		c.Next()
+	}
+}
+
+// HandlePprof serves the runtime profiles of net/http/pprof under /debug/pprof/.
+func HandlePprof(c *gin.Context) {
+	switch c.Param("name") {
+	case "/cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		// the index serves the named profiles, such as heap and goroutine, as well
+		pprof.Index(c.Writer, c.Request)
+	}
+}
+
+// HandleLogLevel responds with the level of the logs, and changes it with a PUT of {"level":"info"}. The level is not persisted, so a
+// restart sets it back to the default.
+func HandleLogLevel(c *gin.Context) {
+	level := log.Level()
+	previous := level.Level()
+	level.ServeHTTP(c.Writer, c.Request)
+	if current := level.Level(); current != previous {
+		requestLogger(c.Request.Context()).Warnf("log level changed from %v to %v", previous, current)
+	}
+}
+
+// HandleInvalidateCache invalidates the cache named in the path, or every cache for all.
+func HandleInvalidateCache(c *gin.Context) {
+	name := c.Param("name")
+	var invalidated []string
+	for cache, invalidate := range adminCaches {
+		if name == cache || name == "all" {
+			invalidate()
+			invalidated = append(invalidated, cache)
+		}
+	}
+	if len(invalidated) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("unknown cache %q", name)})
+		return
+	}
+	requestLogger(c.Request.Context()).Warnf("invalidated caches %v", invalidated)
+	c.JSON(http.StatusOK, gin.H{"invalidated": invalidated})
+}
+
+// HandleBreakers responds with the state of the circuit breaker of each upstream endpoint. The breakers of a tenant are named
+// <tenant>/<endpoint>.
+func HandleBreakers(c *gin.Context) {
+	c.JSON(http.StatusOK, breakerStates())
+}
+
+// HandleResetBreakers closes the circuit breaker named in the endpoint query parameter, or every breaker without it.
+func HandleResetBreakers(c *gin.Context) {
+	endpoint := c.Query("endpoint")
+	if endpoint == "" {
+		resetBreakers()
+	} else if b, ok := namedBreakers()[endpoint]; ok {
+		b.Reset()
+	} else {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("unknown endpoint %q", endpoint)})
+		return
+	}
+	requestLogger(c.Request.Context()).Warnf("reset circuit breakers %q", endpoint)
+	c.JSON(http.StatusOK, breakerStates())
+}
+
+func breakerStates() map[string]string {
+	named := namedBreakers()
+	states := make(map[string]string, len(named))
+	for name, b := range named {
+		states[name] = b.State().String()
+	}
+	return states
+}
+
+// namedBreakers returns the circuit breakers by the upstream endpoint, and by <tenant>/<endpoint> for the breakers of the tenants.
+func namedBreakers() map[string]*breaker.Breaker {
+	named := make(map[string]*breaker.Breaker)
+	for endpoint := range upstreamPaths {
+		named[endpoint] = getBreaker(endpoint)
+	}
+	tenants, _ := getTenants()
+	for _, t := range tenants.byId {
+		for endpoint, b := range t.breakers {
+			named[t.id+"/"+endpoint] = b
+		}
+	}
+	return named
+}
+
+// HandleConfig responds with the settings that are set, from the config file or the environment. The values of the secret settings
+// are redacted, as are the passwords of URLs.
+func HandleConfig(c *gin.Context) {
+	settings := make(map[string]interface{})
+	for _, key := range util.ConfigKeys {
+		if viper.IsSet(key) {
+			settings[key] = redactSetting(key, viper.Get(key))
+		}
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func redactSetting(key string, value interface{}) interface{} {
+	if secretSettings.MatchString(key) {
+		return util.Redacted
+	}
+	text, ok := value.(string)
+	if !ok {
+		return value
+	}
+	if parsed, err := url.Parse(text); err == nil && parsed.User != nil {
+		if _, hasPassword := parsed.User.Password(); hasPassword {
+			return parsed.Redacted()
+		}
+	}
+	return text
+}
+
+// HandleBuildInfo responds with the version of the service, set at build time, and the runtime it runs on.
+func HandleBuildInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":   util.Version,
+		"commit":    util.Commit,
+		"buildTime": util.BuildTime,
+		"goVersion": runtime.Version(),
+		"platform":  runtime.GOOS + "/" + runtime.GOARCH,
+		"startedAt": startedAt.UTC(),
+		"uptime":    time.Since(startedAt).Round(time.Second).String(),
+	})
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/SDJLee/mercedes-benz/auth"
+	"github.com/SDJLee/mercedes-benz/metrics"
+	"github.com/SDJLee/mercedes-benz/tlsconfig"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+type clientKey struct{}
+
+type clientCertKey struct{}
+
+var (
+	errMissingCredentials = errors.New("missing credentials")
+	errAuthConfig         = errors.New("invalid authentication config")
+	// metricNameChars are the characters of a client ID that can't be in a statsd metric name
+	metricNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+)
+
+var authentication struct {
+	once          sync.Once
+	authenticator auth.Authenticator
+	err           error
+}
+
+// getAuthenticator returns the authenticator for the configured API keys file, JWKS file and client certificates file. It returns nil
+// when none is configured, in which case the API is public. An invalid config is an error, so that the API is not left open by a typo.
+func getAuthenticator() (auth.Authenticator, error) {
+	authentication.once.Do(func() {
+		authentication.authenticator, authentication.err = loadAuthenticator()
+		if authentication.err != nil {
+			logger.Error("failed to load authentication config. authenticated requests will be rejected", authentication.err)
+		}
+	})
+	return authentication.authenticator, authentication.err
+}
+
+func loadAuthenticator() (auth.Authenticator, error) {
+	var chain auth.Chain
+	if path := viper.GetString(util.AuthApiKeysPath); path != "" {
+		keys, err := auth.LoadAPIKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, keys)
+	}
+	if path := viper.GetString(util.AuthJwksPath); path != "" {
+		algorithm := viper.GetString(util.AuthJwtAlgorithm)
+		if algorithm == "" {
+			algorithm = util.DefaultJwtAlg
+		}
+		verifier, err := auth.NewJWT(path, algorithm, viper.GetString(util.AuthJwtIssuer), viper.GetString(util.AuthJwtAudience))
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, verifier)
+	}
+	// the certificate is sent with every request of the client, so the credentials in the headers are tried first
+	if path := viper.GetString(util.AuthClientCerts); path != "" {
+		certs, err := auth.LoadClientCerts(path)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, certs)
+	}
+	if len(chain) == 0 {
+		logger.Warnf("none of %v, %v and %v is set. authentication is disabled", util.AuthApiKeysPath, util.AuthJwksPath,
+			util.AuthClientCerts)
+		return nil, nil
+	}
+	return chain, nil
+}
+
+// authorize authenticates the client by its credentials and checks that it is granted the scope. The failures are counted by code
+// and the authorized requests by client and scope. The principal is nil when authentication is disabled.
+func authorize(ctx context.Context, credentials auth.Credentials, scope string) (*auth.Principal, *travelError) {
+	principal, failure := authenticate(ctx, credentials, scope)
+	if failure != nil {
+		metrics.StatCount(fmt.Sprintf("counters.auth.%v", failure.code), 1)
+	} else if principal != nil {
+		metrics.StatCount(fmt.Sprintf("counters.clients.%v.%v", metricNameChars.ReplaceAllString(principal.ClientID, "_"), scope), 1)
+	}
+	return principal, failure
+}
+
+func authenticate(ctx context.Context, credentials auth.Credentials, scope string) (*auth.Principal, *travelError) {
+	authenticator, err := getAuthenticator()
+	if err != nil {
+		return nil, &travelError{code: util.ErrCodeInternal, err: errAuthConfig}
+	}
+	if authenticator == nil {
+		return nil, nil
+	}
+	principal, err := authenticator.Authenticate(credentials)
+	if err == auth.ErrNoCredentials {
+		return nil, &travelError{code: util.ErrCodeUnauthed, err: errMissingCredentials}
+	}
+	if err != nil {
+		requestLogger(ctx).Warn("authentication failed", err)
+		return nil, &travelError{code: util.ErrCodeUnauthed, err: auth.ErrInvalidCredentials}
+	}
+	if !principal.HasScope(scope) {
+		return nil, &travelError{code: util.ErrCodeForbidden, err: fmt.Errorf("client %v is not granted the %v scope", principal.ClientID, scope)}
+	}
+	return principal, nil
+}
+
+// AuthMiddleware authenticates the client of the request by the X-API-Key header, the bearer token in the Authorization header or the
+// verified client certificate, and checks that it is granted the scope. The client ID is available to the logs of the request with
+// requestLogger. reject responds to the requests that fail authentication. Requests pass through when authentication is disabled.
+func AuthMiddleware(scope string, reject func(c *gin.Context, failure *travelError)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, failure := authorize(c.Request.Context(), requestCredentials(c.Request), scope)
+		if failure != nil {
+			if failure.code == util.ErrCodeUnauthed {
+				c.Header("WWW-Authenticate", "Bearer")
+			}
+			reject(c, failure)
+			c.Abort()
+			return
+		}
+		if principal != nil {
+			c.Set(util.ClientIdKey, principal.ClientID)
+			c.Request = c.Request.WithContext(withClient(c.Request.Context(), principal.ClientID))
+		}
+		c.Next()
+	}
+}
+
+func requestCredentials(r *http.Request) auth.Credentials {
+	return auth.Credentials{APIKey: r.Header.Get(util.ApiKeyHeader), Token: bearerToken(r.Header.Get("Authorization")),
+		CertSubject: tlsconfig.ClientSubject(r.TLS)}
+}
+
+// ClientCertMiddleware makes the subject of the client certificate verified in the TLS handshake available to the logs of the request
+// with requestLogger. Requests without a verified certificate pass through as they are.
+func ClientCertMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if subject := tlsconfig.ClientSubject(c.Request.TLS); subject != "" {
+			c.Set(util.ClientCertKey, subject)
+			c.Request = c.Request.WithContext(withClientCert(c.Request.Context(), subject))
+		}
+		c.Next()
+	}
+}
+
+// bearerToken returns the token of the Authorization header with the Bearer scheme, or an empty string otherwise.
+func bearerToken(authorization string) string {
+	parts := strings.SplitN(authorization, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+// clientId returns the ID of the client authenticated by AuthMiddleware, if any.
+func clientId(c *gin.Context) string {
+	return c.GetString(util.ClientIdKey)
+}
+
+func withClient(ctx context.Context, clientId string) context.Context {
+	return context.WithValue(ctx, clientKey{}, clientId)
+}
+
+func withClientCert(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, clientCertKey{}, subject)
+}
+
+// clientCertFrom returns the subject of the verified client certificate in the context, if any.
+func clientCertFrom(ctx context.Context) (string, bool) {
+	subject, ok := ctx.Value(clientCertKey{}).(string)
+	return subject, ok
+}
+
+// clientIdFrom returns the ID of the authenticated client in the context, if any.
+func clientIdFrom(ctx context.Context) (string, bool) {
+	clientId, ok := ctx.Value(clientKey{}).(string)
+	return clientId, ok
+}
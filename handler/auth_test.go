@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/auth"
+	"github.com/SDJLee/mercedes-benz/routepb"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testApiKey      = "fleet-app-test-key"
+	testBatchApiKey = "batch-app-test-key"
+	testJwtKid      = "test-key"
+)
+
+// useAuth enables authentication with the test API keys and a JWKS file with the public key. It returns a function that disables it.
+func useAuth(t *testing.T, key *rsa.PrivateKey) func() {
+	keys := []*auth.APIKey{
+		{ClientID: "fleet-app", KeyHash: auth.HashAPIKey(testApiKey), Scopes: []string{util.ScopeComputeRoute}},
+		{ClientID: "batch-app", KeyHash: auth.HashAPIKey(testBatchApiKey), Scopes: []string{util.ScopeBatch}},
+	}
+	keysPath := filepath.Join(testDir, "api-keys.json")
+	writeJSON(t, keysPath, keys)
+
+	jwk := map[string]string{
+		"kty": "RSA",
+		"kid": testJwtKid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+	jwksPath := filepath.Join(testDir, "jwks.json")
+	writeJSON(t, jwksPath, map[string]interface{}{"keys": []interface{}{jwk}})
+
+	viper.Set(util.AuthApiKeysPath, keysPath)
+	viper.Set(util.AuthJwksPath, jwksPath)
+	viper.Set(util.AuthJwtAlgorithm, "RS256")
+	resetAuth()
+	return func() {
+		viper.Set(util.AuthApiKeysPath, "")
+		viper.Set(util.AuthJwksPath, "")
+		viper.Set(util.AuthJwtAlgorithm, "")
+		resetAuth()
+	}
+}
+
+func resetAuth() {
+	authentication.once = sync.Once{}
+	authentication.authenticator, authentication.err = nil, nil
+}
+
+func writeJSON(t *testing.T, path string, value interface{}) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = testJwtKid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestAuth(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer useAuth(t, key)()
+
+	expiry := time.Now().Add(time.Hour).Unix()
+	validToken := signToken(t, jwt.SigningMethodRS256, key, jwt.MapClaims{"sub": "mobile-app", "scope": "compute-route batch", "exp": expiry})
+	// a token signed with the public key as the HMAC secret, which should not be accepted when RS256 is configured
+	confusedToken := signToken(t, jwt.SigningMethodHS256, key.N.Bytes(), jwt.MapClaims{"sub": "mobile-app", "scope": "compute-route", "exp": expiry})
+	expiredToken := signToken(t, jwt.SigningMethodRS256, key, jwt.MapClaims{"sub": "mobile-app", "scope": "compute-route", "exp": time.Now().Add(-time.Minute).Unix()})
+	noExpiryToken := signToken(t, jwt.SigningMethodRS256, key, jwt.MapClaims{"sub": "mobile-app", "scope": "compute-route"})
+	adminToken := signToken(t, jwt.SigningMethodRS256, key, jwt.MapClaims{"client_id": "ops", "scp": []string{"admin"}, "exp": expiry})
+
+	testCases := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		status  int
+	}{
+		{"no credentials", "/v1/compute-route", nil, http.StatusUnauthorized},
+		{"api key", "/v1/compute-route", map[string]string{util.ApiKeyHeader: testApiKey}, http.StatusOK},
+		{"unknown api key", "/v1/compute-route", map[string]string{util.ApiKeyHeader: "unknown"}, http.StatusUnauthorized},
+		{"api key without scope", "/v1/compute-route", map[string]string{util.ApiKeyHeader: testBatchApiKey}, http.StatusForbidden},
+		{"api key with batch scope", "/v1/compute-route/batch", map[string]string{util.ApiKeyHeader: testBatchApiKey}, http.StatusOK},
+		{"jwt", "/v1/compute-route", map[string]string{"Authorization": "Bearer " + validToken}, http.StatusOK},
+		{"jwt of another algorithm", "/v1/compute-route", map[string]string{"Authorization": "Bearer " + confusedToken}, http.StatusUnauthorized},
+		{"expired jwt", "/v1/compute-route", map[string]string{"Authorization": "Bearer " + expiredToken}, http.StatusUnauthorized},
+		{"jwt without expiry", "/v1/compute-route", map[string]string{"Authorization": "Bearer " + noExpiryToken}, http.StatusUnauthorized},
+		{"jwt without admin scope", "/v1/plans", map[string]string{"Authorization": "Bearer " + validToken}, http.StatusForbidden},
+		{"jwt with admin scope", "/v1/plans", map[string]string{"Authorization": "Bearer " + adminToken}, http.StatusOK},
+		{"jwt with admin scope only", "/v1/compute-route", map[string]string{"Authorization": "Bearer " + adminToken}, http.StatusForbidden},
+	}
+	for _, testCase := range testCases {
+		method, payload := ReqPost, reqTestCase4
+		if testCase.path == "/v1/plans" {
+			method, payload = "GET", ""
+		} else if testCase.path == "/v1/compute-route/batch" {
+			payload = "[" + reqTestCase4 + "]"
+		}
+		req, err := http.NewRequest(method, util.ApiBasePath+testCase.path, bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range testCase.headers {
+			req.Header.Set(name, value)
+		}
+		rr := executeRequest(req)
+		if rr.Code != testCase.status {
+			t.Errorf("%v: handler returned wrong status code: got %v want %v: %v", testCase.name, rr.Code, testCase.status, rr.Body.String())
+		}
+		if testCase.status == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%v: expected the WWW-Authenticate header", testCase.name)
+		}
+	}
+
+	req, err := http.NewRequest("GET", "/api/health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := executeRequest(req); rr.Code != http.StatusOK {
+		t.Errorf("health should be public but got %v", rr.Code)
+	}
+
+	rr := executeV2Request(t, reqTestCase4)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	assertProblem(t, "v2 unauthorized", rr, util.ErrCodeUnauthed)
+	for _, err := range loadOpenAPISpec(t).validateResponse(ReqPost, "/v2/compute-route", rr) {
+		t.Errorf("v2 unauthorized: %v", err)
+	}
+}
+
+func TestAuthInvalidConfig(t *testing.T) {
+	viper.Set(util.AuthApiKeysPath, filepath.Join(testDir, "missing-api-keys.json"))
+	resetAuth()
+	defer func() {
+		viper.Set(util.AuthApiKeysPath, "")
+		resetAuth()
+	}()
+
+	req, err := http.NewRequest(ReqPost, util.ApiBasePath+util.ApiV1+util.ApiComputeRoute, bytes.NewBufferString(reqTestCase4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(util.ApiKeyHeader, testApiKey)
+	if rr := executeRequest(req); rr.Code != http.StatusInternalServerError {
+		t.Errorf("requests should be rejected with an invalid config but got %v", rr.Code)
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer useAuth(t, key)()
+	conn, closeConn := dialGRPC(t)
+	defer closeConn()
+	client := routepb.NewRouteCheckerClient(conn)
+	req := &routepb.ComputeRouteRequest{Vin: "W1K2062161F0046", Source: "Home", Destination: "Movie Theatre"}
+
+	testCases := []struct {
+		name string
+		md   metadata.MD
+		code codes.Code
+	}{
+		{"no credentials", metadata.MD{}, codes.Unauthenticated},
+		{"api key", metadata.Pairs(util.GrpcApiKeyKey, testApiKey), codes.OK},
+		{"api key without scope", metadata.Pairs(util.GrpcApiKeyKey, testBatchApiKey), codes.PermissionDenied},
+		{"jwt", metadata.Pairs("authorization", "Bearer "+signToken(t, jwt.SigningMethodRS256, key,
+			jwt.MapClaims{"sub": "mobile-app", "scope": "compute-route", "exp": time.Now().Add(time.Hour).Unix()})), codes.OK},
+	}
+	for _, testCase := range testCases {
+		ctx := metadata.NewOutgoingContext(context.Background(), testCase.md)
+		_, err := client.ComputeRoute(ctx, req)
+		if code := status.Code(err); code != testCase.code {
+			t.Errorf("%v: expected code %v but got %v", testCase.name, testCase.code, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/spf13/viper"
+)
+
+// HandleBatchFuelCheck computes the travel for a batch of requests. The requests are computed concurrently, bounded by the configured
+// concurrency, and share the upstream responses between them. An invalid request fails only its own item in the batch.
+func HandleBatchFuelCheck(c *gin.Context) {
+	items, ok := bindBatch(c)
+	if !ok {
+		return
+	}
+	response := computeBatch(c.Request.Context(), tenantFrom(c.Request.Context()).provider, items, nil)
+	for _, result := range response.Results {
+		if result.Response != nil && len(result.Response.Errors) > 0 && result.Response.Errors[0].ID == util.ErrTechExpId {
+			// a batch with a technical failure is computed again when it is retried with its idempotency key
+			markTechnicalFailure(c)
+			break
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// bindBatch binds the requests of the batch in the body. An invalid body or batch size is responded with status 400.
+func bindBatch(c *gin.Context) ([]json.RawMessage, bool) {
+	logger := requestLogger(c.Request.Context())
+	var items []json.RawMessage
+	if err := c.ShouldBindBodyWith(&items, binding.JSON); err != nil {
+		logger.Error("invalid batch request", err)
+		c.String(http.StatusBadRequest, `invalid request`)
+		return nil, false
+	}
+	maxSize := batchMaxSize()
+	if len(items) == 0 || len(items) > maxSize {
+		logger.Errorf("invalid batch size %v", len(items))
+		c.String(http.StatusBadRequest, fmt.Sprintf(`batch should have 1 to %d requests`, maxSize))
+		return nil, false
+	}
+	return items, true
+}
+
+// batchMaxSize returns the maximum number of requests allowed in a batch.
+func batchMaxSize() int {
+	maxSize := viper.GetInt(util.BatchMaxSize)
+	if maxSize <= 0 {
+		maxSize = util.DefaultBatchSize
+	}
+	return maxSize
+}
+
+// computeBatch computes the travel for every request in the batch with at most the configured number of requests in progress at a time.
+// The upstream responses are cached for the batch, so requests sharing a VIN or a route call the upstream API once. The steps and the
+// result of each request are reported to listener as they complete, unless it is nil.
+func computeBatch(ctx context.Context, p provider, items []json.RawMessage, listener batchListener) *model.BatchResponse {
+	stats := tenantFrom(ctx).stats
+	defer stats.StatTime("computebatch")()
+	logger := requestLogger(ctx)
+	concurrency := batchConcurrency()
+	cache := newCachingProvider(p)
+	results := make([]*model.BatchItem, len(items))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		result := &model.BatchItem{Index: i}
+		results[i] = result
+		itemCtx := ctx
+		if listener != nil {
+			index := i
+			itemCtx = withProgress(ctx, func(phase string, data interface{}) { listener(index, phase, data) })
+		}
+		reqBody := &model.Request{}
+		if err := json.Unmarshal(item, reqBody); err != nil {
+			logger.Errorf("invalid request at index %v in batch. %v", i, err)
+			result.Error = "invalid request"
+			reportProgress(itemCtx, util.PhaseResponse, result)
+			continue
+		}
+		if err := binding.Validator.ValidateStruct(reqBody); err != nil {
+			logger.Errorf("invalid request at index %v in batch. %v", i, err)
+			result.Error = "invalid request"
+			result.InvalidParams = invalidParams(err)
+			reportProgress(itemCtx, util.PhaseResponse, result)
+			continue
+		}
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			// the client is gone, so the remaining requests are not computed
+			result.Error = "cancelled"
+			continue
+		}
+		transId := nextTransactionId()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			result.Response, _ = computeTravel(itemCtx, cache, reqBody, transId)
+			reportProgress(itemCtx, util.PhaseResponse, result)
+		}()
+	}
+	wg.Wait()
+
+	response := &model.BatchResponse{
+		Results: results,
+		Summary: summarizeBatch(results),
+	}
+	stats.StatCount("counters.computebatch.items", len(items))
+	return response
+}
+
+// batchConcurrency returns the maximum number of requests of a batch in progress at a time.
+func batchConcurrency() int {
+	if concurrency := viper.GetInt(util.BatchConcurrency); concurrency > 0 {
+		return concurrency
+	}
+	return util.DefaultBatchConc
+}
+
+// summarizeBatch counts the results in a batch by their outcome.
+func summarizeBatch(results []*model.BatchItem) model.BatchSummary {
+	summary := model.BatchSummary{Total: len(results)}
+	for _, result := range results {
+		switch {
+		case result.Response == nil:
+			summary.Failed++
+		case len(result.Response.Errors) == 0:
+			summary.Succeeded++
+			if result.Response.IsChargingRequired.Bool {
+				summary.ChargingRequired++
+			}
+		case result.Response.Errors[0].ID == util.ErrUnreachableId:
+			summary.Unreachable++
+		default:
+			summary.Failed++
+		}
+	}
+	return summary
+}
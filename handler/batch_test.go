@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+)
+
+func TestBatchFuelCheck(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0080"] = 60
+
+	payload := `[
+		{ "vin": "W1K2062161F0046", "source": "Home", "destination": "Movie Theatre" },
+		{ "vin": "W1K2062161F0080", "source": "Home", "destination": "Movie Theatre" },
+		"not a request",
+		{ "vin": "W1K2062161F0099", "source": "Home", "destination": "Movie Theatre" }
+	]`
+	req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiComputeBatch), bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	rr := executeRequest(req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	response := &model.BatchResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Results) != 4 {
+		t.Fatalf("expected 4 results but got %v", len(response.Results))
+	}
+	if !response.Results[0].Response.IsChargingRequired.Bool || len(response.Results[0].Response.ChargingStations) != 2 {
+		t.Error("first request should charge at S1 and S2")
+	}
+	if response.Results[1].Response.IsChargingRequired.Bool {
+		t.Error("second request shouldn't require charging")
+	}
+	if response.Results[2].Error == "" || response.Results[2].Response != nil {
+		t.Error("third request should fail for invalid request")
+	}
+	if errors := response.Results[3].Response.Errors; len(errors) != 1 || errors[0].ID != util.ErrTechExpId {
+		t.Error("fourth request should fail with technical exception for unknown VIN")
+	}
+
+	expected := model.BatchSummary{Total: 4, Succeeded: 2, ChargingRequired: 1, Failed: 2}
+	if response.Summary != expected {
+		t.Errorf("expected summary %+v but got %+v", expected, response.Summary)
+	}
+
+	// the route is shared by the requests in batch
+	if calls := stub.callCount("distance"); calls != 1 {
+		t.Errorf("expected travel distance to be retrieved once but got %v", calls)
+	}
+}
+
+func TestBatchFuelCheckInvalidReq(t *testing.T) {
+	for _, payload := range []string{`{}`, `[]`} {
+		req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiComputeBatch), bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := executeRequest(req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code for %v: got %v want %v", payload, status, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/breaker"
+	"github.com/SDJLee/mercedes-benz/metrics"
+	"github.com/SDJLee/mercedes-benz/util"
+)
+
+// upstreamPaths are the paths of the upstream endpoints under the API address.
+var upstreamPaths = map[string]string{
+	util.EndpointCharge:   "charge_level",
+	util.EndpointDistance: "distance",
+	util.EndpointStations: "charging_stations",
+}
+
+var breakers struct {
+	once       sync.Once
+	byEndpoint map[string]*breaker.Breaker
+}
+
+// getBreaker returns the circuit breaker of the upstream endpoint, configured with BREAKER_FAILURES and BREAKER_OPEN_MS.
+func getBreaker(endpoint string) *breaker.Breaker {
+	breakers.once.Do(func() {
+		breakers.byEndpoint = newUpstreamBreakers("", "")
+	})
+	return breakers.byEndpoint[endpoint]
+}
+
+// newUpstreamBreakers returns a circuit breaker for each upstream endpoint. The changes of state are logged for the tenant, if any, and
+// counted with the metric prefix.
+func newUpstreamBreakers(tenantId string, stats metrics.Prefix) map[string]*breaker.Breaker {
+	byEndpoint := make(map[string]*breaker.Breaker, len(upstreamPaths))
+	for name := range upstreamPaths {
+		name := name
+		description := name
+		if tenantId != "" {
+			description = fmt.Sprintf("%v of tenant %v", name, tenantId)
+		}
+		byEndpoint[name] = breaker.New(breaker.Config{
+			FailureThreshold: configInt(util.BreakerFailures, util.DefaultBrkFailures),
+			OpenTimeout:      time.Duration(configInt(util.BreakerOpenMs, util.DefaultBrkOpenMs)) * time.Millisecond,
+			OnChange: func(from breaker.State, to breaker.State) {
+				logger.Warnf("circuit breaker of %v changed from %v to %v", description, from, to)
+				stats.StatCount(fmt.Sprintf("counters.breaker.%v.%v", name, to), 1)
+			},
+		})
+	}
+	return byEndpoint
+}
+
+// resetBreakers closes the circuit breakers of the upstream endpoints of every tenant.
+func resetBreakers() {
+	for endpoint := range upstreamPaths {
+		getBreaker(endpoint).Reset()
+	}
+	tenants, _ := getTenants()
+	for _, t := range tenants.byId {
+		for _, b := range t.breakers {
+			b.Reset()
+		}
+	}
+}
+
+// postUpstream posts the payload to the upstream endpoint of the tenant through its circuit breaker. The calls fail right away with
+// breaker.ErrOpen while the endpoint keeps failing. The calls cancelled by the caller are not counted as failures of the endpoint.
+func postUpstream(ctx context.Context, t *tenant, endpoint string, url string, payload []byte) ([]byte, error) {
+	b := t.breaker(endpoint)
+	if err := b.Allow(); err != nil {
+		t.stats.StatCount(fmt.Sprintf("counters.breaker.%v.rejected", endpoint), 1)
+		return nil, err
+	}
+	response, err := makePostRequest(ctx, url, payload, t.upstreamHeaders())
+	b.Done(err == nil || errors.Is(err, context.Canceled))
+	return response, err
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/metrics"
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/spf13/viper"
+)
+
+var errInternalCallback = errors.New("callback url resolves to an internal address")
+
+// callbackBackoff is the delay after the first failed callback, doubled after each next failure. Tests shorten it.
+var callbackBackoff = time.Second
+
+// internalNetworks are the loopback, private, link-local, shared and unspecified ranges, which the callbacks are not posted to so that
+// a client can't make the service reach its own network.
+var internalNetworks = parseNetworks("0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+	"192.168.0.0/16", "::/128", "::1/128", "fc00::/7", "fe80::/10")
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func isInternalIP(ip net.IP) bool {
+	if ip.IsMulticast() {
+		return true
+	}
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// callbackHostAllowed reports whether the host of the callback URL is in JOBS_CALLBACK_HOSTS, as host or host:port. The allowed hosts
+// can be internal.
+func callbackHostAllowed(callback *url.URL) bool {
+	for _, host := range strings.Split(viper.GetString(util.JobsCallbackHosts), ",") {
+		host = strings.TrimSpace(host)
+		if host != "" && (strings.EqualFold(host, callback.Host) || strings.EqualFold(host, callback.Hostname())) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCallbackURL checks that the callback URL is an absolute http(s) URL. When JOBS_CALLBACK_HOSTS is set, its host should be one of
+// them. Otherwise, its host should not resolve to an internal address.
+func checkCallbackURL(ctx context.Context, callbackUrl string) error {
+	callback, err := url.Parse(callbackUrl)
+	if err != nil || (callback.Scheme != "http" && callback.Scheme != "https") || callback.Host == "" {
+		return errors.New("invalid callback url")
+	}
+	if viper.GetString(util.JobsCallbackHosts) != "" {
+		if !callbackHostAllowed(callback) {
+			return errors.New("callback host is not allowed")
+		}
+		return nil
+	}
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, callback.Hostname())
+	if err != nil {
+		return errors.New("callback host can't be resolved")
+	}
+	for _, address := range addresses {
+		if isInternalIP(address.IP) {
+			return errInternalCallback
+		}
+	}
+	return nil
+}
+
+// callbackClient returns the client that posts to the callback URL. The redirects are not followed. The client of a host that is not
+// in JOBS_CALLBACK_HOSTS refuses to connect to an internal address, so that the host can't be resolved to another address after it was
+// checked.
+func callbackClient(callback *url.URL) *http.Client {
+	dialer := &net.Dialer{Timeout: callbackTimeout}
+	if !callbackHostAllowed(callback) {
+		dialer.Control = func(network string, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+				return errInternalCallback
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: callbackTimeout},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// postJobCallback posts the job to its callback URL until the callback responds with a 2xx status, up to JOBS_CALLBACK_ATTEMPTS
+// attempts with a backoff. A callback refused for an internal address is not retried. The retries stop when the manager stops. A failed
+// callback is logged and the job can still be retrieved with the job API.
+func (m *jobManager) postJobCallback(job *model.Job) {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		logger.Errorf("failed to serialize job %v for callback. %v", job.ID, err)
+		return
+	}
+	callback, err := url.Parse(job.CallbackURL)
+	if err != nil {
+		logger.Errorf("invalid callback url of job %v. %v", job.ID, err)
+		return
+	}
+	attempts := viper.GetInt(util.JobsCallbackTries)
+	if attempts <= 0 {
+		attempts = util.DefaultCbTries
+	}
+	client := callbackClient(callback)
+	backoff := callbackBackoff
+	for attempt := 1; ; attempt++ {
+		err = postCallback(client, job.CallbackURL, payload)
+		if err == nil {
+			return
+		}
+		logger.Warnf("attempt %v of callback of job %v failed. %v", attempt, job.ID, err)
+		if attempt >= attempts || errors.Is(err, errInternalCallback) || !m.sleep(backoff) {
+			break
+		}
+		backoff *= 2
+	}
+	logger.Errorf("failed to post job %v to callback. %v", job.ID, err)
+	metrics.StatCount("counters.jobs.callbackfailure", 1)
+}
+
+// sleep waits for the duration. It returns false when the manager stops first.
+func (m *jobManager) sleep(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-m.stopping:
+		return false
+	}
+}
+
+func postCallback(client *http.Client, callbackUrl string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), callbackTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, "POST", callbackUrl, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	for key, val := range defaultHeaders {
+		request.Header.Add(key, val)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("callback responded with status %v", response.StatusCode)
+	}
+	return nil
+}
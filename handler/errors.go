@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+)
+
+// travelError describes why the travel couldn't be computed. code is the machine-readable code of the failure and endpoint is the upstream
+// endpoint that failed, if any. retryAfter is the time after which a rate limited request can be retried.
+type travelError struct {
+	code       string
+	endpoint   string
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *travelError) Error() string {
+	if e.endpoint != "" {
+		return fmt.Sprintf("%v from %v: %v", e.code, e.endpoint, e.err)
+	}
+	return fmt.Sprintf("%v: %v", e.code, e.err)
+}
+
+// upstreamFailure returns the failure for an error in calling the upstream endpoint. Timeouts are told apart from other failures.
+func upstreamFailure(endpoint string, err error) *travelError {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &travelError{code: util.ErrCodeTimeout, endpoint: endpoint, err: err}
+	}
+	return &travelError{code: fmt.Sprintf(util.ErrCodeUpstream, endpoint), endpoint: endpoint, err: err}
+}
+
+// problemStatus returns the HTTP status and the title of the problem for a failure code.
+func problemStatus(code string) (int, string) {
+	switch code {
+	case util.ErrCodeInvalidReq:
+		return http.StatusBadRequest, "Invalid request"
+	case util.ErrCodeInvalidVin:
+		return http.StatusUnprocessableEntity, "Invalid VIN"
+	case util.ErrCodeUnknownLoc:
+		return http.StatusUnprocessableEntity, "Unknown location"
+	case util.ErrCodeUnreachable:
+		return http.StatusUnprocessableEntity, util.ErrUnreachableMsg
+	case util.ErrCodeMaxStops:
+		return http.StatusUnprocessableEntity, util.ErrMaxStopsMsg
+	case util.ErrCodeIdempotency:
+		return http.StatusConflict, "Idempotency conflict"
+	case util.ErrCodeTooLarge:
+		return http.StatusRequestEntityTooLarge, "Request body too large"
+	case util.ErrCodeUnauthed:
+		return http.StatusUnauthorized, "Unauthorized"
+	case util.ErrCodeForbidden:
+		return http.StatusForbidden, "Forbidden"
+	case util.ErrCodeRateLimited:
+		return http.StatusTooManyRequests, "Too many requests"
+	case util.ErrCodeOverloaded:
+		return http.StatusServiceUnavailable, "Service overloaded"
+	case util.ErrCodeTimeout:
+		return http.StatusGatewayTimeout, "Upstream timeout"
+	case fmt.Sprintf(util.ErrCodeUpstream, util.EndpointCharge), fmt.Sprintf(util.ErrCodeUpstream, util.EndpointDistance),
+		fmt.Sprintf(util.ErrCodeUpstream, util.EndpointStations):
+		return http.StatusBadGateway, "Upstream failure"
+	default:
+		return http.StatusInternalServerError, util.ErrTechExpMsg
+	}
+}
+
+// rejectRequest responds to the v1 requests rejected by a middleware with the reason as text.
+func rejectRequest(c *gin.Context, failure *travelError) {
+	status, _ := problemStatus(failure.code)
+	c.String(status, problemDetail(failure))
+}
+
+// rejectRequestV2 responds to the v2 requests rejected by a middleware with the problem details.
+func rejectRequestV2(c *gin.Context, failure *travelError) {
+	writeProblem(c, failure, transactionId(c))
+}
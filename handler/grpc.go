@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/auth"
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/routepb"
+	"github.com/SDJLee/mercedes-benz/tlsconfig"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin/binding"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// routeCheckerServer serves the route checker over gRPC with the same service layer as HandleFuelCheck.
+type routeCheckerServer struct {
+	routepb.UnimplementedRouteCheckerServer
+}
+
+// grpcScopes are the scopes required to call the methods. The methods not listed, such as the health service, are public.
+var grpcScopes = map[string]string{
+	"/" + routepb.RouteChecker_ServiceDesc.ServiceName + "/ComputeRoute": util.ScopeComputeRoute,
+}
+
+// grpcRoutes are the routes whose rate limits apply to the methods. The methods not listed are not limited.
+var grpcRoutes = map[string]string{
+	"/" + routepb.RouteChecker_ServiceDesc.ServiceName + "/ComputeRoute": util.RouteComputeRoute,
+}
+
+// NewGRPCServer returns the gRPC server with the route checker, the health service and server reflection. opts are added to the
+// options of the server, such as its TLS credentials.
+func NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(append(opts, grpc.ChainUnaryInterceptor(grpcTransaction, grpcAuth, grpcTenant, grpcRateLimit))...)
+	routepb.RegisterRouteCheckerServer(server, &routeCheckerServer{})
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(routepb.RouteChecker_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	trackGRPCHealth(healthServer)
+	reflection.Register(server)
+	return server
+}
+
+// grpcTransaction assigns a transaction ID to the call like TransactionMiddleware. The ID is sent in the x-transaction-id header.
+func grpcTransaction(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	transId := nextTransactionId()
+	ctx = withTransaction(ctx, transId)
+	if subject := grpcClientCert(ctx); subject != "" {
+		ctx = withClientCert(ctx, subject)
+	}
+	if err := grpc.SetHeader(ctx, metadata.Pairs(util.GrpcTransactionKey, strconv.FormatInt(transId, 10))); err != nil {
+		logger.Error("failed to set transaction header", err)
+	}
+	start := time.Now()
+	res, err := handler(ctx, req)
+	requestLogger(ctx).Infof("%s took %v with status %v", info.FullMethod, time.Since(start), status.Code(err))
+	return res, err
+}
+
+// grpcAuth authenticates the client like AuthMiddleware, by the x-api-key header, the bearer token in the authorization header or the
+// verified client certificate.
+func grpcAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	scope, ok := grpcScopes[info.FullMethod]
+	if !ok {
+		return handler(ctx, req)
+	}
+	var credentials auth.Credentials
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(util.GrpcApiKeyKey); len(values) > 0 {
+		credentials.APIKey = values[0]
+	}
+	if values := md.Get("authorization"); len(values) > 0 {
+		credentials.Token = bearerToken(values[0])
+	}
+	credentials.CertSubject = grpcClientCert(ctx)
+	principal, failure := authorize(ctx, credentials, scope)
+	if failure != nil {
+		transId, _ := transactionIdFrom(ctx)
+		return nil, grpcStatus(failure, nil, transId)
+	}
+	if principal != nil {
+		ctx = withClient(ctx, principal.ClientID)
+	}
+	return handler(ctx, req)
+}
+
+// grpcClientCert returns the subject of the client certificate verified in the TLS handshake of the peer, if any.
+func grpcClientCert(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ""
+	}
+	return tlsconfig.ClientSubject(&info.State)
+}
+
+// grpcRateLimit limits the calls like RateLimitMiddleware, by the authenticated client, the VIN of the request and the IP of the peer.
+func grpcRateLimit(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	route, ok := grpcRoutes[info.FullMethod]
+	if !ok {
+		return handler(ctx, req)
+	}
+	keys := make(map[string]string)
+	keys[util.LimitByClient], _ = clientIdFrom(ctx)
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			keys[util.LimitByIp] = host
+		}
+	}
+	if vinRequest, ok := req.(interface{ GetVin() string }); ok {
+		keys[util.LimitByVin] = vinRequest.GetVin()
+	}
+	if failure := rateLimit(ctx, route, keys); failure != nil {
+		transId, _ := transactionIdFrom(ctx)
+		return nil, grpcStatus(failure, nil, transId)
+	}
+	return handler(ctx, req)
+}
+
+// ComputeRoute computes the travel like HandleFuelCheckV2. The travel is bounded by the deadline of the call, or by the configured
+// request timeout when the call has no deadline.
+func (s *routeCheckerServer) ComputeRoute(ctx context.Context, req *routepb.ComputeRouteRequest) (*routepb.ComputeRouteResponse, error) {
+	defer tenantFrom(ctx).stats.StatTime("grpc.computeroute")()
+	transId, _ := transactionIdFrom(ctx)
+	reqBody := requestFromProto(req)
+	if err := binding.Validator.ValidateStruct(reqBody); err != nil {
+		requestLogger(ctx).Error("invalid request", err)
+		return nil, grpcStatus(&travelError{code: util.ErrCodeInvalidReq, err: err}, nil, transId)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout())
+		defer cancel()
+	}
+	response, failure := computeTravel(ctx, tenantFrom(ctx).provider, reqBody, transId)
+	if failure != nil {
+		return nil, grpcStatus(failure, response, transId)
+	}
+	return responseToProto(response), nil
+}
+
+// grpcStatus returns the gRPC status for the failure. The status has an ErrorInfo with the code of the failure as the reason, and the
+// transaction ID and the error ID of the response, if any, in its metadata. Invalid requests have a BadRequest with the invalid fields and
+// rate limited calls have a RetryInfo with the delay before retrying.
+func grpcStatus(failure *travelError, response *model.Response, transId int64) error {
+	info := &errdetails.ErrorInfo{
+		Reason:   failure.code,
+		Domain:   util.GrpcErrorDomain,
+		Metadata: map[string]string{util.TransactionIdKey: strconv.FormatInt(transId, 10)},
+	}
+	if response != nil && len(response.Errors) > 0 {
+		info.Metadata["errorId"] = strconv.Itoa(response.Errors[0].ID)
+	}
+	st := status.New(grpcCode(failure.code), problemDetail(failure))
+	withDetails, err := st.WithDetails(info)
+	if params := invalidParams(failure.err); params != nil && err == nil {
+		badRequest := &errdetails.BadRequest{}
+		for _, param := range params {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       param.Name,
+				Description: param.Reason,
+			})
+		}
+		withDetails, err = withDetails.WithDetails(badRequest)
+	}
+	if failure.retryAfter > 0 && err == nil {
+		withDetails, err = withDetails.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(failure.retryAfter)})
+	}
+	if err != nil {
+		logger.Error("failed to add error details", err)
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// grpcCode maps the code of a failure to the gRPC status code. The unreachable destination of error 8888 fails the precondition of
+// enough charge, or of the maximum stops, and the technical exceptions of error 9999 map to the status of their cause.
+func grpcCode(code string) codes.Code {
+	switch code {
+	case util.ErrCodeUnreachable, util.ErrCodeMaxStops:
+		return codes.FailedPrecondition
+	case util.ErrCodeInvalidReq, util.ErrCodeInvalidVin, util.ErrCodeUnknownLoc:
+		return codes.InvalidArgument
+	case util.ErrCodeTimeout:
+		return codes.DeadlineExceeded
+	case util.ErrCodeInternal:
+		return codes.Internal
+	case util.ErrCodeUnauthed:
+		return codes.Unauthenticated
+	case util.ErrCodeForbidden:
+		return codes.PermissionDenied
+	case util.ErrCodeRateLimited:
+		return codes.ResourceExhausted
+	default:
+		return codes.Unavailable
+	}
+}
+
+func requestFromProto(req *routepb.ComputeRouteRequest) *model.Request {
+	reqBody := &model.Request{
+		Vin:         req.GetVin(),
+		Source:      req.GetSource(),
+		Destination: req.GetDestination(),
+		Preferences: model.Preferences{
+			AvoidStations:   req.GetPreferences().GetAvoidStations(),
+			AvoidOperators:  req.GetPreferences().GetAvoidOperators(),
+			PreferOperators: req.GetPreferences().GetPreferOperators(),
+			MaxStops:        int(req.GetPreferences().GetMaxStops()),
+		},
+	}
+	switch req.GetStationOrder() {
+	case routepb.StationOrder_STATION_ORDER_NAME:
+		reqBody.StationOrder = util.OrderByName
+	case routepb.StationOrder_STATION_ORDER_DRIVING:
+		reqBody.StationOrder = util.OrderByDriving
+	}
+	return reqBody
+}
+
+func responseToProto(response *model.Response) *routepb.ComputeRouteResponse {
+	res := &routepb.ComputeRouteResponse{
+		TransactionId:      response.TransactionID,
+		Vin:                response.Vin.String,
+		Source:             response.Source.String,
+		Destination:        response.Destination.String,
+		Distance:           response.Distance.Int64,
+		CurrentChargeLevel: response.CurrentChargeLevel.Int64,
+		IsChargingRequired: response.IsChargingRequired.Bool,
+		ChargingStations:   response.ChargingStations,
+		DetourOverhead:     response.DetourOverhead.Int64,
+	}
+	for _, stop := range response.Stops {
+		res.Stops = append(res.Stops, &routepb.Stop{
+			Name:           stop.Name,
+			Distance:       stop.Distance,
+			Detour:         stop.Detour,
+			DetourOverhead: stop.DetourOverhead,
+			Charge:         stop.Charge,
+			MaxPower:       stop.MaxPower,
+		})
+	}
+	for _, station := range response.ExcludedStations {
+		res.ExcludedStations = append(res.ExcludedStations, &routepb.ExcludedStation{Name: station.Name, Reason: station.Reason})
+	}
+	if prefs := response.AppliedPreferences; prefs != nil {
+		res.AppliedPreferences = &routepb.AppliedPreferences{
+			AvoidedStations:    prefs.AvoidedStations,
+			AvoidedOperators:   prefs.AvoidedOperators,
+			PreferredOperators: prefs.PreferredOperators,
+			PreferredStops:     prefs.PreferredStops,
+			MaxStops:           int32(prefs.MaxStops),
+			PreferencesRelaxed: prefs.PreferencesRelaxed,
+		}
+	}
+	return res
+}
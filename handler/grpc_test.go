@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/routepb"
+	"github.com/SDJLee/mercedes-benz/util"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialGRPC serves the gRPC server in memory and returns a connection to it along with a function that closes both.
+func dialGRPC(t *testing.T) (*grpc.ClientConn, func()) {
+	listener := bufconn.Listen(1 << 20)
+	server := NewGRPCServer()
+	go server.Serve(listener)
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+// errorInfo returns the ErrorInfo detail of the status.
+func errorInfo(st *status.Status) *errdetails.ErrorInfo {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+	return nil
+}
+
+func TestGRPCComputeRoute(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0080"] = 5
+	conn, closeConn := dialGRPC(t)
+	defer closeConn()
+	client := routepb.NewRouteCheckerClient(conn)
+
+	var header metadata.MD
+	res, err := client.ComputeRoute(context.Background(), &routepb.ComputeRouteRequest{
+		Vin: "W1K2062161F0046", Source: "Home", Destination: "Movie Theatre", StationOrder: routepb.StationOrder_STATION_ORDER_DRIVING,
+	}, grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsChargingRequired || len(res.Stops) == 0 || len(res.ChargingStations) != len(res.Stops) {
+		t.Fatalf("expected charging stops but got %v", res)
+	}
+	if stop := res.Stops[0]; stop.Name != "S1" || stop.MaxPower != 150 {
+		t.Errorf("expected the first stop S1 to charge at 150 kW but got %v", stop)
+	}
+	if values := header.Get(util.GrpcTransactionKey); len(values) != 1 || values[0] == "0" {
+		t.Errorf("expected the transaction id in the header but got %v", header)
+	}
+
+	testCases := []struct {
+		name    string
+		req     *routepb.ComputeRouteRequest
+		code    codes.Code
+		reason  string
+		errorId string
+	}{
+		{"unreachable", &routepb.ComputeRouteRequest{Vin: "W1K2062161F0080", Source: "Home", Destination: "Movie Theatre"},
+			codes.FailedPrecondition, util.ErrCodeUnreachable, "8888"},
+		{"invalid vin", &routepb.ComputeRouteRequest{Vin: "W1K2062161F0099", Source: "Home", Destination: "Movie Theatre"},
+			codes.InvalidArgument, util.ErrCodeInvalidVin, "9999"},
+		{"invalid request", &routepb.ComputeRouteRequest{Vin: "W1K2062161F0046", Source: "Home", Destination: "home"},
+			codes.InvalidArgument, util.ErrCodeInvalidReq, ""},
+	}
+	for _, testCase := range testCases {
+		_, err := client.ComputeRoute(context.Background(), testCase.req)
+		st := status.Convert(err)
+		info := errorInfo(st)
+		if st.Code() != testCase.code || info == nil || info.Reason != testCase.reason || info.Metadata["errorId"] != testCase.errorId {
+			t.Errorf("%v: expected %v %v with error id %q but got %v %v", testCase.name, testCase.code, testCase.reason, testCase.errorId, st.Code(), info)
+		}
+	}
+}
+
+func TestGRPCDeadline(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0046"] = 17
+	stub.onCall = func(endpoint string) {
+		time.Sleep(500 * time.Millisecond)
+	}
+	conn, closeConn := dialGRPC(t)
+	defer closeConn()
+
+	// the deadline of the call is propagated to the upstream calls
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := routepb.NewRouteCheckerClient(conn).ComputeRoute(ctx, &routepb.ComputeRouteRequest{
+		Vin: "W1K2062161F0046", Source: "Home", Destination: "Movie Theatre",
+	})
+	if code := status.Code(err); code != codes.DeadlineExceeded {
+		t.Errorf("expected %v but got %v", codes.DeadlineExceeded, code)
+	}
+}
+
+func TestGRPCHealth(t *testing.T) {
+	conn, closeConn := dialGRPC(t)
+	defer closeConn()
+
+	res, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{
+		Service: routepb.RouteChecker_ServiceDesc.ServiceName,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expected the route checker to be serving but got %v", res.Status)
+	}
+}
@@ -2,7 +2,6 @@ package handler
 
 import (
 	"net/http"
-	"sync/atomic"
 
 	log "github.com/SDJLee/mercedes-benz/logger"
 	"github.com/SDJLee/mercedes-benz/metrics"
@@ -10,12 +9,18 @@ import (
 	"github.com/SDJLee/mercedes-benz/util"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
+	"github.com/spf13/viper"
 )
 
-var requests int64
 var logger = log.SubLogger("merc-benz-route-checker")
 
 func HandleHealthCheck(c *gin.Context) {
+	if isDraining() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "draining",
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"status": "breathing...",
 	})
@@ -24,21 +29,28 @@ func HandleHealthCheck(c *gin.Context) {
 func HandleFuelCheck(c *gin.Context) {
 	var reqBody model.Request
 	if err := c.ShouldBindBodyWith(&reqBody, binding.JSON); err != nil {
-		logger.Error("invalid request", err)
-		c.String(http.StatusBadRequest, `invalid request`)
+		abortInvalidRequest(c, err)
+		return
+	}
+	response, failure := computeTravel(c.Request.Context(), tenantFrom(c.Request.Context()).provider, &reqBody, transactionId(c))
+	if failure != nil && failure.code == util.ErrCodeOverloaded {
+		rejectRequest(c, failure)
 		return
 	}
-	incrementRequestCount()
-	response := computeTravel(&reqBody, getRequests())
+	if failure != nil {
+		if status, _ := problemStatus(failure.code); status >= http.StatusInternalServerError {
+			markTechnicalFailure(c)
+		}
+	}
 	c.JSON(http.StatusOK, response)
 }
 
-func incrementRequestCount() {
-	atomic.AddInt64(&requests, 1)
-}
-
-func getRequests() int64 {
-	return atomic.LoadInt64(&requests)
+// basePath returns BASE_PATH, the directory of the config files, under which the service keeps its files by default.
+func basePath() string {
+	if path := viper.GetString(util.BasePath); path != "" {
+		return path
+	}
+	return util.DefaultBasePath
 }
 
 func SetupRouter() http.Handler {
@@ -48,13 +60,47 @@ func SetupRouter() http.Handler {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	router := gin.New()
+	// the IP of the client is resolved by requestIP from TRUSTED_PROXIES, as gin trusts the X-Forwarded-For header of any client by default
+	router.ForwardedByClientIP = false
+	router.TrustedProxies = nil
+	setTrustedProxies(viper.GetString(util.TrustedProxies))
 
+	router.Use(TransactionMiddleware())
+	router.Use(ClientCertMiddleware())
 	router.Use(metrics.MeasureApiComputationTime())
 
 	apiRoute := router.Group(util.ApiBasePath)
 	apiRoute.GET(util.ApiHealthCheck, HandleHealthCheck)
+	apiRoute.GET(util.ApiHealthLive, HandleLiveness)
+	apiRoute.GET(util.ApiHealthReady, HandleReadiness)
+	apiRoute.GET(util.ApiOpenAPI, HandleOpenAPI)
+	apiRoute.GET(util.ApiDocs, HandleSwaggerUI)
+	apiRoute.GET(util.ApiDocsAssets, HandleSwaggerAssets)
+
+	computeAuth := AuthMiddleware(util.ScopeComputeRoute, rejectRequest)
+	batchAuth := AuthMiddleware(util.ScopeBatch, rejectRequest)
+	adminAuth := AuthMiddleware(util.ScopeAdmin, rejectRequest)
+
+	computeLimit := RateLimitMiddleware(util.RouteComputeRoute, rejectRequest)
+	batchLimit := RateLimitMiddleware(util.RouteBatch, rejectRequest)
+	jobsLimit := RateLimitMiddleware(util.RouteJobs, rejectRequest)
+	plansLimit := RateLimitMiddleware(util.RoutePlans, rejectRequest)
+
+	tenant := TenantMiddleware(rejectRequest)
 
 	apiRouteV1 := apiRoute.Group(util.ApiV1)
-	apiRouteV1.POST(util.ApiComputeRoute, HandleFuelCheck)
+	apiRouteV1.POST(util.ApiComputeRoute, computeAuth, tenant, computeLimit, IdempotencyMiddleware(rejectIdempotency), HandleFuelCheck)
+	apiRouteV1.POST(util.ApiComputeBatch, batchAuth, tenant, batchLimit, IdempotencyMiddleware(rejectIdempotency), HandleBatchFuelCheck)
+	apiRouteV1.POST(util.ApiComputeStream, computeAuth, tenant, RateLimitMiddleware(util.RouteStream, rejectRequest), HandleFuelCheckStream)
+	apiRouteV1.POST(util.ApiBatchStream, batchAuth, tenant, batchLimit, HandleBatchFuelCheckStream)
+	apiRouteV1.POST(util.ApiJobs, batchAuth, tenant, jobsLimit, HandleSubmitJob)
+	apiRouteV1.GET(util.ApiJob, batchAuth, tenant, jobsLimit, HandleGetJob)
+	apiRouteV1.GET(util.ApiPlans, adminAuth, tenant, plansLimit, HandleListPlans)
+	apiRouteV1.GET(util.ApiPlan, adminAuth, tenant, plansLimit, HandleGetPlan)
+	apiRouteV1.POST(util.ApiPlanReplay, adminAuth, tenant, plansLimit, HandleReplayPlan)
+
+	apiRouteV2 := apiRoute.Group(util.ApiV2)
+	apiRouteV2.POST(util.ApiComputeRoute, AuthMiddleware(util.ScopeComputeRoute, rejectRequestV2), TenantMiddleware(rejectRequestV2),
+		RateLimitMiddleware(util.RouteComputeRoute, rejectRequestV2), IdempotencyMiddleware(rejectIdempotencyV2), HandleFuelCheckV2)
 	return router
 }
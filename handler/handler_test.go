@@ -2,17 +2,24 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/SDJLee/mercedes-benz/model"
 	"github.com/SDJLee/mercedes-benz/util"
 	"github.com/spf13/viper"
+	"gopkg.in/guregu/null.v3"
 )
 
 const (
@@ -126,61 +133,33 @@ func TestCase2(t *testing.T) {
 
 }
 
+// the source has no letters or digits, so the request fails validation before the upstream API is called
 func TestCase3(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
 
-	responseBody, err := performApiCall(reqTestCase3, t)
+	req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiComputeRoute), strings.NewReader(reqTestCase3))
 	if err != nil {
 		t.Fatal(err)
 	}
-	reqBody := &model.Request{}
-	err = json.Unmarshal([]byte(reqTestCase3), reqBody)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if responseBody.Vin.String != reqBody.Vin {
-		t.Errorf("invalid 'vin' in response. It should be '%v' but it is '%v'", reqBody.Vin, responseBody.Vin.String)
-		t.Fail()
-	}
-
-	if responseBody.Source.String != reqBody.Source {
-		t.Errorf("invalid 'source' in response. It should be '%v' but it is '%v'", reqBody.Source, responseBody.Source.String)
-		t.Fail()
-	}
-
-	if responseBody.Destination.String != reqBody.Destination {
-		t.Errorf("invalid 'destination' in response. It should be '%v' but it is '%v'", reqBody.Destination, responseBody.Destination.String)
-		t.Fail()
-	}
-
-	if responseBody.Errors == nil {
-		t.Error("errors should not be nil")
-		t.FailNow()
-	}
-
-	if len(responseBody.Errors) <= 0 {
-		t.Errorf("error with ID %v should have returned", util.ErrTechExpId)
-		t.FailNow()
+	rr := executeRequest(req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
 	}
 
-	if len(responseBody.Errors) > 1 {
-		t.Fatal("there shouldn't be more than one error")
-		t.Fail()
+	responseBody := &model.ResInvalidRequest{}
+	if err := json.Unmarshal(rr.Body.Bytes(), responseBody); err != nil {
+		t.Fatal(err)
 	}
-
-	if responseBody.Errors[0].ID != util.ErrTechExpId {
-		t.Errorf("expected error with ID %v but got %v", util.ErrTechExpId, responseBody.Errors[0].ID)
-		t.Fail()
+	if len(responseBody.InvalidParams) != 1 || responseBody.InvalidParams[0].Name != "source" {
+		t.Fatalf("expected 'source' to be the only invalid param but got %v", rr.Body.String())
 	}
-
-	if responseBody.Errors[0].Description != util.ErrTechExpMsg {
-		t.Error("invalid error description")
-		t.Fail()
+	if stub.callCount("charge_level") != 0 {
+		t.Error("the upstream API shouldn't be called for an invalid request")
 	}
-
 }
 
-//{ "transactionId": 5, "vin": "W1K2062161F0046", "source": "Home", "destination": "Movie Theatre", "distance": 50, "currentChargeLevel": 17, "isChargingRequired": true, "chargingStations": [ { "name": "S1", "distance": 10, "limit": 20 }, { "name": "S2", "distance": 25, "limit": 15 } ] }
+//{ "transactionId": "5", "vin": "W1K2062161F0046", "source": "Home", "destination": "Movie Theatre", "distance": 50, "currentChargeLevel": 17, "isChargingRequired": true, "chargingStations": [ { "name": "S1", "distance": 10, "limit": 20 }, { "name": "S2", "distance": 25, "limit": 15 } ] }
 func TestCase4(t *testing.T) {
 
 	responseBody, err := performApiCall(reqTestCase4, t)
@@ -262,7 +241,7 @@ func TestCase5(t *testing.T) {
 		Distance: 40,
 	}
 
-	stationsVisited, err := computeRoute(everyStation, 17, 50, "W1K2062161F0046")
+	stationsVisited, err := computeRoute(context.Background(), everyStation, 17, 50, "W1K2062161F0046", &model.Preferences{}, util.DefaultPrefWeight)
 
 	if err != nil {
 		t.Error("test case shouldn't return error")
@@ -284,7 +263,7 @@ func TestCase5(t *testing.T) {
 		t.Fail()
 	}
 
-	if stationsVisited[0] != "S1" || stationsVisited[1] != "S2" {
+	if stationsVisited[0].Name != "S1" || stationsVisited[1].Name != "S2" {
 		t.Error("this testcase should return S1 and S2 for charging stations")
 		t.Fail()
 	}
@@ -313,7 +292,7 @@ func TestCase6(t *testing.T) {
 		Distance: 40,
 	}
 
-	stationsVisited, err := computeRoute(everyStation, 17, 90, "W1K2062161F0046")
+	stationsVisited, err := computeRoute(context.Background(), everyStation, 17, 90, "W1K2062161F0046", &model.Preferences{}, util.DefaultPrefWeight)
 
 	if err != nil {
 		t.Error("test case shouldn't return error")
@@ -335,12 +314,264 @@ func TestCase6(t *testing.T) {
 		t.Fail()
 	}
 
-	if stationsVisited[0] != "S1" || stationsVisited[1] != "S3" {
+	if stationsVisited[0].Name != "S1" || stationsVisited[1].Name != "S3" {
 		t.Error("this testcase should return S1 and S3 for charging stations")
 		t.Fail()
 	}
 }
 
+func TestCaseDetour(t *testing.T) {
+	everyStation := make([]*model.Station, 3)
+	everyStation[0] = &model.Station{
+		Name:     "S1",
+		Limit:    30,
+		Distance: 10,
+		Detour:   10,
+	}
+	everyStation[1] = &model.Station{
+		Name:     "S2",
+		Limit:    15,
+		Distance: 15,
+	}
+	everyStation[2] = &model.Station{
+		Name:     "S3",
+		Limit:    20,
+		Distance: 20,
+		Detour:   3,
+	}
+
+	// S1 provides the maximum charge but only 10 after its detour of 10 miles in and out. S2 and S3 provide more.
+	stationsVisited, err := computeRoute(context.Background(), everyStation, 20, 45, "W1K2062161F0046", &model.Preferences{}, util.DefaultPrefWeight)
+
+	if err != nil {
+		t.Error("test case shouldn't return error")
+		t.FailNow()
+	}
+
+	if len(stationsVisited) != 2 {
+		t.Fatal("this testcase should return 2 charging stations")
+	}
+
+	if stationsVisited[0].Name != "S2" || stationsVisited[1].Name != "S3" {
+		t.Error("this testcase should return S2 and S3 for charging stations")
+	}
+
+	stops, detourOverhead := buildStops(stationsVisited, nil)
+	if stops[1].DetourOverhead != 6 {
+		t.Errorf("expected detour overhead of 6 for S3 but got %v", stops[1].DetourOverhead)
+	}
+	if detourOverhead != 6 {
+		t.Errorf("expected total detour overhead of 6 but got %v", detourOverhead)
+	}
+
+	// the detour of S1 can't be covered with the charge left on reaching it
+	everyStation[0].Detour = 12
+	everyStation[0].Limit = 100
+	stationsVisited, err = computeRoute(context.Background(), everyStation[:1], 11, 40, "W1K2062161F0046", &model.Preferences{}, util.DefaultPrefWeight)
+	if err == nil {
+		t.Errorf("station with unreachable detour shouldn't be visited. visited %v", stationsVisited)
+	}
+
+	// S1 can't be reached with the charge left at first, but it can once the car has charged at S2
+	everyStation = []*model.Station{
+		{Name: "S1", Limit: 100, Distance: 10, Detour: 15},
+		{Name: "S2", Limit: 30, Distance: 5},
+	}
+	stationsVisited, err = computeRoute(context.Background(), everyStation, 20, 110, "W1K2062161F0046", &model.Preferences{}, util.DefaultPrefWeight)
+	if err != nil {
+		t.Fatalf("station skipped for its detour should be visited after charging at another station. %v", err)
+	}
+	if len(stationsVisited) != 2 || stationsVisited[0].Name != "S2" || stationsVisited[1].Name != "S1" {
+		t.Errorf("this testcase should return S2 and S1 for charging stations but got %v", stationsVisited)
+	}
+}
+
+func TestCaseStationFilter(t *testing.T) {
+	everyStation := []*model.Station{
+		{Name: "S1", Limit: 20, Distance: 10, Available: null.BoolFrom(false)},
+		{Name: "S2", Limit: 20, Distance: 25, Connectors: []string{"CHAdeMO"}},
+		{Name: "S3", Limit: 20, Distance: 50, OpeningHours: "06:00-10:00"},
+		{Name: "S4", Limit: 20, Distance: 50, OpeningHours: "22:00-11:00", Connectors: []string{"ccs"}},
+		{Name: "S5", Limit: 20, Distance: 60, Available: null.BoolFrom(true)},
+	}
+
+	dir, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	profilesFile := filepath.Join(dir, "profiles.json")
+	err = ioutil.WriteFile(profilesFile, []byte(`[{"name":"eqs","vinPrefix":"W1K","connectors":["CCS","Type2"]}]`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	viper.Set(util.VehicleProfiles, profilesFile)
+	defer viper.Set(util.VehicleProfiles, "")
+
+	profile := getVehicleProfile("W1K2062161F0046")
+	if profile == nil || profile.Name != "eqs" {
+		t.Fatal("vehicle profile should be matched by VIN prefix")
+	}
+
+	// at an average speed of 50 miles per hour, S3 and S4 are reached at 10:00
+	viper.Set(util.AverageSpeed, 50)
+	defer viper.Set(util.AverageSpeed, 0)
+	departure := time.Date(2021, 10, 10, 9, 0, 0, 0, time.UTC)
+	eligible, excluded := filterStations(context.Background(), everyStation, &model.Preferences{}, profile, departure, "W1K2062161F0046")
+
+	if len(eligible) != 2 || eligible[0].Name != "S4" || eligible[1].Name != "S5" {
+		t.Errorf("this testcase should return S4 and S5 as eligible stations but got %v", eligible)
+	}
+
+	expected := map[string]string{
+		"S1": util.ExclUnavailable,
+		"S2": util.ExclIncompatible,
+		"S3": util.ExclClosed,
+	}
+	if len(excluded) != len(expected) {
+		t.Fatalf("expected %v excluded stations but got %v", len(expected), len(excluded))
+	}
+	for _, station := range excluded {
+		if expected[station.Name] != station.Reason {
+			t.Errorf("station %v excluded for %q, expected %q", station.Name, station.Reason, expected[station.Name])
+		}
+	}
+}
+
+func TestCaseChargingTime(t *testing.T) {
+	s1 := &model.Station{Name: "S1", Limit: 200, Distance: 10, MaxPower: 50}
+	s2 := &model.Station{Name: "S2", Limit: 50, Distance: 30, OpeningHours: "09:00-09:45"}
+	stops := []*model.Station{s2, s1}
+
+	// at an average speed of 60 miles per hour, S2 is reached at 09:30 when the car drives straight to it
+	viper.Set(util.AverageSpeed, 60)
+	defer viper.Set(util.AverageSpeed, 0)
+	departure := time.Date(2021, 10, 10, 9, 0, 0, 0, time.UTC)
+
+	// 15 miles at 50 kW and 3 miles per kWh take 6 minutes, so S2 is reached at 09:36
+	if closed := closedStop(context.Background(), stops, map[*model.Station]int64{s1: 15, s2: 10}, departure, "W1K2062161F0046"); closed != nil {
+		t.Errorf("expected every stop to be open but %v is closed", closed.Name)
+	}
+	// 150 miles take an hour, so S2 is closed when it is reached at 10:30
+	if closed := closedStop(context.Background(), stops, map[*model.Station]int64{s1: 150, s2: 10}, departure, "W1K2062161F0046"); closed != s2 {
+		t.Errorf("expected S2 to be closed after charging at S1 but got %v", closed)
+	}
+	// a station that doesn't report its power charges at the configured power
+	if charging := chargingTime(s2, 150); charging != time.Hour {
+		t.Errorf("expected an hour of charging at the default power but got %v", charging)
+	}
+}
+
+func TestCasePreferences(t *testing.T) {
+	everyStation := []*model.Station{
+		{Name: "S1", Limit: 30, Distance: 10, Operator: "Ionity"},
+		{Name: "S2", Limit: 25, Distance: 15, Operator: "Tesla"},
+		{Name: "S3", Limit: 50, Distance: 18, Operator: "Shell"},
+	}
+	prefs := &model.Preferences{
+		AvoidOperators:  []string{"shell"},
+		PreferOperators: []string{"tesla"},
+	}
+
+	eligible, excluded := filterStations(context.Background(), everyStation, prefs, nil, time.Now(), "W1K2062161F0046")
+	if len(eligible) != 2 || len(excluded) != 1 || excluded[0].Name != "S3" || excluded[0].Reason != util.ExclAvoided {
+		t.Fatalf("S3 should be excluded since its operator is avoided. excluded %v", excluded)
+	}
+
+	// S1 provides more charge but S2 is preferred
+	stationsVisited, err := computeRoute(context.Background(), eligible, 20, 45, "W1K2062161F0046", prefs, util.DefaultPrefWeight)
+	if err != nil {
+		t.Fatal("test case shouldn't return error")
+	}
+	if len(stationsVisited) != 1 || stationsVisited[0].Name != "S2" {
+		t.Errorf("this testcase should return S2 for charging stations but got %v", stationsVisited)
+	}
+
+	applied := appliedPreferences(prefs, prefs, excluded, stationsVisited)
+	if len(applied.AvoidedStations) != 1 || len(applied.PreferredStops) != 1 || applied.PreferencesRelaxed {
+		t.Errorf("unexpected applied preferences %+v", applied)
+	}
+
+	// the destination needs both stations which exceeds the maximum stops
+	prefs.MaxStops = 1
+	_, err = computeRoute(context.Background(), eligible, 20, 60, "W1K2062161F0046", prefs, util.DefaultPrefWeight)
+	if err != errTooManyStops {
+		t.Errorf("expected error %v but got %v", errTooManyStops, err)
+	}
+}
+
+func TestCasePartialCharge(t *testing.T) {
+	everyStation := []*model.Station{
+		{Name: "S1", Limit: 30, Distance: 10},
+		{Name: "S2", Limit: 40, Distance: 40, Detour: 2},
+	}
+
+	// the car arrives S1 with 7 and needs 32 to reach S2 with its detour. From S2, it needs 32 to reach the destination and 5 more for the reserve.
+	stationsVisited, err := computeRoute(context.Background(), everyStation, 17, 75, "W1K2062161F0046", &model.Preferences{}, util.DefaultPrefWeight)
+	if err != nil {
+		t.Fatal("test case shouldn't return error")
+	}
+	charges := computeCharges(context.Background(), stationsVisited, 17, 70, 5, "W1K2062161F0046")
+	stops, _ := buildStops(stationsVisited, charges)
+
+	expected := map[string]int64{
+		"S1": 25,
+		"S2": 37,
+	}
+	if len(stops) != len(expected) {
+		t.Fatalf("expected %v stops but got %v", len(expected), len(stops))
+	}
+	for _, stop := range stops {
+		if stop.Charge != expected[stop.Name] {
+			t.Errorf("expected charge %v at stop %v but got %v", expected[stop.Name], stop.Name, stop.Charge)
+		}
+	}
+}
+
+// TestCaseStableOrder checks that the route and the order of the stations in it don't change when the stations in input are permuted.
+func TestCaseStableOrder(t *testing.T) {
+	everyStation := []*model.Station{
+		{Name: "S1", Limit: 20, Distance: 10},
+		{Name: "S2", Limit: 20, Distance: 10},
+		{Name: "S0", Limit: 20, Distance: 12},
+		{Name: "S3", Limit: 15, Distance: 25},
+		{Name: "S4", Limit: 15, Distance: 25},
+		{Name: "S5", Limit: 30, Distance: 30, Detour: 5},
+		{Name: "S6", Limit: 20, Distance: 33},
+	}
+
+	plan := func(stations []*model.Station, order string) []string {
+		stationsVisited, err := computeRoute(context.Background(), stations, 17, 90, "W1K2062161F0046", &model.Preferences{}, util.DefaultPrefWeight)
+		if err != nil {
+			t.Fatal("test case shouldn't return error")
+		}
+		orderStations(stationsVisited, order)
+		names := make([]string, 0, len(stationsVisited))
+		for _, station := range stationsVisited {
+			names = append(names, station.Name)
+		}
+		return names
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for _, order := range []string{util.OrderByName, util.OrderByDriving} {
+		expected := plan(everyStation, order)
+		for i := 0; i < 100; i++ {
+			permuted := make([]*model.Station, len(everyStation))
+			for j, k := range random.Perm(len(everyStation)) {
+				permuted[j] = everyStation[k]
+			}
+			if actual := plan(permuted, order); !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("%v order isn't stable. expected %v but got %v for input %v", order, expected, actual, permuted)
+			}
+		}
+	}
+
+	if names := plan(everyStation, util.OrderByDriving); names[0] != "S1" {
+		t.Errorf("S1 should be picked over S2 of equal charge and distance. got %v", names)
+	}
+}
+
 func TestCaseInvalidReq(t *testing.T) {
 	req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiComputeRoute), strings.NewReader(""))
 	if err != nil {
@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/history"
+	"github.com/SDJLee/mercedes-benz/metrics"
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+const (
+	// pruneInterval is the interval between the deletions of the plans older than the retention.
+	pruneInterval = time.Hour
+	// planQueueSize is the number of plans waiting to be written to the plan history, over which the plans are not kept.
+	planQueueSize = 1000
+	// planBatchSize is the most plans written to the plan history in one transaction.
+	planBatchSize = 100
+)
+
+var plans struct {
+	once    sync.Once
+	store   *history.Store
+	queue   chan *model.PlanRecord
+	stopped chan struct{}
+	// pruning is closed to stop the pruner, which closes pruned once it stops
+	pruning chan struct{}
+	pruned  chan struct{}
+	// mu guards the fields below, which let the readers wait for the plans queued before them to be written
+	mu      sync.Mutex
+	closed  bool
+	queued  int64
+	written int64
+	flushed chan struct{}
+}
+
+// getPlanHistory opens the plan history, starts the writer of the plans and starts deleting the plans older than the retention. It
+// returns nil if the plan history can't be opened, in which case the plans are not kept.
+func getPlanHistory() *history.Store {
+	plans.once.Do(func() {
+		store, err := OpenPlanHistory()
+		if err != nil {
+			logger.Error("failed to open plan history. plans will not be kept", err)
+			return
+		}
+		plans.store = store
+		plans.queue = make(chan *model.PlanRecord, planQueueSize)
+		plans.stopped = make(chan struct{})
+		plans.flushed = make(chan struct{})
+		plans.pruning = make(chan struct{})
+		plans.pruned = make(chan struct{})
+		go writePlans(store)
+		go prunePlans(store, plans.pruning, plans.pruned)
+	})
+	return plans.store
+}
+
+// OpenPlanHistory opens the plan history at HISTORY_PATH, or in a file under BASE_PATH when it is not set, without deleting the plans
+// older than the retention, for the commands that only read it. The store should be closed once done.
+func OpenPlanHistory() (*history.Store, error) {
+	// the plans must survive a restart, so they are never kept in the temporary directory
+	path := viper.GetString(util.HistoryPath)
+	if path == "" {
+		path = filepath.Join(basePath(), util.DefaultHistoryFile)
+	}
+	return history.Open(path)
+}
+
+// prunePlans deletes the plans older than HISTORY_RETENTION_DAYS every pruneInterval until stop is closed, and then closes stopped.
+func prunePlans(store *history.Store, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	days := viper.GetInt(util.HistoryRetention)
+	if days <= 0 {
+		days = util.DefaultRetention
+	}
+	for {
+		pruned, err := store.Prune(time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			logger.Error("failed to prune plan history", err)
+		} else if pruned > 0 {
+			logger.Infof("pruned %v plans older than %v days", pruned, days)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(pruneInterval):
+		}
+	}
+}
+
+// savePlan queues the plan to be kept in the plan history, so that the request doesn't wait for the disk. A plan that can't be kept is
+// logged and doesn't fail the request.
+func savePlan(record *model.PlanRecord) {
+	if getPlanHistory() == nil {
+		return
+	}
+	plans.mu.Lock()
+	defer plans.mu.Unlock()
+	if plans.closed {
+		logger.Errorf("failed to save plan of transaction %v. plan history is closed", record.TransactionID)
+		metrics.StatCount("counters.history.failure", 1)
+		return
+	}
+	select {
+	case plans.queue <- record:
+		plans.queued++
+	default:
+		logger.Errorf("failed to save plan of transaction %v. too many plans are waiting to be saved", record.TransactionID)
+		metrics.StatCount("counters.history.dropped", 1)
+	}
+}
+
+// writePlans is the only writer of the plan history. It writes the queued plans in batches, so that a burst of plans takes a few
+// transactions instead of one each.
+func writePlans(store *history.Store) {
+	defer close(plans.stopped)
+	for record := range plans.queue {
+		batch := []*model.PlanRecord{record}
+	collect:
+		for len(batch) < planBatchSize {
+			select {
+			case record, ok := <-plans.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, record)
+			default:
+				break collect
+			}
+		}
+		if err := store.Save(batch...); err != nil {
+			// a batch fails as a whole, so the plans are saved one by one to keep the ones that can be kept
+			for _, record := range batch {
+				if err := store.Save(record); err != nil {
+					logger.Errorf("failed to save plan of transaction %v. %v", record.TransactionID, err)
+					metrics.StatCount("counters.history.failure", 1)
+				}
+			}
+		}
+		plans.mu.Lock()
+		plans.written += int64(len(batch))
+		close(plans.flushed)
+		plans.flushed = make(chan struct{})
+		plans.mu.Unlock()
+	}
+}
+
+// flushPlans waits until the plans queued so far are written, so that the plan of a request can be read right after it.
+func flushPlans() {
+	plans.mu.Lock()
+	queued := plans.queued
+	for plans.written < queued && !plans.closed {
+		flushed := plans.flushed
+		plans.mu.Unlock()
+		<-flushed
+		plans.mu.Lock()
+	}
+	plans.mu.Unlock()
+}
+
+// closePlanHistory writes the queued plans until ctx is done, stops the pruner and closes the plan history.
+func closePlanHistory(ctx context.Context) {
+	plans.mu.Lock()
+	if plans.store == nil || plans.closed {
+		plans.mu.Unlock()
+		return
+	}
+	plans.closed = true
+	close(plans.queue)
+	close(plans.pruning)
+	plans.mu.Unlock()
+	select {
+	case <-plans.stopped:
+	case <-ctx.Done():
+		logger.Error("failed to save the queued plans", ctx.Err())
+	}
+	select {
+	case <-plans.pruned:
+	case <-ctx.Done():
+		logger.Error("failed to stop pruning the plan history", ctx.Err())
+	}
+	if err := plans.store.Close(); err != nil {
+		logger.Error("failed to close plan history", err)
+	}
+}
+
+// HandleListPlans responds with a page of the plans in the plan history, newest first. The plans are filtered by the optional query
+// parameters vin, and from and to as RFC 3339 times. limit is the size of the page and cursor fetches the next page.
+func HandleListPlans(c *gin.Context) {
+	store := getPlanHistory()
+	if store == nil {
+		c.String(http.StatusServiceUnavailable, `plan history is unavailable`)
+		return
+	}
+	flushPlans()
+	query := history.Query{Tenant: tenantFrom(c.Request.Context()).id, Vin: c.Query("vin"), Cursor: c.Query("cursor")}
+	var err error
+	if from := c.Query("from"); from != "" {
+		if query.From, err = time.Parse(time.RFC3339, from); err != nil {
+			c.String(http.StatusBadRequest, `from should be an RFC 3339 time`)
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if query.To, err = time.Parse(time.RFC3339, to); err != nil {
+			c.String(http.StatusBadRequest, `to should be an RFC 3339 time`)
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 || query.Limit > util.MaxHistoryLimit {
+			c.String(http.StatusBadRequest, `limit should be 1 to 500`)
+			return
+		}
+	}
+	page, err := store.List(query)
+	if err == history.ErrInvalidCursor {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		logger.Error("failed to list plans", err)
+		c.String(http.StatusInternalServerError, util.ErrTechExpMsg)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// HandleGetPlan responds with the plan of the transaction from the plan history.
+func HandleGetPlan(c *gin.Context) {
+	store := getPlanHistory()
+	if store == nil {
+		c.String(http.StatusServiceUnavailable, `plan history is unavailable`)
+		return
+	}
+	flushPlans()
+	transId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusNotFound, `plan not found`)
+		return
+	}
+	record, err := store.Get(transId)
+	if err != nil {
+		logger.Errorf("failed to get plan of transaction %v. %v", transId, err)
+		c.String(http.StatusInternalServerError, util.ErrTechExpMsg)
+		return
+	}
+	// the plans of the other tenants are not found
+	if record == nil || record.Tenant != tenantFrom(c.Request.Context()).id {
+		c.String(http.StatusNotFound, `plan not found`)
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/history"
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+)
+
+func executeGet(t *testing.T, url string) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executeRequest(req).Result()
+}
+
+func TestPlanHistory(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+
+	req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiComputeRoute), strings.NewReader(reqTestCase4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := executeRequest(req)
+	transId := rr.Header().Get(util.TransactionHeader)
+
+	res := executeGet(t, computeBaseUrl(util.ApiPlans+"/"+transId))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("plan of transaction %v should be found but got %v", transId, res.StatusCode)
+	}
+	record := &model.PlanRecord{}
+	if err := json.NewDecoder(res.Body).Decode(record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Request.Vin != "W1K2062161F0046" || record.ChargeLevel.CurrentChargeLevel != 17 || record.Distance.Distance != 50 ||
+		len(record.Stations.ChargingStations) != 2 || len(record.Response.ChargingStations) == 0 {
+		t.Errorf("plan should have the request, the upstream responses and the response. got %+v", record)
+	}
+
+	res = executeGet(t, computeBaseUrl(util.ApiPlans+"?vin=W1K2062161F0046&limit=1"))
+	page := &model.PlanPage{}
+	if err := json.NewDecoder(res.Body).Decode(page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Plans) != 1 || fmt.Sprint(page.Plans[0].TransactionID) != transId {
+		t.Errorf("latest plan of the vin should be listed first. got %+v", page)
+	}
+
+	if res := executeGet(t, computeBaseUrl(util.ApiPlans+"/1")); res.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown plan should not be found. got %v", res.StatusCode)
+	}
+	if res := executeGet(t, computeBaseUrl(util.ApiPlans+"?from=yesterday")); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid time should be rejected. got %v", res.StatusCode)
+	}
+}
+
+func TestPlanHistoryQuery(t *testing.T) {
+	store, err := history.Open(filepath.Join(testDir, "query.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	start := time.Date(2021, 9, 1, 8, 0, 0, 0, time.UTC)
+	for i := 1; i <= 10; i++ {
+		vin := "W1K2062161F0046"
+		if i%2 == 0 {
+			vin = "W1K2062161F0080"
+		}
+		record := &model.PlanRecord{TransactionID: int64(i), Vin: vin, CreatedAt: start.Add(time.Duration(i) * time.Hour)}
+		if err := store.Save(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(page *model.PlanPage) string {
+		list := make([]string, 0)
+		for _, record := range page.Plans {
+			list = append(list, fmt.Sprint(record.TransactionID))
+		}
+		return strings.Join(list, ",")
+	}
+
+	// pages follow each other until the last one
+	query := history.Query{Limit: 4}
+	listed := make([]string, 0)
+	for {
+		page, err := store.List(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listed = append(listed, ids(page))
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if actual := strings.Join(listed, "|"); actual != "10,9,8,7|6,5,4,3|2,1" {
+		t.Errorf("unexpected pages %v", actual)
+	}
+
+	page, _ := store.List(history.Query{Vin: "W1K2062161F0046", From: start.Add(3 * time.Hour), To: start.Add(9 * time.Hour)})
+	if actual := ids(page); actual != "7,5,3" {
+		t.Errorf("plans of the vin within the time range should be 7,5,3 but got %v", actual)
+	}
+
+	if _, err := store.List(history.Query{Cursor: "invalid"}); err != history.ErrInvalidCursor {
+		t.Errorf("invalid cursor should be rejected. got %v", err)
+	}
+
+	pruned, err := store.Prune(start.Add(5 * time.Hour))
+	if err != nil || pruned != 4 {
+		t.Errorf("4 plans should be pruned but got %v. %v", pruned, err)
+	}
+	page, _ = store.List(history.Query{Vin: "W1K2062161F0080"})
+	if actual := ids(page); actual != "10,8,6" {
+		t.Errorf("pruned plans should not be listed. got %v", actual)
+	}
+}
+
+func TestSavePlans(t *testing.T) {
+	// a burst of plans is written in batches by the writer and can be read once flushed
+	vin := "W1K2062161F0150"
+	for i := int64(1); i <= planBatchSize+50; i++ {
+		savePlan(&model.PlanRecord{TransactionID: 1<<40 + i, Vin: vin, CreatedAt: time.Now()})
+	}
+	flushPlans()
+	page, err := getPlanHistory().List(history.Query{Vin: vin, Limit: util.MaxHistoryLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Plans) != planBatchSize+50 {
+		t.Errorf("expected the plans to be saved but got %v plans", len(page.Plans))
+	}
+}
@@ -2,16 +2,15 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 
 	"fmt"
 	"io/ioutil"
 	"net/http"
 
-	"github.com/SDJLee/mercedes-benz/metrics"
 	"github.com/SDJLee/mercedes-benz/model"
 	"github.com/SDJLee/mercedes-benz/util"
-	"github.com/spf13/viper"
 )
 
 var defaultHeaders = map[string]string{
@@ -19,12 +18,13 @@ var defaultHeaders = map[string]string{
 	"Response-Type": "application/json",
 }
 
-// retrieves current charge level
-func GetChargeLevel(requestBody *model.ReqChargeLevel) (*model.ResChargeLevel, error) {
-	defer metrics.StatTime("api.chargelevel")()
+// retrieves current charge level from the upstream API of the tenant
+func GetChargeLevel(ctx context.Context, t *tenant, requestBody *model.ReqChargeLevel) (*model.ResChargeLevel, error) {
+	logger := requestLogger(ctx)
+	defer t.stats.StatTime("api.chargelevel")()
 	logger.Info("retrieving charge level data")
 	defer logger.Info("retrieved charge level data")
-	url := fmt.Sprintf("%s/charge_level", viper.GetString(util.ApiAddress))
+	url := fmt.Sprintf("%s/%s", t.apiAddress(), upstreamPaths[util.EndpointCharge])
 	logger.Debugf("API url to retrieve charge level: %s", url)
 
 	jsonPayload, err := json.Marshal(requestBody)
@@ -32,7 +32,7 @@ func GetChargeLevel(requestBody *model.ReqChargeLevel) (*model.ResChargeLevel, e
 		return nil, err
 	}
 
-	responseByte, err := makePostRequest(url, jsonPayload)
+	responseByte, err := postUpstream(ctx, t, util.EndpointCharge, url, jsonPayload)
 	if err != nil {
 		return nil, err
 	}
@@ -45,12 +45,13 @@ func GetChargeLevel(requestBody *model.ReqChargeLevel) (*model.ResChargeLevel, e
 	return response, nil
 }
 
-// retrieves travel distance
-func GetTravelDistance(requestBody *model.ReqTravelDistance) (*model.ResTravelDistance, error) {
-	defer metrics.StatTime("api.traveldistance")()
+// retrieves travel distance from the upstream API of the tenant
+func GetTravelDistance(ctx context.Context, t *tenant, requestBody *model.ReqTravelDistance) (*model.ResTravelDistance, error) {
+	logger := requestLogger(ctx)
+	defer t.stats.StatTime("api.traveldistance")()
 	logger.Info("retrieving travel distance data")
 	defer logger.Info("retrieved travel distance data")
-	url := fmt.Sprintf("%s/distance", viper.GetString(util.ApiAddress))
+	url := fmt.Sprintf("%s/%s", t.apiAddress(), upstreamPaths[util.EndpointDistance])
 	logger.Debugf("API url to retrieve travel distance: %s", url)
 
 	jsonPayload, err := json.Marshal(requestBody)
@@ -58,7 +59,7 @@ func GetTravelDistance(requestBody *model.ReqTravelDistance) (*model.ResTravelDi
 		return nil, err
 	}
 
-	responseByte, err := makePostRequest(url, jsonPayload)
+	responseByte, err := postUpstream(ctx, t, util.EndpointDistance, url, jsonPayload)
 	if err != nil {
 		return nil, err
 	}
@@ -71,12 +72,13 @@ func GetTravelDistance(requestBody *model.ReqTravelDistance) (*model.ResTravelDi
 	return response, nil
 }
 
-// retrieves charging stations
-func GetChargingStations(requestBody *model.ReqChargeStations) (*model.ResChargeStations, error) {
-	defer metrics.StatTime("api.chargestation")()
+// retrieves charging stations from the upstream API of the tenant
+func GetChargingStations(ctx context.Context, t *tenant, requestBody *model.ReqChargeStations) (*model.ResChargeStations, error) {
+	logger := requestLogger(ctx)
+	defer t.stats.StatTime("api.chargestation")()
 	logger.Info("retrieving charge stations data")
 	defer logger.Info("retrieved charge stations data")
-	url := fmt.Sprintf("%s/charging_stations", viper.GetString(util.ApiAddress))
+	url := fmt.Sprintf("%s/%s", t.apiAddress(), upstreamPaths[util.EndpointStations])
 	logger.Debugf("API url to retrieve charge stations: %s", url)
 
 	jsonPayload, err := json.Marshal(requestBody)
@@ -84,7 +86,7 @@ func GetChargingStations(requestBody *model.ReqChargeStations) (*model.ResCharge
 		return nil, err
 	}
 
-	responseByte, err := makePostRequest(url, jsonPayload)
+	responseByte, err := postUpstream(ctx, t, util.EndpointStations, url, jsonPayload)
 	if err != nil {
 		return nil, err
 	}
@@ -97,11 +99,12 @@ func GetChargingStations(requestBody *model.ReqChargeStations) (*model.ResCharge
 	return response, nil
 }
 
-// common method to perform http post request
-func makePostRequest(url string, bytePayload []byte) ([]byte, error) {
+// common method to perform http post request with the headers added to the default ones. The request is cancelled when ctx is done.
+// A 5xx response is an error, so that the circuit breaker and the limiter count it as a failure of the upstream.
+func makePostRequest(ctx context.Context, url string, bytePayload []byte, headers map[string]string) ([]byte, error) {
 	bufferPayload := bytes.NewBuffer(bytePayload)
 	client := &http.Client{}
-	request, err := http.NewRequest("POST", url, bufferPayload)
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bufferPayload)
 	if err != nil {
 		return nil, err
 	}
@@ -109,6 +112,9 @@ func makePostRequest(url string, bytePayload []byte) ([]byte, error) {
 	for key, val := range defaultHeaders {
 		request.Header.Add(key, val)
 	}
+	for key, val := range headers {
+		request.Header.Set(key, val)
+	}
 
 	response, err := client.Do(request)
 	if err != nil {
@@ -124,5 +130,8 @@ func makePostRequest(url string, bytePayload []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if response.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("upstream responded with status %v", response.StatusCode)
+	}
 	return responseByte, nil
 }
@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// maxIdempotencyKey is the maximum length of an idempotency key.
+const maxIdempotencyKey = 255
+
+var (
+	errIdempotencyKey        = errors.New("idempotency key should have 1 to 255 characters")
+	errIdempotencyMismatch   = errors.New("idempotency key is already used with a different request")
+	errIdempotencyInProgress = errors.New("request with the idempotency key is in progress")
+)
+
+// idempotentHeaders are the response headers stored along with the response.
+var idempotentHeaders = []string{"Content-Type", util.TransactionHeader}
+
+var idempotency struct {
+	once  sync.Once
+	store *idempotencyStore
+}
+
+// idempotencyEntry is the response stored for an idempotency key. fingerprint is the hash of the request body. An entry that is not
+// done belongs to a request in progress.
+type idempotencyEntry struct {
+	fingerprint string
+	done        bool
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyStore keeps the responses of the requests with an idempotency key in memory until they expire.
+type idempotencyStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+func getIdempotencyStore() *idempotencyStore {
+	idempotency.once.Do(func() {
+		ttl := viper.GetInt(util.IdempotencyTTL)
+		if ttl <= 0 {
+			ttl = util.DefaultIdemTTL
+		}
+		idempotency.store = newIdempotencyStore(time.Duration(ttl) * time.Second)
+	})
+	return idempotency.store
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// begin returns the stored response for the key. If there is none, the key is reserved for the request and begin returns nil.
+// It fails when the key is used with a different request or the request with the key is still in progress.
+func (s *idempotencyStore) begin(key string, fingerprint string) (*idempotencyEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := timeNow()
+	s.sweep(now)
+	entry, ok := s.entries[key]
+	if !ok || now.After(entry.expires) {
+		s.entries[key] = &idempotencyEntry{fingerprint: fingerprint, expires: now.Add(s.ttl)}
+		return nil, nil
+	}
+	if entry.fingerprint != fingerprint {
+		return nil, errIdempotencyMismatch
+	}
+	if !entry.done {
+		return nil, errIdempotencyInProgress
+	}
+	copied := *entry
+	return &copied, nil
+}
+
+// complete stores the response for the key. The response expires after the TTL.
+func (s *idempotencyStore) complete(key string, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	entry.done = true
+	entry.status = status
+	entry.header = header
+	entry.body = body
+	entry.expires = timeNow().Add(s.ttl)
+}
+
+// release removes the key so that the request can be retried.
+func (s *idempotencyStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// sweep removes the expired entries, at most once per TTL.
+func (s *idempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// invalidate drops the stored responses, so the keys can be used again. The keys of the requests in progress stay reserved. It returns
+// the number of responses dropped.
+func (s *idempotencyStore) invalidate() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := 0
+	for key, entry := range s.entries {
+		if entry.done {
+			delete(s.entries, key)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// recordingWriter keeps a copy of the response body.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// IdempotencyMiddleware responds to a request with the Idempotency-Key header with the stored response of the first request with the key
+// and the same body, marked with the Idempotent-Replayed header. The key is scoped to the route, the authenticated client and the tenant,
+// so it should come after AuthMiddleware and TenantMiddleware. Failures with status 5xx and the technical failures the v1 API responds
+// with status 200, marked by markTechnicalFailure, are not stored, so they can be retried with the same key. Requests without the key
+// are handled as usual. reject responds to the requests that can't use the key with the status and
+// the reason.
+func IdempotencyMiddleware(reject func(c *gin.Context, status int, err error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(util.IdempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			reject(c, http.StatusBadRequest, errIdempotencyKey)
+			c.Abort()
+			return
+		}
+		body, err := readBody(c)
+		if err == errBodyTooLarge {
+			reject(c, http.StatusRequestEntityTooLarge, err)
+			c.Abort()
+			return
+		}
+		if err != nil {
+			logger.Error("failed to read request body", err)
+			reject(c, http.StatusBadRequest, err)
+			c.Abort()
+			return
+		}
+		hash := sha256.Sum256(body)
+		t := tenantFrom(c.Request.Context())
+		storeKey := t.namespace(clientId(c) + " " + c.Request.Method + " " + c.FullPath() + " " + key)
+
+		store := getIdempotencyStore()
+		entry, err := store.begin(storeKey, hex.EncodeToString(hash[:]))
+		if err != nil {
+			logger.Warnf("rejected idempotency key %q. %v", key, err)
+			t.stats.StatCount("counters.idempotency.conflict", 1)
+			reject(c, http.StatusConflict, err)
+			c.Abort()
+			return
+		}
+		if entry != nil {
+			t.stats.StatCount("counters.idempotency.replayed", 1)
+			for name, values := range entry.header {
+				c.Writer.Header()[name] = values
+			}
+			c.Header(util.IdempotentReplayed, "true")
+			c.Data(entry.status, entry.header.Get("Content-Type"), entry.body)
+			c.Abort()
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		stored := false
+		// the key is released when the request panics or fails, so that it can be retried
+		defer func() {
+			if !stored {
+				store.release(storeKey)
+			}
+		}()
+		c.Next()
+		if c.Writer.Status() >= http.StatusInternalServerError || c.GetBool(util.TechFailureKey) {
+			return
+		}
+		header := make(http.Header)
+		for _, name := range idempotentHeaders {
+			if value := c.Writer.Header().Get(name); value != "" {
+				header.Set(name, value)
+			}
+		}
+		store.complete(storeKey, c.Writer.Status(), header, writer.body.Bytes())
+		stored = true
+	}
+}
+
+// markTechnicalFailure marks the response of the request as a technical failure, such as an upstream failure or timeout, that the v1 API
+// responds with status 200 and the error 9999. The response is not stored for the idempotency key, so that a retry computes it again.
+func markTechnicalFailure(c *gin.Context) {
+	c.Set(util.TechFailureKey, true)
+}
+
+// rejectIdempotency responds to the v1 requests that can't use their idempotency key.
+func rejectIdempotency(c *gin.Context, status int, err error) {
+	c.String(status, err.Error())
+}
+
+// rejectIdempotencyV2 responds to the v2 requests that can't use their idempotency key with the problem details.
+func rejectIdempotencyV2(c *gin.Context, status int, err error) {
+	code := util.ErrCodeIdempotency
+	switch status {
+	case http.StatusBadRequest:
+		code = util.ErrCodeInvalidReq
+	case http.StatusRequestEntityTooLarge:
+		code = util.ErrCodeTooLarge
+	}
+	writeProblem(c, &travelError{code: code, err: err}, transactionId(c))
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/spf13/viper"
+)
+
+func executeIdempotentRequest(t *testing.T, url string, key string, payload string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(ReqPost, url, strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set(util.IdempotencyHeader, key)
+	}
+	return executeRequest(req)
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0046"] = 60
+	stub.distances[routeKey("Home", "Movie Theatre")] = 50
+	url := computeBaseUrl(util.ApiComputeRoute)
+
+	first := executeIdempotentRequest(t, url, "retry-1", reqTestCase4)
+	repeat := executeIdempotentRequest(t, url, "retry-1", reqTestCase4)
+	if repeat.Code != first.Code || repeat.Body.String() != first.Body.String() {
+		t.Errorf("repeated request should get the first response %v but got %v", first.Body.String(), repeat.Body.String())
+	}
+	if repeat.Header().Get(util.IdempotentReplayed) != "true" {
+		t.Error("repeated response should be marked as replayed")
+	}
+	if repeat.Header().Get(util.TransactionHeader) != first.Header().Get(util.TransactionHeader) {
+		t.Error("repeated response should have the transaction id of the first response")
+	}
+	if calls := stub.callCount("charge_level"); calls != 1 {
+		t.Errorf("upstream should be called once but got %v calls", calls)
+	}
+
+	conflict := executeIdempotentRequest(t, url, "retry-1", `{ "vin": "W1K2062161F0046", "source": "Home", "destination": "Airport" }`)
+	if conflict.Code != http.StatusConflict {
+		t.Errorf("key reused with a different body should be rejected with %v but got %v", http.StatusConflict, conflict.Code)
+	}
+
+	// the key is scoped to the route and requests without a key are not stored
+	v2 := executeIdempotentRequest(t, strings.Replace(url, util.ApiV1, util.ApiV2, 1), "retry-1", reqTestCase4)
+	if v2.Code != http.StatusOK || v2.Header().Get(util.IdempotentReplayed) != "" {
+		t.Errorf("the key in another route should not replay. got %v", v2.Code)
+	}
+	executeIdempotentRequest(t, url, "", reqTestCase4)
+	executeIdempotentRequest(t, url, "", reqTestCase4)
+	if calls := stub.callCount("charge_level"); calls != 4 {
+		t.Errorf("upstream should be called for each request without a replay but got %v calls", calls)
+	}
+}
+
+func TestIdempotencyUpstreamFailure(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0046"] = 60
+	stub.distances[routeKey("Home", "Movie Theatre")] = 50
+	url := computeBaseUrl(util.ApiComputeRoute)
+
+	// the v1 API responds the upstream failure with status 200 and the error 9999, which is not kept for the key
+	stub.status = http.StatusInternalServerError
+	first := executeIdempotentRequest(t, url, "retry-failure", reqTestCase4)
+	if first.Code != http.StatusOK || !strings.Contains(first.Body.String(), "9999") {
+		t.Fatalf("expected the technical exception with status 200 but got %v %v", first.Code, first.Body.String())
+	}
+	stub.status = 0
+	retry := executeIdempotentRequest(t, url, "retry-failure", reqTestCase4)
+	if retry.Header().Get(util.IdempotentReplayed) != "" || strings.Contains(retry.Body.String(), "9999") {
+		t.Errorf("the retry should reach the upstream API again but got %v", retry.Body.String())
+	}
+	if calls := stub.callCount("charge_level"); calls < 2 {
+		t.Errorf("upstream should be called by the retry but got %v calls", calls)
+	}
+}
+
+func TestIdempotencyV2Conflict(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0046"] = 60
+	stub.distances[routeKey("Home", "Movie Theatre")] = 50
+	url := strings.Replace(computeBaseUrl(util.ApiComputeRoute), util.ApiV1, util.ApiV2, 1)
+
+	executeIdempotentRequest(t, url, "retry-v2", reqTestCase4)
+	rr := executeIdempotentRequest(t, url, "retry-v2", `{ "vin": "W1K2062161F0046", "source": "Home", "destination": "Airport" }`)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("key reused with a different body should be rejected with %v but got %v", http.StatusConflict, rr.Code)
+	}
+	assertProblem(t, "idempotency conflict", rr, util.ErrCodeIdempotency)
+}
+
+func TestIdempotencyBodySize(t *testing.T) {
+	viper.Set(util.MaxBodyBytes, 128)
+	defer viper.Set(util.MaxBodyBytes, 0)
+	payload := `{ "vin": "W1K2062161F0046", "source": "Home", "destination": "` + strings.Repeat("x", 128) + `" }`
+
+	rr := executeIdempotentRequest(t, computeBaseUrl(util.ApiComputeRoute), "large-v1", payload)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+	rr = executeIdempotentRequest(t, strings.Replace(computeBaseUrl(util.ApiComputeRoute), util.ApiV1, util.ApiV2, 1), "large-v2", payload)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+	assertProblem(t, "large body", rr, util.ErrCodeTooLarge)
+}
+
+func TestIdempotencyStoreExpiry(t *testing.T) {
+	now := time.Date(2021, 9, 1, 8, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	store := newIdempotencyStore(time.Minute)
+	if entry, err := store.begin("key", "a"); entry != nil || err != nil {
+		t.Fatalf("first request should reserve the key. got %v %v", entry, err)
+	}
+	if _, err := store.begin("key", "a"); err != errIdempotencyInProgress {
+		t.Errorf("request in progress should be rejected. got %v", err)
+	}
+	store.complete("key", http.StatusOK, http.Header{}, []byte("{}"))
+	if entry, _ := store.begin("key", "a"); entry == nil || string(entry.body) != "{}" {
+		t.Errorf("stored response should be returned. got %v", entry)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if entry, err := store.begin("key", "b"); entry != nil || err != nil {
+		t.Errorf("expired key should be reserved again. got %v %v", entry, err)
+	}
+	store.release("key")
+	if entry, err := store.begin("key", "c"); entry != nil || err != nil {
+		t.Errorf("released key should be reserved again. got %v %v", entry, err)
+	}
+}
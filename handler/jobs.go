@@ -0,0 +1,406 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/metrics"
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/spf13/viper"
+)
+
+var errQueueFull = errors.New("job queue is full")
+
+// callbackTimeout bounds the time taken to post a completed job to its callback URL.
+const callbackTimeout = 10 * time.Second
+
+var jobs struct {
+	once    sync.Once
+	manager *jobManager
+}
+
+// jobManager computes the submitted jobs in a bounded pool of workers. Every job is persisted as a JSON file in the jobs directory
+// whenever its status changes, so the jobs that were queued or running when the service stopped are queued again on start.
+type jobManager struct {
+	dir      string
+	queue    chan string
+	mu       sync.Mutex
+	jobs     map[string]*model.Job
+	workers  sync.WaitGroup
+	stopping chan struct{}
+	stopOnce sync.Once
+}
+
+// StartJobWorkers starts the job workers and queues the jobs left pending by a previous run.
+// The workers are started on the first use of the job API otherwise.
+func StartJobWorkers() {
+	getJobManager()
+}
+
+func getJobManager() *jobManager {
+	jobs.once.Do(func() {
+		// the jobs must survive a restart, so they are never kept in the temporary directory
+		dir := viper.GetString(util.JobsPath)
+		if dir == "" {
+			dir = filepath.Join(basePath(), util.DefaultJobsDir)
+		}
+		workers := viper.GetInt(util.JobsWorkers)
+		if workers <= 0 {
+			workers = util.DefaultJobsWorkers
+		}
+		queueSize := viper.GetInt(util.JobsQueueSize)
+		if queueSize <= 0 {
+			queueSize = util.DefaultJobsQueue
+		}
+		manager, err := newJobManager(dir, queueSize)
+		if err != nil {
+			logger.Error("failed to load jobs", err)
+		}
+		manager.start(workers)
+		go manager.pruneJobs()
+		jobs.manager = manager
+	})
+	return jobs.manager
+}
+
+// newJobManager loads the jobs persisted in dir. The jobs that are not done are queued again. Files that can't be read are skipped.
+func newJobManager(dir string, queueSize int) (*jobManager, error) {
+	manager := &jobManager{
+		dir:      dir,
+		queue:    make(chan string, queueSize),
+		jobs:     make(map[string]*model.Job),
+		stopping: make(chan struct{}),
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return manager, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return manager, err
+	}
+	pending := make([]*model.Job, 0)
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			logger.Errorf("failed to read job file %v. %v", file.Name(), err)
+			continue
+		}
+		job := &model.Job{}
+		if err := json.Unmarshal(content, job); err != nil {
+			logger.Errorf("failed to parse job file %v. %v", file.Name(), err)
+			continue
+		}
+		manager.jobs[job.ID] = job
+		if job.Status == model.JobQueued || job.Status == model.JobRunning {
+			pending = append(pending, job)
+		}
+	}
+	logger.Infof("loaded %v jobs, %v pending", len(manager.jobs), len(pending))
+	// the pending jobs can be more than the queue holds. They are queued as the workers take them.
+	go func() {
+		for _, job := range pending {
+			select {
+			case manager.queue <- job.ID:
+			case <-manager.stopping:
+				return
+			}
+		}
+	}()
+	return manager, nil
+}
+
+func (m *jobManager) start(workers int) {
+	m.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go m.work()
+	}
+}
+
+// stop stops the workers from taking queued jobs and waits for the running jobs until ctx is done. The jobs left queued or running
+// are persisted as such, so they are queued again on the next start.
+func (m *jobManager) stop(ctx context.Context) error {
+	m.stopOnce.Do(func() { close(m.stopping) })
+	stopped := make(chan struct{})
+	go func() {
+		m.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("jobs are still running. %w", ctx.Err())
+	}
+}
+
+// pruneJobs deletes the jobs done longer than JOBS_RETENTION_DAYS ago every pruneInterval, until the manager stops.
+func (m *jobManager) pruneJobs() {
+	days := viper.GetInt(util.JobsRetention)
+	if days <= 0 {
+		days = util.DefaultJobsRetain
+	}
+	for {
+		if pruned := m.prune(time.Now().AddDate(0, 0, -days)); pruned > 0 {
+			logger.Infof("pruned %v jobs older than %v days", pruned, days)
+		}
+		if !m.sleep(pruneInterval) {
+			return
+		}
+	}
+}
+
+// prune deletes the completed and failed jobs last updated before the time, with their files. It returns the number of deleted jobs.
+func (m *jobManager) prune(before time.Time) int {
+	m.mu.Lock()
+	var expired []string
+	for id, job := range m.jobs {
+		if (job.Status == model.JobCompleted || job.Status == model.JobFailed) && job.UpdatedAt.Before(before) {
+			expired = append(expired, id)
+			delete(m.jobs, id)
+		}
+	}
+	m.mu.Unlock()
+	for _, id := range expired {
+		if err := os.Remove(filepath.Join(m.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+			logger.Errorf("failed to delete job file of %v. %v", id, err)
+		}
+	}
+	return len(expired)
+}
+
+// submit persists the job of the tenant and queues it. It fails with errQueueFull when the queue has no room for the job.
+func (m *jobManager) submit(jobReq *model.JobRequest, tenantId string) (*model.Job, error) {
+	id, err := newJobId()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	job := &model.Job{
+		ID:          id,
+		Status:      model.JobQueued,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		CallbackURL: jobReq.CallbackURL,
+		Tenant:      tenantId,
+		Request:     jobReq.Request,
+		Batch:       jobReq.Batch,
+	}
+	if len(m.queue) == cap(m.queue) {
+		return nil, errQueueFull
+	}
+	if err := m.save(job); err != nil {
+		return nil, err
+	}
+	select {
+	case m.queue <- job.ID:
+	default:
+		m.update(job.ID, func(job *model.Job) {
+			job.Status = model.JobFailed
+			job.Error = errQueueFull.Error()
+		})
+		return nil, errQueueFull
+	}
+	jobStats(job).StatCount("counters.jobs.submitted", 1)
+	return m.get(job.ID), nil
+}
+
+// get returns a copy of the job. It returns nil if there is no job with the id.
+func (m *jobManager) get(id string) *model.Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil
+	}
+	copied := *job
+	return &copied
+}
+
+// update changes the job with fn and persists it.
+func (m *jobManager) update(id string, fn func(job *model.Job)) *model.Job {
+	m.mu.Lock()
+	job := m.jobs[id]
+	copied := *job
+	fn(&copied)
+	copied.UpdatedAt = time.Now().UTC()
+	m.mu.Unlock()
+	if err := m.save(&copied); err != nil {
+		logger.Errorf("failed to persist job %v. %v", id, err)
+	}
+	return &copied
+}
+
+// save writes the job into its file and keeps it in memory. The file is written in a temporary file and renamed, so a crash doesn't leave a partial file.
+func (m *jobManager) save(job *model.Job) error {
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+	content, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(m.dir, job.ID+".json")
+	if err := ioutil.WriteFile(file+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+func (m *jobManager) work() {
+	defer m.workers.Done()
+	for {
+		// a stopped worker doesn't take another job even if one is queued
+		select {
+		case <-m.stopping:
+			return
+		default:
+		}
+		select {
+		case <-m.stopping:
+			return
+		case id := <-m.queue:
+			m.run(id)
+		}
+	}
+}
+
+// run computes the job and posts it to the callback URL, if any.
+func (m *jobManager) run(id string) {
+	job := m.update(id, func(job *model.Job) {
+		job.Status = model.JobRunning
+	})
+	stats := jobStats(job)
+	defer stats.StatTime("jobs.run")()
+	logger.Infof("running job %v", id)
+	result, batchResult, err := computeJob(job)
+	job = m.update(id, func(job *model.Job) {
+		job.Result = result
+		job.BatchResult = batchResult
+		job.Status = model.JobCompleted
+		if err != nil {
+			job.Status = model.JobFailed
+			job.Error = err.Error()
+		}
+	})
+	stats.StatCount(fmt.Sprintf("counters.jobs.%v", job.Status), 1)
+	logger.Infof("job %v is %v", id, job.Status)
+	if job.CallbackURL != "" {
+		m.postJobCallback(job)
+	}
+}
+
+// computeJob computes the request or the batch of requests in the job for its tenant. The job fails when its tenant is no longer
+// configured.
+func computeJob(job *model.Job) (result *model.Response, batchResult *model.BatchResponse, err error) {
+	ctx := context.Background()
+	defer func() {
+		if ex := recover(); ex != nil {
+			requestLogger(ctx).Error("panic recovered in job", job.ID, ex)
+			err = errors.New(util.ErrTechExpMsg)
+		}
+	}()
+	t, err := tenantById(job.Tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	// a request is bounded by the request timeout like ComputeRoute, and a batch by the request timeout of each round of its
+	// concurrent requests
+	timeout := requestTimeout()
+	if job.Request == nil {
+		timeout *= time.Duration((len(job.Batch) + batchConcurrency() - 1) / batchConcurrency())
+	}
+	ctx, cancel := context.WithTimeout(withTenant(ctx, t), timeout)
+	defer cancel()
+	if job.Request != nil {
+		response, _ := computeTravel(ctx, t.provider, job.Request, nextTransactionId())
+		return response, nil, nil
+	}
+	return nil, computeBatch(ctx, t.provider, job.Batch, nil), nil
+}
+
+// jobStats returns the metrics of the tenant of the job, or the metrics without a prefix when the tenant is no longer configured.
+func jobStats(job *model.Job) metrics.Prefix {
+	if t, err := tenantById(job.Tenant); err == nil {
+		return t.stats
+	}
+	return ""
+}
+
+func newJobId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// HandleSubmitJob queues a request or a batch of requests to be computed asynchronously. It responds with the job, whose status can be
+// polled with HandleGetJob.
+func HandleSubmitJob(c *gin.Context) {
+	var jobReq model.JobRequest
+	if err := c.ShouldBindBodyWith(&jobReq, binding.JSON); err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+	logger := requestLogger(c.Request.Context())
+	if err := validateJobRequest(c.Request.Context(), &jobReq); err != nil {
+		logger.Error("invalid job request", err)
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	job, err := getJobManager().submit(&jobReq, tenantFrom(c.Request.Context()).id)
+	if err == errQueueFull {
+		logger.Warn("job queue is full")
+		c.String(http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		logger.Error("failed to submit job", err)
+		c.String(http.StatusInternalServerError, util.ErrTechExpMsg)
+		return
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// HandleGetJob responds with the status of the job and its result once it is completed. The jobs of other tenants are not found.
+func HandleGetJob(c *gin.Context) {
+	job := getJobManager().get(c.Param("id"))
+	if job == nil || job.Tenant != tenantFrom(c.Request.Context()).id {
+		c.String(http.StatusNotFound, `job not found`)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// validateJobRequest checks that the job has either a request or a non-empty batch within the batch size, and that the callback URL is an
+// absolute http(s) URL that can be posted to, as checked by checkCallbackURL.
+func validateJobRequest(ctx context.Context, jobReq *model.JobRequest) error {
+	if (jobReq.Request == nil) == (len(jobReq.Batch) == 0) {
+		return errors.New("job should have either a request or a batch")
+	}
+	if maxSize := batchMaxSize(); len(jobReq.Batch) > maxSize {
+		return fmt.Errorf("batch should have 1 to %d requests", maxSize)
+	}
+	if jobReq.CallbackURL != "" {
+		return checkCallbackURL(ctx, jobReq.CallbackURL)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/spf13/viper"
+)
+
+func TestJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set(util.JobsPath, dir)
+
+	stub := defaultRouteStub()
+	defer stub.use()()
+
+	callbacks := make(chan *model.Job, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		job := &model.Job{}
+		json.NewDecoder(r.Body).Decode(job)
+		callbacks <- job
+	}))
+	defer receiver.Close()
+	// the receiver is on the loopback address, which is refused unless allowed
+	viper.Set(util.JobsCallbackHosts, strings.TrimPrefix(receiver.URL, "http://"))
+	defer viper.Set(util.JobsCallbackHosts, "")
+
+	payload := fmt.Sprintf(`{ "request": { "vin": "W1K2062161F0046", "source": "Home", "destination": "Movie Theatre" }, "callbackUrl": "%v" }`, receiver.URL)
+	req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiJobs), bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := executeRequest(req)
+	if status := rr.Code; status != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusAccepted)
+	}
+	submitted := &model.Job{}
+	if err := json.Unmarshal(rr.Body.Bytes(), submitted); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case job := <-callbacks:
+		if job.ID != submitted.ID || job.Status != model.JobCompleted {
+			t.Errorf("callback should receive completed job %v but got %v with status %v", submitted.ID, job.ID, job.Status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job callback wasn't received")
+	}
+
+	req, err = http.NewRequest("GET", computeBaseUrl(util.ApiJobs)+"/"+submitted.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = executeRequest(req)
+	job := &model.Job{}
+	if err := json.Unmarshal(rr.Body.Bytes(), job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != model.JobCompleted || job.Result == nil || len(job.Result.ChargingStations) != 2 {
+		t.Errorf("job should be completed with S1 and S2 for charging stations. got %+v", job)
+	}
+
+	req, err = http.NewRequest("GET", computeBaseUrl(util.ApiJobs)+"/unknown", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr = executeRequest(req); rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestJobsTimeout(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	stub.onCall = func(endpoint string) {
+		time.Sleep(1500 * time.Millisecond)
+	}
+	viper.Set(util.RequestTimeout, 1)
+	defer viper.Set(util.RequestTimeout, 0)
+
+	// the job is bounded by the request timeout, so it fails with the technical exception instead of waiting for the upstream API
+	started := time.Now()
+	request := &model.Request{Vin: "W1K2062161F0046", Source: "Home", Destination: "Movie Theatre"}
+	result, _, err := computeJob(&model.Job{ID: "timeout", Request: request})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].ID != util.ErrTechExpId {
+		t.Errorf("expected error %v but got %+v", util.ErrTechExpId, result.Errors)
+	}
+	if elapsed := time.Since(started); elapsed >= 1500*time.Millisecond {
+		t.Errorf("expected the job to time out after a second but it took %v", elapsed)
+	}
+}
+
+func TestJobsInvalidReq(t *testing.T) {
+	payloads := []string{
+		`{}`,
+		`{ "request": { "vin": "W1K2062161F0046" }, "batch": [ { "vin": "W1K2062161F0046" } ] }`,
+		`{ "request": { "vin": "W1K2062161F0046" }, "callbackUrl": "ftp://example.com" }`,
+		`{ "request": { "vin": "W1K2062161F0046" }, "callbackUrl": "http://169.254.169.254/latest/meta-data" }`,
+		`{ "request": { "vin": "W1K2062161F0046" }, "callbackUrl": "http://127.0.0.1:8080/api/v1/plans" }`,
+		`{ "request": { "vin": "W1K2062161F0046" }, "callbackUrl": "http://[::1]/" }`,
+		`{ "request": { "vin": "W1K2062161F0046" }, "callbackUrl": "http://192.168.1.10/" }`,
+	}
+	for _, payload := range payloads {
+		req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiJobs), bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rr := executeRequest(req); rr.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code for %v: got %v want %v", payload, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// TestJobsResume checks that a job left queued by a previous run is computed when the jobs are loaded.
+func TestJobsResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stub := newUpstreamStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0046"] = 60
+	stub.distances[routeKey("Home", "Movie Theatre")] = 50
+
+	pending := &model.Job{
+		ID:      "pending",
+		Status:  model.JobRunning,
+		Request: &model.Request{Vin: "W1K2062161F0046", Source: "Home", Destination: "Movie Theatre"},
+	}
+	content, err := json.Marshal(pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pending.json"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := newJobManager(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.start(1)
+	deadline := time.Now().Add(5 * time.Second)
+	for manager.get("pending").Status != model.JobCompleted {
+		if time.Now().After(deadline) {
+			t.Fatal("pending job wasn't completed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job := manager.get("pending"); job.Result == nil || job.Result.IsChargingRequired.Bool {
+		t.Errorf("job should be completed without charging. got %+v", job.Result)
+	}
+}
+
+func TestJobsCallback(t *testing.T) {
+	previous := callbackBackoff
+	callbackBackoff = time.Millisecond
+	defer func() { callbackBackoff = previous }()
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[r.URL.Path]++
+		switch {
+		case r.URL.Path == "/redirect":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		case r.URL.Path == "/flaky" && calls[r.URL.Path] <= 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+	callCount := func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[path]
+	}
+	manager, err := newJobManager(filepath.Join(testDir, "callback-jobs"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the internal addresses are refused when they are not allowed, even once the url was checked
+	manager.postJobCallback(&model.Job{ID: "internal", CallbackURL: receiver.URL + "/internal"})
+	if calls := callCount("/internal"); calls != 0 {
+		t.Errorf("expected the callback to an internal address to be refused but got %v calls", calls)
+	}
+
+	viper.Set(util.JobsCallbackHosts, "callbacks.example, "+strings.TrimPrefix(receiver.URL, "http://"))
+	defer viper.Set(util.JobsCallbackHosts, "")
+	if err := checkCallbackURL(context.Background(), "https://other.example/jobs"); err == nil {
+		t.Error("expected the host that is not allowed to be refused")
+	}
+	if err := checkCallbackURL(context.Background(), "https://callbacks.example/jobs"); err != nil {
+		t.Errorf("expected the allowed host to be accepted but got %v", err)
+	}
+
+	manager.postJobCallback(&model.Job{ID: "flaky", CallbackURL: receiver.URL + "/flaky"})
+	if calls := callCount("/flaky"); calls != 3 {
+		t.Errorf("expected the callback to be retried until it succeeds but got %v calls", calls)
+	}
+	manager.postJobCallback(&model.Job{ID: "redirect", CallbackURL: receiver.URL + "/redirect"})
+	if calls := callCount("/target"); calls != 0 {
+		t.Errorf("expected the redirect not to be followed but got %v calls", calls)
+	}
+	if calls := callCount("/redirect"); calls != util.DefaultCbTries {
+		t.Errorf("expected the redirected callback to fail %v times but got %v calls", util.DefaultCbTries, calls)
+	}
+}
+
+func TestJobsPrune(t *testing.T) {
+	dir := filepath.Join(testDir, "prune-jobs")
+	manager, err := newJobManager(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().AddDate(0, 0, -10)
+	for _, job := range []*model.Job{
+		{ID: "old-completed", Status: model.JobCompleted, UpdatedAt: old},
+		{ID: "old-failed", Status: model.JobFailed, UpdatedAt: old},
+		{ID: "old-queued", Status: model.JobQueued, UpdatedAt: old},
+		{ID: "recent", Status: model.JobCompleted, UpdatedAt: time.Now()},
+	} {
+		if err := manager.save(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pruned := manager.prune(time.Now().AddDate(0, 0, -util.DefaultJobsRetain)); pruned != 2 {
+		t.Errorf("expected 2 jobs to be pruned but got %v", pruned)
+	}
+	for id, kept := range map[string]bool{"old-completed": false, "old-failed": false, "old-queued": true, "recent": true} {
+		_, err := os.Stat(filepath.Join(dir, id+".json"))
+		if (manager.get(id) != nil) != kept || (err == nil) != kept {
+			t.Errorf("expected job %v to be kept: %v", id, kept)
+		}
+	}
+}
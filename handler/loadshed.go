@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/breaker"
+	"github.com/SDJLee/mercedes-benz/loadshed"
+	"github.com/SDJLee/mercedes-benz/metrics"
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/spf13/viper"
+)
+
+// loadReportInterval is the interval between the reports of the limit, in-flight and queued requests of the compute limiter.
+const loadReportInterval = 10 * time.Second
+
+var computeLimiter struct {
+	once    sync.Once
+	limiter *loadshed.Limiter
+}
+
+// getComputeLimiter returns the limiter of the travels of the default tenant computed at once.
+func getComputeLimiter() *loadshed.Limiter {
+	computeLimiter.once.Do(func() {
+		computeLimiter.limiter = newComputeLimiter("")
+	})
+	return computeLimiter.limiter
+}
+
+// newComputeLimiter returns a limiter of the travels computed at once, configured with the CONCURRENCY_* settings, and starts reporting
+// its load with the metric prefix.
+func newComputeLimiter(stats metrics.Prefix) *loadshed.Limiter {
+	limiter := loadshed.New(loadshed.Config{
+		InitialLimit:     configInt(util.ConcurrencyLimit, util.DefaultConcLimit),
+		MinLimit:         configInt(util.ConcurrencyMin, util.DefaultConcMin),
+		MaxLimit:         configInt(util.ConcurrencyMax, util.DefaultConcMax),
+		QueueSize:        configInt(util.ConcurrencyQueue, util.DefaultConcQueue),
+		QueueTimeout:     time.Duration(configInt(util.ConcurrencyWait, util.DefaultConcWait)) * time.Millisecond,
+		LatencyThreshold: time.Duration(configInt(util.ConcurrencyLatency, util.DefaultConcLatency)) * time.Millisecond,
+	})
+	go reportLoad(limiter, stats)
+	return limiter
+}
+
+// configInt returns the configured value of the key, or the default when it is not set or not positive.
+func configInt(key string, defaultValue int) int {
+	if value := viper.GetInt(key); value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func reportLoad(limiter *loadshed.Limiter, prefix metrics.Prefix) {
+	for {
+		stats := limiter.Stats()
+		prefix.StatGauge("gauges.loadshed.limit", stats.Limit)
+		prefix.StatGauge("gauges.loadshed.inflight", stats.InFlight)
+		prefix.StatGauge("gauges.loadshed.queued", stats.Queued)
+		time.Sleep(loadReportInterval)
+	}
+}
+
+// computeTravel computes the travel within the limit of the compute limiter of the tenant, so that a spike queues or is shed instead of
+// flooding the upstream API. The requests that can't be let in fail with the overloaded code. The timeouts and failures of the upstream
+// API cut the limit. Each tenant has its own upstream API and so its own limiter, so that the failures of one don't shed the requests
+// of the others. Replays don't call the upstream API, so they are not limited.
+func computeTravel(ctx context.Context, p provider, reqBody *model.Request, transId int64) (*model.Response, *travelError) {
+	if planOptionsFrom(ctx).replay {
+		return planTravel(ctx, p, reqBody, transId)
+	}
+	t := tenantFrom(ctx)
+	release, err := t.computeLimiter().Acquire(ctx)
+	if err != nil {
+		requestLogger(withTransaction(ctx, transId)).Warn("shedding request", err)
+		t.stats.StatCount("counters.loadshed.shed", 1)
+		return generateExceptionResp(ctx, reqBody.Vin, reqBody.Source, reqBody.Destination, 0, 0, transId, true),
+			&travelError{code: util.ErrCodeOverloaded, err: loadshed.ErrShed}
+	}
+	response, failure := planTravel(ctx, p, reqBody, transId)
+	// an open circuit breaker fails the calls right away, which is no sign of overload
+	release(failure != nil && !errors.Is(failure.err, breaker.ErrOpen) &&
+		(failure.code == util.ErrCodeTimeout || failure.code == fmt.Sprintf(util.ErrCodeUpstream, failure.endpoint)))
+	return response, failure
+}
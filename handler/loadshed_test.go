@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/loadshed"
+	"github.com/SDJLee/mercedes-benz/util"
+)
+
+// useComputeLimiter limits the computed travels with the limiter. It returns a function that restores the configured limiter.
+func useComputeLimiter(limiter *loadshed.Limiter) func() {
+	previous := getComputeLimiter()
+	computeLimiter.limiter = limiter
+	return func() {
+		computeLimiter.limiter = previous
+	}
+}
+
+func TestLoadShedQueue(t *testing.T) {
+	limiter := loadshed.New(loadshed.Config{InitialLimit: 1, MaxLimit: 1, QueueSize: 1, QueueTimeout: time.Second, LatencyThreshold: time.Minute})
+	release, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queued := make(chan error)
+	go func() {
+		release, err := limiter.Acquire(context.Background())
+		if err == nil {
+			release(false)
+		}
+		queued <- err
+	}()
+	for limiter.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := limiter.Acquire(context.Background()); err != loadshed.ErrShed {
+		t.Errorf("expected the request to be shed when the queue is full but got %v", err)
+	}
+
+	release(false)
+	if err := <-queued; err != nil {
+		t.Errorf("expected the queued request to be let in but got %v", err)
+	}
+	if stats := limiter.Stats(); stats.InFlight != 0 || stats.Queued != 0 || stats.Shed != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestLoadShedQueueTimeout(t *testing.T) {
+	limiter := loadshed.New(loadshed.Config{InitialLimit: 1, MaxLimit: 1, QueueSize: 1, QueueTimeout: 20 * time.Millisecond,
+		LatencyThreshold: time.Minute})
+	release, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release(false)
+
+	started := time.Now()
+	if _, err := limiter.Acquire(context.Background()); err != loadshed.ErrShed {
+		t.Errorf("expected the request to be shed after the queue timeout but got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < 20*time.Millisecond {
+		t.Errorf("expected the request to wait for the queue timeout but it waited %v", elapsed)
+	}
+	if stats := limiter.Stats(); stats.Queued != 0 {
+		t.Errorf("expected the shed request to leave the queue but got %+v", stats)
+	}
+}
+
+func TestLoadShedAIMD(t *testing.T) {
+	limiter := loadshed.New(loadshed.Config{InitialLimit: 10, MinLimit: 2, MaxLimit: 12, QueueSize: 10, QueueTimeout: time.Second,
+		LatencyThreshold: time.Minute, Backoff: 0.5})
+
+	// the limit grows while the requests complete in time and the limiter is busy
+	for i := 0; i < 30; i++ {
+		var releases []func(bool)
+		for j := 0; j < limiter.Stats().Limit; j++ {
+			release, err := limiter.Acquire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			releases = append(releases, release)
+		}
+		for _, release := range releases {
+			release(false)
+		}
+	}
+	if limit := limiter.Stats().Limit; limit != 12 {
+		t.Errorf("expected the limit to grow to the maximum of 12 but got %v", limit)
+	}
+
+	// the limit is cut on overload down to the minimum
+	for i := 0; i < 5; i++ {
+		release, err := limiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		release(true)
+	}
+	if limit := limiter.Stats().Limit; limit != 2 {
+		t.Errorf("expected the limit to be cut to the minimum of 2 but got %v", limit)
+	}
+}
+
+func TestLoadShedComputeRoute(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	var once sync.Once
+	started, unblock := make(chan struct{}), make(chan struct{})
+	stub.onCall = func(endpoint string) {
+		once.Do(func() { close(started) })
+		<-unblock
+	}
+	defer useComputeLimiter(loadshed.New(loadshed.Config{InitialLimit: 1, MaxLimit: 1, QueueSize: 0, LatencyThreshold: time.Minute}))()
+
+	done := make(chan int)
+	go func() {
+		done <- executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.1").Code
+	}()
+	<-started
+
+	if rr := executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.1"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+	rr := executeFromIP(t, util.ApiV2, "W1K2062161F0046", "10.0.0.1")
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusServiceUnavailable)
+	} else {
+		assertProblem(t, "v2 overloaded", rr, util.ErrCodeOverloaded)
+	}
+
+	close(unblock)
+	if status := <-done; status != http.StatusOK {
+		t.Errorf("the request in flight should complete but got %v", status)
+	}
+}
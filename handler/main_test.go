@@ -1,16 +1,27 @@
 package handler
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/SDJLee/mercedes-benz/model"
 	"github.com/SDJLee/mercedes-benz/util"
 	"github.com/spf13/viper"
+	"gopkg.in/guregu/null.v3"
 )
 
 var router http.Handler
 
+// testDir has the files written by the tests, such as the plan history
+var testDir string
+
 // TestMain for package 'controller' to setup data for testing.
 func TestMain(m *testing.M) {
 	setup()
@@ -22,11 +33,13 @@ func TestMain(m *testing.M) {
 // This method sets up router and default viper config.
 func setup() {
 	router = SetupRouter()
+	testDir, _ = ioutil.TempDir("", "merc-benz-route-checker-test")
 	setupTestConfig()
 }
 
 func cleanup() {
 	router = nil
+	os.RemoveAll(testDir)
 }
 
 func setupTestConfig() {
@@ -34,4 +47,126 @@ func setupTestConfig() {
 	viper.Set(util.Port, "8080")
 	viper.Set(util.AppEnv, util.EnvDev)
 	viper.Set(util.ApiAddress, "https://restmock.techgig.com/merc")
+	viper.Set(util.HistoryPath, filepath.Join(testDir, "history.db"))
+	// the files kept by default, such as the jobs, are written under the base path
+	viper.Set(util.BasePath, testDir)
+}
+
+// upstreamStub is a stand-in for the upstream API. It serves the charge level by VIN and the distance and charging stations by route,
+// and counts the calls made to each endpoint.
+type upstreamStub struct {
+	*httptest.Server
+	chargeLevels map[string]int64
+	distances    map[string]int64
+	stations     map[string][]*model.Station
+	mu           sync.Mutex
+	calls        map[string]int
+	// onCall is called, when set, before each call is served
+	onCall func(endpoint string)
+	// status, when set, is the status of every response instead of the data
+	status int
+}
+
+// defaultRouteStub returns an upstream stub where W1K2062161F0046 and W1K2062161F0047 have the charge 17 and drive 50 from Home to Movie
+// Theatre, which needs both of the stations S1 and S2 on the way. S1 charges at 150 kW.
+func defaultRouteStub() *upstreamStub {
+	stub := newUpstreamStub()
+	for _, vin := range []string{"W1K2062161F0046", "W1K2062161F0047"} {
+		stub.chargeLevels[vin] = 17
+	}
+	stub.distances[routeKey("Home", "Movie Theatre")] = 50
+	stub.stations[routeKey("Home", "Movie Theatre")] = []*model.Station{
+		{Name: "S1", Limit: 20, Distance: 10, MaxPower: 150},
+		{Name: "S2", Limit: 15, Distance: 25},
+	}
+	return stub
+}
+
+func newUpstreamStub() *upstreamStub {
+	stub := &upstreamStub{
+		chargeLevels: make(map[string]int64),
+		distances:    make(map[string]int64),
+		stations:     make(map[string][]*model.Station),
+		calls:        make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/charge_level", func(w http.ResponseWriter, r *http.Request) {
+		req := &model.ReqChargeLevel{}
+		stub.decode(r, "charge_level", req)
+		res := &model.ResChargeLevel{Vin: req.Vin}
+		if level, ok := stub.chargeLevels[req.Vin]; ok {
+			res.CurrentChargeLevel = level
+		} else {
+			res.Error = null.StringFrom("Invalid VIN")
+		}
+		json.NewEncoder(w).Encode(res)
+	})
+	mux.HandleFunc("/distance", func(w http.ResponseWriter, r *http.Request) {
+		req := &model.ReqTravelDistance{}
+		stub.decode(r, "distance", req)
+		res := &model.ResTravelDistance{Source: req.Source, Destination: req.Destination}
+		if distance, ok := stub.distances[routeKey(req.Source, req.Destination)]; ok {
+			res.Distance = distance
+		} else {
+			res.Error = null.StringFrom("Invalid source or destination")
+		}
+		json.NewEncoder(w).Encode(res)
+	})
+	mux.HandleFunc("/charging_stations", func(w http.ResponseWriter, r *http.Request) {
+		req := &model.ReqChargeStations{}
+		stub.decode(r, "charging_stations", req)
+		res := &model.ResChargeStations{Source: req.Source, Destination: req.Destination}
+		if stations, ok := stub.stations[routeKey(req.Source, req.Destination)]; ok {
+			res.ChargingStations = stations
+		} else {
+			res.Error = null.StringFrom("Invalid source or destination")
+		}
+		json.NewEncoder(w).Encode(res)
+	})
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		status := stub.status
+		stub.mu.Unlock()
+		if status != 0 {
+			stub.decode(r, strings.TrimPrefix(r.URL.Path, "/"), &struct{}{})
+			w.WriteHeader(status)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return stub
+}
+
+func (stub *upstreamStub) decode(r *http.Request, endpoint string, req interface{}) {
+	stub.mu.Lock()
+	stub.calls[endpoint]++
+	onCall := stub.onCall
+	stub.mu.Unlock()
+	if onCall != nil {
+		onCall(endpoint)
+	}
+	json.NewDecoder(r.Body).Decode(req)
+}
+
+func (stub *upstreamStub) callCount(endpoint string) int {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	return stub.calls[endpoint]
+}
+
+// use points the API address to the stub. It returns a function that restores the API address and closes the stub. The circuit breakers
+// are reset both ways, so that the failures of a test don't fail the next one.
+func (stub *upstreamStub) use() func() {
+	address := viper.GetString(util.ApiAddress)
+	viper.Set(util.ApiAddress, stub.URL)
+	resetBreakers()
+	return func() {
+		viper.Set(util.ApiAddress, address)
+		stub.Close()
+		resetBreakers()
+	}
+}
+
+func routeKey(source string, destination string) string {
+	return source + "|" + destination
 }
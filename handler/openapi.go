@@ -0,0 +1,1134 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// openAPISpec is the OpenAPI 3 specification of the health and compute-route APIs. It is kept in sync with the models by the conformance
+// tests, which validate the responses of the handlers against it.
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "merc-benz-route-checker",
+    "version": "1.0.0",
+    "description": "Checks if an electric vehicle can reach its destination with its current charge and plans the minimum number of charging stops on the way."
+  },
+  "servers": [
+    {
+      "url": "/api"
+    }
+  ],
+  "paths": {
+    "/health": {
+      "get": {
+        "operationId": "healthCheck",
+        "summary": "Health check",
+        "responses": {
+          "200": {
+            "description": "The service is up.",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Health"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          },
+          "503": {
+            "description": "The service is draining before it shuts down.",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Health"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    "/health/live": {
+      "get": {
+        "operationId": "liveness",
+        "summary": "Liveness probe",
+        "description": "Responds while the service serves requests. The dependencies are not checked.",
+        "responses": {
+          "200": {
+            "description": "The service is alive.",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Health"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    "/health/ready": {
+      "get": {
+        "operationId": "readiness",
+        "summary": "Readiness probe",
+        "description": "Reports the upstream endpoints, their circuit breakers and the log and metric shippers. The checks are cached and bounded by a timeout. The service is not ready when a critical component is down or while it drains.",
+        "responses": {
+          "200": {
+            "description": "The service is ready, possibly degraded by a component that is not critical.",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Readiness"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          },
+          "503": {
+            "description": "A critical component is down or the service is draining.",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Readiness"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    "/v1/compute-route": {
+      "post": {
+        "operationId": "computeRoute",
+        "summary": "Compute the route with the minimum number of charging stops",
+        "description": "Failures are responded with status 200 and the error 8888 when the destination is unreachable, also within the maximum stops of the preferences, or 9999 for a technical exception. Requires the compute-route scope when authentication is enabled.",
+        "parameters": [
+          {
+            "name": "Idempotency-Key",
+            "in": "header",
+            "required": false,
+            "description": "Repeated requests with the same key and body get the first response, marked with the Idempotent-Replayed header. A key reused with a different body is rejected with status 409.",
+            "schema": {
+              "type": "string",
+              "maxLength": 255
+            }
+          },
+          {
+            "name": "X-Tenant-Id",
+            "in": "header",
+            "required": false,
+            "description": "Tenant to serve the request as, when the client doesn't belong to a tenant. The requests without a tenant are served with the global settings.",
+            "schema": {
+              "type": "string",
+              "pattern": "^[A-Za-z0-9_-]+$"
+            }
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/Request"
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "The computed route, or the error that prevented it.",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Response"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "The request is malformed or invalid, or the tenant is unknown. A malformed body is responded with the text 'invalid request'.",
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            },
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/InvalidRequest"
+                }
+              },
+              "text/plain": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "401": {
+            "description": "The credentials are missing or invalid.",
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            },
+            "content": {
+              "text/plain": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "403": {
+            "description": "The client is not granted the compute-route scope, or belongs to another tenant than the one in X-Tenant-Id.",
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            },
+            "content": {
+              "text/plain": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "409": {
+            "description": "The idempotency key is reused with a different request or its request is in progress.",
+            "content": {
+              "text/plain": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          },
+          "413": {
+            "description": "The request body is larger than MAX_BODY_BYTES.",
+            "content": {
+              "text/plain": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          },
+          "429": {
+            "description": "The request exceeds a configured rate limit.",
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              },
+              "Retry-After": {
+                "description": "Seconds to wait before retrying.",
+                "schema": {
+                  "type": "integer"
+                }
+              }
+            },
+            "content": {
+              "text/plain": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "503": {
+            "description": "The service is overloaded and sheds the request.",
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            },
+            "content": {
+              "text/plain": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          }
+        },
+        "security": [
+          {
+            "apiKey": []
+          },
+          {
+            "bearer": []
+          }
+        ]
+      }
+    },
+    "/v2/compute-route": {
+      "post": {
+        "operationId": "computeRouteV2",
+        "summary": "Compute the route with the minimum number of charging stops",
+        "description": "Failures are responded with their HTTP status as RFC 7807 problem details. Requires the compute-route scope when authentication is enabled.",
+        "parameters": [
+          {
+            "name": "Idempotency-Key",
+            "in": "header",
+            "required": false,
+            "description": "Repeated requests with the same key and body get the first response, marked with the Idempotent-Replayed header. A key reused with a different body is rejected with status 409.",
+            "schema": {
+              "type": "string",
+              "maxLength": 255
+            }
+          },
+          {
+            "name": "X-Tenant-Id",
+            "in": "header",
+            "required": false,
+            "description": "Tenant to serve the request as, when the client doesn't belong to a tenant. The requests without a tenant are served with the global settings.",
+            "schema": {
+              "type": "string",
+              "pattern": "^[A-Za-z0-9_-]+$"
+            }
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/Request"
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "The computed route.",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Response"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "The request is malformed or invalid, or the tenant is unknown ('invalid-request').",
+            "content": {
+              "application/problem+json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Problem"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          },
+          "401": {
+            "description": "The credentials are missing or invalid ('unauthorized').",
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            },
+            "content": {
+              "application/problem+json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Problem"
+                }
+              }
+            }
+          },
+          "403": {
+            "description": "The client is not granted the compute-route scope, or belongs to another tenant than the one in X-Tenant-Id ('forbidden').",
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            },
+            "content": {
+              "application/problem+json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Problem"
+                }
+              }
+            }
+          },
+          "409": {
+            "description": "The idempotency key is reused with a different request or its request is in progress ('idempotency-conflict').",
+            "content": {
+              "application/problem+json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Problem"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          },
+          "413": {
+            "description": "The request body is larger than MAX_BODY_BYTES ('payload-too-large').",
+            "content": {
+              "application/problem+json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Problem"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          },
+          "422": {
+            "description": "The VIN is invalid ('invalid-vin'), a location is unknown ('unknown-location'), the destination is unreachable ('unreachable') or unreachable within the maximum stops ('too-many-stops').",
+            "content": {
+              "application/problem+json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Problem"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          },
+          "429": {
+            "description": "The request exceeds a configured rate limit ('rate-limited').",
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              },
+              "Retry-After": {
+                "description": "Seconds to wait before retrying.",
+                "schema": {
+                  "type": "integer"
+                }
+              }
+            },
+            "content": {
+              "application/problem+json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Problem"
+                }
+              }
+            }
+          },
+          "500": {
+            "description": "Technical exception ('internal-error').",
+            "content": {
+              "application/problem+json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Problem"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          },
+          "502": {
+            "description": "An upstream endpoint failed ('upstream-<endpoint>-failure').",
+            "content": {
+              "application/problem+json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Problem"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          },
+          "503": {
+            "description": "The service is overloaded and sheds the request ('overloaded').",
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            },
+            "content": {
+              "application/problem+json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Problem"
+                }
+              }
+            }
+          },
+          "504": {
+            "description": "An upstream endpoint timed out ('upstream-timeout').",
+            "content": {
+              "application/problem+json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Problem"
+                }
+              }
+            },
+            "headers": {
+              "X-Transaction-Id": {
+                "description": "Transaction ID of the request.",
+                "schema": {
+                  "type": "integer",
+                  "format": "int64"
+                }
+              }
+            }
+          }
+        },
+        "security": [
+          {
+            "apiKey": []
+          },
+          {
+            "bearer": []
+          }
+        ]
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Health": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": [
+          "status"
+        ],
+        "properties": {
+          "status": {
+            "type": "string"
+          }
+        }
+      },
+      "Request": {
+        "type": "object",
+        "required": [
+          "vin",
+          "source",
+          "destination"
+        ],
+        "properties": {
+          "vin": {
+            "type": "string",
+            "minLength": 11,
+            "maxLength": 17,
+            "pattern": "^[A-HJ-NPR-Z0-9]+$",
+            "description": "Vehicle identification number. The check digit is verified for the 17 character VINs starting with 1 to 5."
+          },
+          "source": {
+            "type": "string",
+            "maxLength": 100
+          },
+          "destination": {
+            "type": "string",
+            "maxLength": 100,
+            "description": "Should be different from the source."
+          },
+          "stationOrder": {
+            "type": "string",
+            "enum": [
+              "name",
+              "driving"
+            ],
+            "description": "Order of the charging stations in the response. Lexicographic order of names by default."
+          },
+          "avoidStations": {
+            "type": "array",
+            "items": {
+              "type": "string",
+              "maxLength": 100
+            }
+          },
+          "avoidOperators": {
+            "type": "array",
+            "items": {
+              "type": "string",
+              "maxLength": 100
+            }
+          },
+          "preferOperators": {
+            "type": "array",
+            "items": {
+              "type": "string",
+              "maxLength": 100
+            }
+          },
+          "maxStops": {
+            "type": "integer",
+            "minimum": 0,
+            "maximum": 50,
+            "description": "Maximum number of stops. No limit when 0."
+          }
+        }
+      },
+      "Response": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": [
+          "transactionId",
+          "vin",
+          "source",
+          "destination"
+        ],
+        "properties": {
+          "transactionId": {
+            "type": "string",
+            "format": "int64"
+          },
+          "vin": {
+            "type": "string",
+            "nullable": true
+          },
+          "source": {
+            "type": "string",
+            "nullable": true
+          },
+          "destination": {
+            "type": "string",
+            "nullable": true
+          },
+          "distance": {
+            "type": "integer",
+            "format": "int64",
+            "description": "Distance between the source and destination in miles.",
+            "nullable": true
+          },
+          "currentChargeLevel": {
+            "type": "integer",
+            "format": "int64",
+            "description": "Current charge level in percentage.",
+            "nullable": true
+          },
+          "isChargingRequired": {
+            "type": "boolean",
+            "nullable": true
+          },
+          "chargingStations": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            }
+          },
+          "stops": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/Stop"
+            }
+          },
+          "detourOverhead": {
+            "type": "integer",
+            "format": "int64",
+            "description": "Total distance travelled off the route to reach the stops.",
+            "nullable": true
+          },
+          "excludedStations": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/ExcludedStation"
+            }
+          },
+          "appliedPreferences": {
+            "$ref": "#/components/schemas/AppliedPreferences"
+          },
+          "errors": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/Error"
+            }
+          }
+        }
+      },
+      "Stop": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": [
+          "name",
+          "distance",
+          "detour",
+          "detourOverhead",
+          "charge"
+        ],
+        "properties": {
+          "name": {
+            "type": "string"
+          },
+          "distance": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "detour": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "detourOverhead": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "charge": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "maxPower": {
+            "type": "number",
+            "format": "double",
+            "description": "Maximum charging power of the station in kW, when the upstream API reports it."
+          }
+        }
+      },
+      "ExcludedStation": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": [
+          "name",
+          "reason"
+        ],
+        "properties": {
+          "name": {
+            "type": "string"
+          },
+          "reason": {
+            "type": "string"
+          }
+        }
+      },
+      "AppliedPreferences": {
+        "type": "object",
+        "additionalProperties": false,
+        "properties": {
+          "avoidedStations": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            }
+          },
+          "avoidedOperators": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            }
+          },
+          "preferredOperators": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            }
+          },
+          "preferredStops": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            }
+          },
+          "maxStops": {
+            "type": "integer"
+          },
+          "preferencesRelaxed": {
+            "type": "boolean"
+          }
+        }
+      },
+      "Error": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": [
+          "id",
+          "description"
+        ],
+        "properties": {
+          "id": {
+            "type": "integer",
+            "enum": [
+              8888,
+              9999
+            ]
+          },
+          "description": {
+            "type": "string"
+          }
+        }
+      },
+      "InvalidParam": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": [
+          "name",
+          "reason"
+        ],
+        "properties": {
+          "name": {
+            "type": "string"
+          },
+          "reason": {
+            "type": "string"
+          }
+        }
+      },
+      "InvalidRequest": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": [
+          "invalidParams"
+        ],
+        "properties": {
+          "invalidParams": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/InvalidParam"
+            }
+          }
+        }
+      },
+      "Problem": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": [
+          "type",
+          "title",
+          "status",
+          "code"
+        ],
+        "properties": {
+          "type": {
+            "type": "string"
+          },
+          "title": {
+            "type": "string"
+          },
+          "status": {
+            "type": "integer"
+          },
+          "detail": {
+            "type": "string"
+          },
+          "instance": {
+            "type": "string"
+          },
+          "code": {
+            "type": "string"
+          },
+          "transactionId": {
+            "type": "string",
+            "format": "int64"
+          },
+          "endpoint": {
+            "type": "string",
+            "enum": [
+              "charge-level",
+              "distance",
+              "charging-stations"
+            ]
+          },
+          "invalid-params": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/InvalidParam"
+            }
+          }
+        }
+      },
+      "Readiness": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": [
+          "status",
+          "components"
+        ],
+        "properties": {
+          "status": {
+            "type": "string",
+            "enum": [
+              "up",
+              "degraded",
+              "down",
+              "draining"
+            ]
+          },
+          "components": {
+            "type": "object",
+            "description": "Components by name, such as 'upstream.charge-level', 'breaker.charge-level', 'logstash' and 'statsd'.",
+            "additionalProperties": {
+              "$ref": "#/components/schemas/Component"
+            }
+          }
+        }
+      },
+      "Component": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": [
+          "status",
+          "critical",
+          "latencyMs",
+          "checkedAt"
+        ],
+        "properties": {
+          "status": {
+            "type": "string",
+            "enum": [
+              "up",
+              "down"
+            ]
+          },
+          "critical": {
+            "type": "boolean",
+            "description": "Whether the service is not ready while the component is down."
+          },
+          "error": {
+            "type": "string",
+            "description": "Why the component is down."
+          },
+          "latencyMs": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "checkedAt": {
+            "type": "string",
+            "format": "date-time",
+            "description": "Time of the check. The outcome is cached for a while."
+          }
+        }
+      }
+    },
+    "securitySchemes": {
+      "apiKey": {
+        "type": "apiKey",
+        "in": "header",
+        "name": "X-API-Key",
+        "description": "Static API key of the client."
+      },
+      "bearer": {
+        "type": "http",
+        "scheme": "bearer",
+        "bearerFormat": "JWT",
+        "description": "JWT signed by a key of the configured JWKS, with the scopes in the scope or scp claim."
+      }
+    }
+  }
+}
+`
+
+// swaggerUIAssets are the files of the Swagger UI distribution served by the service.
+var swaggerUIAssets = map[string]string{
+	"swagger-ui.css":       "text/css; charset=utf-8",
+	"swagger-ui-bundle.js": "application/javascript; charset=utf-8",
+}
+
+// swaggerUIPage renders the specification with the Swagger UI assets served by the service, so that the page doesn't load scripts from
+// a CDN.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>merc-benz-route-checker API</title>
+  <link rel="stylesheet" href="docs/assets/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="docs/assets/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = function () {
+      SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>
+`
+
+// HandleOpenAPI responds with the OpenAPI specification.
+func HandleOpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(openAPISpec))
+}
+
+// swaggerUIDir returns the directory of the Swagger UI assets, SWAGGER_UI_PATH or the swagger-ui directory under BASE_PATH, where
+// make swagger-ui and the Docker image put them.
+func swaggerUIDir() string {
+	if path := viper.GetString(util.SwaggerUIPath); path != "" {
+		return path
+	}
+	return filepath.Join(basePath(), util.DefaultSwaggerUI)
+}
+
+// HandleSwaggerUI responds with the Swagger UI page for the OpenAPI specification. It responds with 404 when the Swagger UI assets are
+// not installed, as the page can't be rendered without them.
+func HandleSwaggerUI(c *gin.Context) {
+	for file := range swaggerUIAssets {
+		if _, err := os.Stat(filepath.Join(swaggerUIDir(), file)); err != nil {
+			c.String(http.StatusNotFound, "Swagger UI is not installed. the specification is at %v", util.ApiOpenAPI)
+			return
+		}
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
+
+// HandleSwaggerAssets responds with a file of the Swagger UI distribution. Only the files of the page are served.
+func HandleSwaggerAssets(c *gin.Context) {
+	file := c.Param("file")
+	contentType, ok := swaggerUIAssets[file]
+	if !ok {
+		c.String(http.StatusNotFound, "not found")
+		return
+	}
+	content, err := ioutil.ReadFile(filepath.Join(swaggerUIDir(), file))
+	if err != nil {
+		c.String(http.StatusNotFound, "not found")
+		return
+	}
+	c.Data(http.StatusOK, contentType, content)
+}
@@ -0,0 +1,323 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/readiness"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/spf13/viper"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	req, err := http.NewRequest("GET", util.ApiBasePath+"/"+util.ApiOpenAPI, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := executeRequest(req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	spec := map[string]interface{}{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("the specification is not valid JSON: %v", err)
+	}
+	if spec["openapi"] != "3.0.3" {
+		t.Errorf("expected OpenAPI version 3.0.3 but got %v", spec["openapi"])
+	}
+
+}
+
+func TestSwaggerUI(t *testing.T) {
+	dir := filepath.Join(testDir, "swagger-ui")
+	viper.Set(util.SwaggerUIPath, dir)
+	defer viper.Set(util.SwaggerUIPath, "")
+	get := func(path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", util.ApiBasePath+"/"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return executeRequest(req)
+	}
+
+	// the page isn't served without the assets
+	if rr := get(util.ApiDocs); rr.Code != http.StatusNotFound {
+		t.Errorf("expected no Swagger UI page without the assets but got %v", rr.Code)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"swagger-ui.css", "swagger-ui-bundle.js", "index.html"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(file), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rr := get(util.ApiDocs)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "SwaggerUIBundle") || strings.Contains(rr.Body.String(), "https://") {
+		t.Errorf("expected the Swagger UI page with the local assets but got %v: %v", rr.Code, rr.Body.String())
+	}
+	rr = get("docs/assets/swagger-ui-bundle.js")
+	if rr.Code != http.StatusOK || rr.Body.String() != "swagger-ui-bundle.js" || !strings.HasPrefix(rr.Header().Get("Content-Type"), "application/javascript") {
+		t.Errorf("expected the Swagger UI bundle but got %v %v: %v", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	// only the assets of the page are served
+	for _, path := range []string{"docs/assets/index.html", "docs/assets/..%2Fswagger-ui.css"} {
+		if rr := get(path); rr.Code != http.StatusNotFound {
+			t.Errorf("expected %v not to be served but got %v", path, rr.Code)
+		}
+	}
+}
+
+// TestOpenAPIConformance validates the responses of the handlers against the specification.
+func TestOpenAPIConformance(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0080"] = 5
+	stub.chargeLevels["W1K2062161F0090"] = 80
+	spec := loadOpenAPISpec(t)
+
+	testCases := []struct {
+		name    string
+		method  string
+		path    string
+		payload string
+		status  int
+	}{
+		{"health", "GET", "/health", "", http.StatusOK},
+		{"liveness", "GET", "/health/live", "", http.StatusOK},
+		{"readiness", "GET", "/health/ready", "", http.StatusOK},
+		{"v1 charging", ReqPost, "/v1/compute-route", reqTestCase4, http.StatusOK},
+		{"v1 no charging", ReqPost, "/v1/compute-route", `{ "vin": "W1K2062161F0090", "source": "Home", "destination": "Movie Theatre" }`, http.StatusOK},
+		{"v1 unreachable", ReqPost, "/v1/compute-route", `{ "vin": "W1K2062161F0080", "source": "Home", "destination": "Movie Theatre" }`, http.StatusOK},
+		{"v1 preferences", ReqPost, "/v1/compute-route", `{ "vin": "W1K2062161F0046", "source": "Home", "destination": "Movie Theatre", "stationOrder": "driving", "avoidStations": ["S9"], "maxStops": 3 }`, http.StatusOK},
+		{"v1 invalid params", ReqPost, "/v1/compute-route", reqTestCase3, http.StatusBadRequest},
+		{"v1 malformed", ReqPost, "/v1/compute-route", `{ "vin": 1 }`, http.StatusBadRequest},
+		{"v2 success", ReqPost, "/v2/compute-route", reqTestCase4, http.StatusOK},
+		{"v2 invalid params", ReqPost, "/v2/compute-route", reqTestCase3, http.StatusBadRequest},
+		{"v2 invalid vin", ReqPost, "/v2/compute-route", `{ "vin": "W1K2062161F0099", "source": "Home", "destination": "Movie Theatre" }`, http.StatusUnprocessableEntity},
+		{"v2 unreachable", ReqPost, "/v2/compute-route", `{ "vin": "W1K2062161F0080", "source": "Home", "destination": "Movie Theatre" }`, http.StatusUnprocessableEntity},
+	}
+	for _, testCase := range testCases {
+		req, err := http.NewRequest(testCase.method, util.ApiBasePath+testCase.path, bytes.NewBufferString(testCase.payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := executeRequest(req)
+		if rr.Code != testCase.status {
+			t.Errorf("%v: handler returned wrong status code: got %v want %v", testCase.name, rr.Code, testCase.status)
+			continue
+		}
+		for _, err := range spec.validateResponse(testCase.method, testCase.path, rr) {
+			t.Errorf("%v: %v", testCase.name, err)
+		}
+	}
+
+	// the upstream API is unreachable once the stub is closed
+	stub.Close()
+	rr := executeV2Request(t, reqTestCase4)
+	if rr.Code != http.StatusBadGateway {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadGateway)
+	}
+	for _, err := range spec.validateResponse(ReqPost, "/v2/compute-route", rr) {
+		t.Errorf("v2 upstream failure: %v", err)
+	}
+}
+
+// TestOpenAPIModels checks that the specification has every field of the response models, so that a new field can't be left out of it.
+func TestOpenAPIModels(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	models := map[string]interface{}{
+		"Response":           model.Response{},
+		"Stop":               model.ResStop{},
+		"ExcludedStation":    model.ResExcludedStation{},
+		"AppliedPreferences": model.ResPreferences{},
+		"Error":              model.ResError{},
+		"Problem":            model.Problem{},
+		"InvalidParam":       model.InvalidParam{},
+		"InvalidRequest":     model.ResInvalidRequest{},
+		"Request":            model.Request{},
+		"Readiness":          readiness.Report{},
+		"Component":          readiness.Component{},
+	}
+	for name, value := range models {
+		properties, _ := spec.schema(name)["properties"].(map[string]interface{})
+		fields := jsonFields(reflect.TypeOf(value))
+		for _, field := range fields {
+			if _, ok := properties[field]; !ok {
+				t.Errorf("schema %v is missing the field %v", name, field)
+			}
+		}
+		if len(properties) != len(fields) {
+			t.Errorf("schema %v has properties %v but the model has fields %v", name, sortedKeys(properties), fields)
+		}
+	}
+}
+
+// jsonFields returns the JSON names of the fields of the struct type, including the fields of its embedded structs.
+func jsonFields(structType reflect.Type) []string {
+	var fields []string
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.Anonymous {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// openAPIDoc is the decoded specification with a minimal schema validator, covering the keywords the specification uses.
+type openAPIDoc map[string]interface{}
+
+func loadOpenAPISpec(t *testing.T) openAPIDoc {
+	spec := openAPIDoc{}
+	if err := json.Unmarshal([]byte(openAPISpec), &spec); err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// object returns the object at the path in the specification, or nil if there is none.
+func (spec openAPIDoc) object(path ...string) map[string]interface{} {
+	current := map[string]interface{}(spec)
+	for _, key := range path {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+func (spec openAPIDoc) schema(name string) map[string]interface{} {
+	return spec.object("components", "schemas", name)
+}
+
+// validateResponse validates the recorded response against the schema of its status and content type for the operation.
+func (spec openAPIDoc) validateResponse(method string, path string, rr *httptest.ResponseRecorder) []error {
+	mediaType, _, err := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+	if err != nil {
+		return []error{fmt.Errorf("invalid content type: %v", err)}
+	}
+	content := spec.object("paths", path, strings.ToLower(method), "responses", fmt.Sprint(rr.Code), "content", mediaType)
+	if content == nil {
+		return []error{fmt.Errorf("status %v with content type %v is not specified for %v %v", rr.Code, mediaType, method, path)}
+	}
+	schema, _ := content["schema"].(map[string]interface{})
+	if mediaType == "text/plain" {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(rr.Body.Bytes()))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return []error{fmt.Errorf("invalid JSON body: %v", err)}
+	}
+	return spec.validate(schema, body, "body")
+}
+
+// validate validates the value against the schema. It supports $ref, type, nullable, enum, properties, required,
+// additionalProperties and items.
+func (spec openAPIDoc) validate(schema map[string]interface{}, value interface{}, at string) []error {
+	if ref, ok := schema["$ref"].(string); ok {
+		return spec.validate(spec.schema(strings.TrimPrefix(ref, "#/components/schemas/")), value, at)
+	}
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); !nullable {
+			return []error{fmt.Errorf("%v is null", at)}
+		}
+		return nil
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !inEnum(enum, value) {
+		return []error{fmt.Errorf("%v is %v, which is not one of %v", at, value, enum)}
+	}
+
+	var errs []error
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []error{fmt.Errorf("%v is not an object", at)}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				errs = append(errs, fmt.Errorf("%v is missing the required property %v", at, name))
+			}
+		}
+		for name, property := range object {
+			propertySchema, ok := properties[name].(map[string]interface{})
+			if !ok {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					errs = append(errs, fmt.Errorf("%v has the unspecified property %v", at, name))
+				} else if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+					errs = append(errs, spec.validate(additional, property, at+"."+name)...)
+				}
+				continue
+			}
+			errs = append(errs, spec.validate(propertySchema, property, at+"."+name)...)
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []error{fmt.Errorf("%v is not an array", at)}
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			errs = append(errs, spec.validate(items, item, fmt.Sprintf("%v[%v]", at, i))...)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			errs = append(errs, fmt.Errorf("%v is not a string", at))
+		}
+	case "integer":
+		if number, ok := value.(json.Number); !ok {
+			errs = append(errs, fmt.Errorf("%v is not an integer", at))
+		} else if _, err := number.Int64(); err != nil {
+			errs = append(errs, fmt.Errorf("%v is not an integer", at))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs = append(errs, fmt.Errorf("%v is not a boolean", at))
+		}
+	}
+	return errs
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
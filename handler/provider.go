@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/SDJLee/mercedes-benz/model"
+)
+
+// provider retrieves the charge level, travel distance and charging stations needed to compute the travel.
+type provider interface {
+	ChargeLevel(ctx context.Context, req *model.ReqChargeLevel) (*model.ResChargeLevel, error)
+	TravelDistance(ctx context.Context, req *model.ReqTravelDistance) (*model.ResTravelDistance, error)
+	ChargingStations(ctx context.Context, req *model.ReqChargeStations) (*model.ResChargeStations, error)
+}
+
+// apiProvider is the provider that calls the upstream API of the tenant for every request.
+type apiProvider struct {
+	tenant *tenant
+}
+
+func (p apiProvider) ChargeLevel(ctx context.Context, req *model.ReqChargeLevel) (*model.ResChargeLevel, error) {
+	return GetChargeLevel(ctx, p.tenant, req)
+}
+
+func (p apiProvider) TravelDistance(ctx context.Context, req *model.ReqTravelDistance) (*model.ResTravelDistance, error) {
+	return GetTravelDistance(ctx, p.tenant, req)
+}
+
+func (p apiProvider) ChargingStations(ctx context.Context, req *model.ReqChargeStations) (*model.ResChargeStations, error) {
+	return GetChargingStations(ctx, p.tenant, req)
+}
+
+// cachingProvider wraps a provider and shares the upstream responses between requests with the same payload. Concurrent requests with
+// the same payload wait for the first one to complete, so the upstream API is called once per payload. Errors are shared as well.
+// The cache lives as long as the cachingProvider, which is the lifetime of a batch.
+type cachingProvider struct {
+	next    provider
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newCachingProvider(next provider) *cachingProvider {
+	return &cachingProvider{
+		next:    next,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+func (p *cachingProvider) ChargeLevel(ctx context.Context, req *model.ReqChargeLevel) (*model.ResChargeLevel, error) {
+	value, err := p.load("chargelevel", req, func() (interface{}, error) {
+		return p.next.ChargeLevel(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*model.ResChargeLevel), nil
+}
+
+func (p *cachingProvider) TravelDistance(ctx context.Context, req *model.ReqTravelDistance) (*model.ResTravelDistance, error) {
+	value, err := p.load("traveldistance", req, func() (interface{}, error) {
+		return p.next.TravelDistance(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*model.ResTravelDistance), nil
+}
+
+func (p *cachingProvider) ChargingStations(ctx context.Context, req *model.ReqChargeStations) (*model.ResChargeStations, error) {
+	value, err := p.load("chargestation", req, func() (interface{}, error) {
+		return p.next.ChargingStations(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*model.ResChargeStations), nil
+}
+
+// load returns the cached value for the endpoint and request payload. The value is fetched with fetch on the first call.
+func (p *cachingProvider) load(endpoint string, req interface{}, fetch func() (interface{}, error)) (interface{}, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	key := endpoint + ":" + string(payload)
+
+	p.mu.Lock()
+	entry, ok := p.entries[key]
+	if !ok {
+		entry = &cacheEntry{done: make(chan struct{})}
+		p.entries[key] = entry
+	}
+	p.mu.Unlock()
+
+	if ok {
+		<-entry.done
+		return entry.value, entry.err
+	}
+	entry.value, entry.err = fetch()
+	close(entry.done)
+	return entry.value, entry.err
+}
+
+// recordingProvider wraps a provider and keeps the upstream responses in the plan record, so that the plan history has the inputs of the plan.
+type recordingProvider struct {
+	next   provider
+	record *model.PlanRecord
+}
+
+func (p *recordingProvider) ChargeLevel(ctx context.Context, req *model.ReqChargeLevel) (*model.ResChargeLevel, error) {
+	res, err := p.next.ChargeLevel(ctx, req)
+	p.record.ChargeLevel = res
+	return res, err
+}
+
+func (p *recordingProvider) TravelDistance(ctx context.Context, req *model.ReqTravelDistance) (*model.ResTravelDistance, error) {
+	res, err := p.next.TravelDistance(ctx, req)
+	p.record.Distance = res
+	return res, err
+}
+
+func (p *recordingProvider) ChargingStations(ctx context.Context, req *model.ReqChargeStations) (*model.ResChargeStations, error) {
+	res, err := p.next.ChargingStations(ctx, req)
+	p.record.Stations = res
+	return res, err
+}
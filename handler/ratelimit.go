@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/ratelimit"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+)
+
+// rateRule limits the requests to a route by a key, which is the client, the VIN or the IP of the request.
+type rateRule struct {
+	key   string
+	limit ratelimit.Limit
+	// describe is the limit as configured, such as 10/s
+	describe string
+}
+
+var rateLimiting struct {
+	once    sync.Once
+	limiter ratelimit.Limiter
+	rules   map[string][]*rateRule
+}
+
+var rateUnits = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+// trustedProxies are the networks of the proxies whose X-Forwarded-For header is trusted for the IP of the client. There are none by
+// default, so that a client can't choose its IP bucket by sending the header.
+var trustedProxies []*net.IPNet
+
+// setTrustedProxies trusts the proxies of the config, a comma-separated list of IPs and CIDRs. An invalid config trusts none.
+func setTrustedProxies(config string) {
+	var networks []*net.IPNet
+	for _, proxy := range strings.Split(config, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			logger.Errorf("invalid trusted proxy %q. no proxy is trusted. %v", proxy, err)
+			trustedProxies = nil
+			return
+		}
+		networks = append(networks, network)
+	}
+	trustedProxies = networks
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestIP returns the IP of the client of the request. It is the remote address, unless the request comes through trusted proxies,
+// in which case it is the last address of the X-Forwarded-For header that is not a trusted proxy.
+func requestIP(c *gin.Context) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		return ""
+	}
+	remote := net.ParseIP(host)
+	if remote == nil {
+		return ""
+	}
+	if !isTrustedProxy(remote) {
+		return remote.String()
+	}
+	forwarded := strings.Split(strings.Join(c.Request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return ip.String()
+		}
+	}
+	return remote.String()
+}
+
+// getRateLimiter returns the limiter of the configured backend and the configured rules by route. The limiter is nil when neither the
+// global config nor a tenant has rules, or the config is invalid, in which case the requests are not limited.
+func getRateLimiter() (ratelimit.Limiter, map[string][]*rateRule) {
+	rateLimiting.once.Do(func() {
+		rules, err := parseRateLimits(viper.GetString(util.RateLimits))
+		if err != nil {
+			logger.Error("invalid rate limits. rate limiting is disabled", err)
+			return
+		}
+		if len(rules) == 0 && !tenantRateLimits() {
+			return
+		}
+		limiter, err := newRateLimiter()
+		if err != nil {
+			logger.Error("invalid rate limit backend. rate limiting is disabled", err)
+			return
+		}
+		rateLimiting.limiter, rateLimiting.rules = limiter, rules
+	})
+	return rateLimiting.limiter, rateLimiting.rules
+}
+
+// tenantRateLimits reports whether a tenant has its own rate limits.
+func tenantRateLimits() bool {
+	tenants, _ := getTenants()
+	for _, t := range tenants.byId {
+		if len(t.rules) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newRateLimiter returns the limiter of the configured backend. The memory backend is the default. The redis backend shares the limits
+// across the replicas through the Redis-compatible server at RATE_LIMIT_REDIS_URL.
+func newRateLimiter() (ratelimit.Limiter, error) {
+	switch backend := viper.GetString(util.RateLimitBackend); backend {
+	case util.RateLimitMemory, "":
+		return ratelimit.NewMemory(), nil
+	case util.RateLimitRedis:
+		options, err := redis.ParseURL(viper.GetString(util.RateLimitRedisUrl))
+		if err != nil {
+			return nil, err
+		}
+		return ratelimit.NewRedis(redis.NewClient(options), util.RateLimitPrefix), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", backend)
+	}
+}
+
+// parseRateLimits parses the rules separated by ";" in the "route:key=count/unit[:burst]" format, such as
+// "compute-route:client=10/s:20;compute-route:vin=6/m". The unit is s, m or h, and the burst is the count when it is not set.
+func parseRateLimits(config string) (map[string][]*rateRule, error) {
+	routes := map[string]bool{util.RouteComputeRoute: true, util.RouteBatch: true, util.RouteStream: true, util.RouteJobs: true,
+		util.RoutePlans: true}
+	keys := map[string]bool{util.LimitByClient: true, util.LimitByVin: true, util.LimitByIp: true}
+	rules := make(map[string][]*rateRule)
+	for _, config := range strings.Split(config, ";") {
+		config = strings.TrimSpace(config)
+		if config == "" {
+			continue
+		}
+		invalid := fmt.Errorf("invalid rate limit %q. expected route:key=count/unit[:burst]", config)
+		parts := strings.SplitN(config, ":", 2)
+		if len(parts) != 2 {
+			return nil, invalid
+		}
+		route, rule := parts[0], parts[1]
+		if !routes[route] {
+			return nil, fmt.Errorf("unknown route %q in rate limit %q", route, config)
+		}
+		parts = strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			return nil, invalid
+		}
+		key, rate := parts[0], parts[1]
+		if !keys[key] {
+			return nil, fmt.Errorf("unknown key %q in rate limit %q", key, config)
+		}
+		parts = strings.SplitN(rate, ":", 2)
+		count, unit := 0, ""
+		if n, err := fmt.Sscanf(parts[0], "%d/%s", &count, &unit); err != nil || n != 2 || count <= 0 || rateUnits[unit] == 0 {
+			return nil, invalid
+		}
+		burst := count
+		if len(parts) == 2 {
+			var err error
+			if burst, err = strconv.Atoi(parts[1]); err != nil || burst <= 0 {
+				return nil, invalid
+			}
+		}
+		rules[route] = append(rules[route], &rateRule{
+			key:      key,
+			limit:    ratelimit.Limit{Rate: float64(count) / rateUnits[unit].Seconds(), Burst: burst},
+			describe: parts[0],
+		})
+	}
+	return rules, nil
+}
+
+// rateLimit takes a token for the request from the bucket of each rule of the route of the tenant. keys has the client, the VIN and the
+// IP of the request, if known. Each rule has its own buckets, so that the rules of a route by the same key, such as a rate per second
+// and a rate per hour, are tiers of the limit. The buckets of a tenant are its own, even when it has the global rules. The requests of
+// an unauthenticated client are limited by IP for the client rules. Errors of the limiter are logged and the request is allowed, so that
+// an outage of the backend doesn't take the API down.
+func rateLimit(ctx context.Context, route string, keys map[string]string) *travelError {
+	limiter, rules := getRateLimiter()
+	if limiter == nil {
+		return nil
+	}
+	t := tenantFrom(ctx)
+	rules = t.rateRules(rules)
+	if keys[util.LimitByClient] == "" && keys[util.LimitByIp] != "" {
+		keys[util.LimitByClient] = util.LimitByIp + ":" + keys[util.LimitByIp]
+	}
+	for i, rule := range rules[route] {
+		value := keys[rule.key]
+		if value == "" {
+			continue
+		}
+		bucket := fmt.Sprintf("%v:%v:%v:%v", route, i, rule.key, value)
+		result, err := limiter.Allow(ctx, t.namespace(bucket), rule.limit)
+		if err != nil {
+			requestLogger(ctx).Error("failed to check rate limit. allowing the request", err)
+			continue
+		}
+		if !result.Allowed {
+			t.stats.StatCount(fmt.Sprintf("counters.ratelimit.%v.%v", route, rule.key), 1)
+			return &travelError{
+				code:       util.ErrCodeRateLimited,
+				err:        fmt.Errorf("rate limit of %v per %v exceeded", rule.describe, rule.key),
+				retryAfter: result.RetryAfter,
+			}
+		}
+	}
+	return nil
+}
+
+// RateLimitMiddleware limits the requests to the route by the configured rules. The rate limited requests are responded by reject
+// with the Retry-After header in seconds. It should come after AuthMiddleware and TenantMiddleware, so that the requests are limited by
+// the client and the tenant.
+func RateLimitMiddleware(route string, reject func(c *gin.Context, failure *travelError)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, rules := getRateLimiter()
+		rules = tenantFrom(c.Request.Context()).rateRules(rules)
+		if len(rules[route]) == 0 {
+			c.Next()
+			return
+		}
+		keys := map[string]string{util.LimitByClient: clientId(c), util.LimitByIp: requestIP(c)}
+		for _, rule := range rules[route] {
+			if rule.key == util.LimitByVin {
+				vin, err := requestVin(c)
+				if err == errBodyTooLarge {
+					reject(c, &travelError{code: util.ErrCodeTooLarge, err: err})
+					c.Abort()
+					return
+				}
+				keys[util.LimitByVin] = vin
+				break
+			}
+		}
+		if failure := rateLimit(c.Request.Context(), route, keys); failure != nil {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(failure.retryAfter.Seconds()))))
+			reject(c, failure)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// requestVin returns the VIN of the request body, if any. The body is left to be read by the handler. The VIN of a malformed body
+// is empty, as the handler rejects the body anyway. A body larger than MAX_BODY_BYTES fails with errBodyTooLarge.
+func requestVin(c *gin.Context) (string, error) {
+	body, err := readBody(c)
+	if err != nil {
+		return "", err
+	}
+	var request struct {
+		Vin string `json:"vin"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return "", nil
+	}
+	return request.Vin, nil
+}
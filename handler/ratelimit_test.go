@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SDJLee/mercedes-benz/ratelimit"
+	"github.com/SDJLee/mercedes-benz/routepb"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// useRateLimits limits the requests with the limiter and the rules of the config. It returns a function that removes the limits.
+func useRateLimits(t *testing.T, limiter ratelimit.Limiter, config string) func() {
+	rules, err := parseRateLimits(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rateLimiting.once = sync.Once{}
+	rateLimiting.once.Do(func() {})
+	rateLimiting.limiter, rateLimiting.rules = limiter, rules
+	return func() {
+		rateLimiting.once = sync.Once{}
+		rateLimiting.limiter, rateLimiting.rules = nil, nil
+	}
+}
+
+// executeFromIP computes the route for the VIN from the IP with the v1 or v2 API.
+func executeFromIP(t *testing.T, api string, vin string, ip string) *httptest.ResponseRecorder {
+	payload := fmt.Sprintf(`{ "vin": "%v", "source": "Home", "destination": "Movie Theatre" }`, vin)
+	req, err := http.NewRequest(ReqPost, util.ApiBasePath+api+util.ApiComputeRoute, bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = ip + ":40000"
+	return executeRequest(req)
+}
+
+func TestRateLimitByClient(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	defer useRateLimits(t, ratelimit.NewMemory(), "compute-route:client=2/m")()
+
+	for i := 0; i < 2; i++ {
+		if rr := executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.1"); rr.Code != http.StatusOK {
+			t.Fatalf("request %v should be allowed but got %v", i, rr.Code)
+		}
+	}
+	rr := executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.1")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "30" {
+		t.Errorf("expected to retry after 30 seconds but got %q", retryAfter)
+	}
+
+	// v2 shares the limits of the route and responds with the problem details
+	rr = executeFromIP(t, util.ApiV2, "W1K2062161F0046", "10.0.0.1")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	assertProblem(t, "v2 rate limited", rr, util.ErrCodeRateLimited)
+
+	// unauthenticated clients are limited by IP
+	if rr := executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.2"); rr.Code != http.StatusOK {
+		t.Errorf("requests from another IP should be allowed but got %v", rr.Code)
+	}
+}
+
+func TestRateLimitByVin(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	defer useRateLimits(t, ratelimit.NewMemory(), "compute-route:vin=1/h")()
+
+	if rr := executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.1"); rr.Code != http.StatusOK {
+		t.Fatalf("first request should be allowed but got %v", rr.Code)
+	}
+	rr := executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.2")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "3600" {
+		t.Errorf("second request of the VIN should be limited for an hour but got %v with Retry-After %q", rr.Code,
+			rr.Header().Get("Retry-After"))
+	}
+	if rr := executeFromIP(t, util.ApiV1, "W1K2062161F0047", "10.0.0.1"); rr.Code != http.StatusOK {
+		t.Errorf("requests of another VIN should be allowed but got %v", rr.Code)
+	}
+}
+
+func TestRateLimitTiers(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	defer useRateLimits(t, ratelimit.NewMemory(), "compute-route:ip=2/m;compute-route:ip=3/h")()
+
+	// each request takes a token from both tiers, which have their own buckets
+	for i := 0; i < 2; i++ {
+		if rr := executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.1"); rr.Code != http.StatusOK {
+			t.Fatalf("request %v should be allowed but got %v", i, rr.Code)
+		}
+	}
+	rr := executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.1")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "30" {
+		t.Errorf("third request should be limited by the rate per minute but got %v with Retry-After %q", rr.Code,
+			rr.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rr.Body.String(), "2/m") {
+		t.Errorf("expected the rate per minute to be exceeded but got %q", rr.Body.String())
+	}
+}
+
+func TestRateLimitTrustedProxies(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	defer useRateLimits(t, ratelimit.NewMemory(), "compute-route:ip=1/h")()
+	execute := func(remoteIp string, forwardedFor string) int {
+		req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiComputeRoute), bytes.NewBufferString(tenantPayload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = remoteIp + ":40000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		return executeRequest(req).Code
+	}
+
+	// the header of a client that is not a trusted proxy is ignored
+	if code := execute("10.0.0.1", "192.0.2.1"); code != http.StatusOK {
+		t.Fatalf("first request should be allowed but got %v", code)
+	}
+	if code := execute("10.0.0.1", "192.0.2.2"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the forwarded IP of an untrusted client to be ignored but got %v", code)
+	}
+
+	// the client is the last address that is not a trusted proxy, as the first ones can be sent by the client
+	setTrustedProxies("10.0.0.0/8, 172.16.0.10")
+	defer setTrustedProxies("")
+	if code := execute("10.0.0.5", "198.51.100.1, 192.0.2.10, 172.16.0.10"); code != http.StatusOK {
+		t.Fatalf("first request through the proxies should be allowed but got %v", code)
+	}
+	if code := execute("10.0.0.6", "198.51.100.2, 192.0.2.10"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the client to be limited by its forwarded IP but got %v", code)
+	}
+	if code := execute("10.0.0.5", "192.0.2.11"); code != http.StatusOK {
+		t.Errorf("expected another forwarded IP to be allowed but got %v", code)
+	}
+}
+
+func TestRateLimitBodySize(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	defer useRateLimits(t, ratelimit.NewMemory(), "compute-route:vin=10/m")()
+	viper.Set(util.MaxBodyBytes, 128)
+	defer viper.Set(util.MaxBodyBytes, 0)
+
+	payload := `{ "vin": "W1K2062161F0046", "source": "Home", "destination": "` + strings.Repeat("x", 128) + `" }`
+	req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiComputeRoute), bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := executeRequest(req); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+	if calls := stub.callCount("charge_level"); calls != 0 {
+		t.Errorf("expected the large request not to be computed but got %v calls", calls)
+	}
+	// the body within the limit is left to the handler
+	if rr := executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.1"); rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimitRedis(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	defer client.Close()
+	defer useRateLimits(t, ratelimit.NewRedis(client, util.RateLimitPrefix), "compute-route:ip=1/s:2")()
+
+	for i := 0; i < 2; i++ {
+		if rr := executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.1"); rr.Code != http.StatusOK {
+			t.Fatalf("request %v should be allowed but got %v", i, rr.Code)
+		}
+	}
+	rr := executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.1")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("third request should be limited for a second but got %v with Retry-After %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if !server.Exists(util.RateLimitPrefix + "compute-route:0:ip:10.0.0.1") {
+		t.Errorf("expected the bucket in redis but got keys %v", server.Keys())
+	}
+
+	// the requests are allowed when redis is down
+	server.Close()
+	if rr := executeFromIP(t, util.ApiV1, "W1K2062161F0046", "10.0.0.1"); rr.Code != http.StatusOK {
+		t.Errorf("requests should be allowed when redis is down but got %v", rr.Code)
+	}
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	defer useRateLimits(t, ratelimit.NewMemory(), "compute-route:vin=1/m")()
+	conn, closeConn := dialGRPC(t)
+	defer closeConn()
+	client := routepb.NewRouteCheckerClient(conn)
+	req := &routepb.ComputeRouteRequest{Vin: "W1K2062161F0046", Source: "Home", Destination: "Movie Theatre"}
+
+	if _, err := client.ComputeRoute(context.Background(), req); err != nil {
+		t.Fatalf("first call should be allowed but got %v", err)
+	}
+	_, err := client.ComputeRoute(context.Background(), req)
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("expected code %v but got %v", codes.ResourceExhausted, err)
+	}
+	for _, detail := range st.Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok {
+			if delay := retryInfo.GetRetryDelay().AsDuration().Seconds(); delay <= 0 || delay > 60 {
+				t.Errorf("expected to retry within a minute but got %v seconds", delay)
+			}
+			return
+		}
+	}
+	t.Errorf("expected RetryInfo in the details but got %v", st.Details())
+}
+
+func TestParseRateLimits(t *testing.T) {
+	rules, err := parseRateLimits("compute-route:client=10/s:20; compute-route:vin=6/m ;batch:ip=1/h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]ratelimit.Limit{
+		util.RouteComputeRoute: {{Rate: 10, Burst: 20}, {Rate: 0.1, Burst: 6}},
+		util.RouteBatch:        {{Rate: 1.0 / 3600, Burst: 1}},
+	}
+	for route, limits := range expected {
+		if len(rules[route]) != len(limits) {
+			t.Fatalf("expected %v rules for %v but got %v", len(limits), route, len(rules[route]))
+		}
+		for i, limit := range limits {
+			if rules[route][i].limit != limit {
+				t.Errorf("expected limit %v for %v but got %v", limit, route, rules[route][i].limit)
+			}
+		}
+	}
+
+	for _, config := range []string{"compute-route", "unknown:client=1/s", "compute-route:user=1/s", "compute-route:client=0/s",
+		"compute-route:client=1/d", "compute-route:client=1/s:0", "compute-route:client=x/s"} {
+		if _, err := parseRateLimits(config); err == nil {
+			t.Errorf("expected %q to be invalid", config)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/breaker"
+	log "github.com/SDJLee/mercedes-benz/logger"
+	"github.com/SDJLee/mercedes-benz/metrics"
+	"github.com/SDJLee/mercedes-benz/readiness"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+)
+
+var readinessChecks struct {
+	once    sync.Once
+	checker *readiness.Checker
+}
+
+// getReadiness returns the checks of the readiness probe. Every upstream endpoint is probed and its circuit breaker checked. The
+// upstream endpoints of the tenants are checked as well, and they don't make the service not ready, as the other tenants are served
+// without them. Neither do the log shipper and statsd, which are checked when they are configured.
+func getReadiness() *readiness.Checker {
+	readinessChecks.once.Do(func() {
+		checker := readiness.New(time.Duration(configInt(util.ReadinessCacheMs, util.DefaultReadyCache))*time.Millisecond,
+			time.Duration(configInt(util.ReadinessTimeoutMs, util.DefaultReadyWait))*time.Millisecond)
+		for endpoint := range upstreamPaths {
+			checker.Register("upstream."+endpoint, true, probeUpstream(defaultTenant, endpoint))
+			checker.Register("breaker."+endpoint, true, checkBreaker(defaultTenant, endpoint))
+		}
+		tenants, _ := getTenants()
+		for _, t := range tenants.byId {
+			for endpoint := range upstreamPaths {
+				checker.Register("upstream."+t.id+"."+endpoint, false, probeUpstream(t, endpoint))
+				checker.Register("breaker."+t.id+"."+endpoint, false, checkBreaker(t, endpoint))
+			}
+		}
+		if os.Getenv(util.ShipLogs) == "true" {
+			checker.Register("logstash", false, log.CheckShipper)
+		}
+		if os.Getenv(util.GraphiteUrl) != "" {
+			checker.Register("statsd", false, metrics.Check)
+		}
+		readinessChecks.checker = checker
+	})
+	return readinessChecks.checker
+}
+
+// RegisterReadinessCheck adds the check of a component to the readiness probe. A critical component that is down makes the service not
+// ready, while the others only degrade it.
+func RegisterReadinessCheck(name string, critical bool, check readiness.Check) {
+	getReadiness().Register(name, critical, check)
+}
+
+// probeUpstream posts an empty request to the upstream endpoint of the tenant. The endpoint is up when it responds without a server error, even if it
+// rejects the request. The probe doesn't go through the circuit breaker, so it tells when the endpoint is back.
+func probeUpstream(t *tenant, endpoint string) readiness.Check {
+	return func(ctx context.Context) error {
+		url := fmt.Sprintf("%s/%s", t.apiAddress(), upstreamPaths[endpoint])
+		request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString("{}"))
+		if err != nil {
+			return err
+		}
+		for key, val := range defaultHeaders {
+			request.Header.Add(key, val)
+		}
+		for key, val := range t.upstreamHeaders() {
+			request.Header.Set(key, val)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+		if response.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%v responded with status %v", endpoint, response.StatusCode)
+		}
+		return nil
+	}
+}
+
+// checkBreaker fails while the circuit breaker of the endpoint of the tenant is open. A half-open breaker lets a trial call through, so
+// it is up.
+func checkBreaker(t *tenant, endpoint string) readiness.Check {
+	return func(ctx context.Context) error {
+		if state := t.breaker(endpoint).State(); state == breaker.Open {
+			return fmt.Errorf("circuit breaker of %v is %v", endpoint, state)
+		}
+		return nil
+	}
+}
+
+// HandleLiveness responds with status 200 as long as the service serves requests. It doesn't check the dependencies, so a failing
+// dependency doesn't get the service restarted.
+func HandleLiveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": readiness.StatusUp,
+	})
+}
+
+// HandleReadiness responds with the report of the components. The status is 503 when a critical component is down or the service is
+// draining, and 200 otherwise, including when it is degraded.
+func HandleReadiness(c *gin.Context) {
+	report := getReadiness().Run(c.Request.Context())
+	if isDraining() {
+		report.Status = "draining"
+	}
+	status := http.StatusOK
+	if report.Status == readiness.StatusDown || isDraining() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
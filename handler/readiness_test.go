@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/breaker"
+	"github.com/SDJLee/mercedes-benz/loadshed"
+	"github.com/SDJLee/mercedes-benz/readiness"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/spf13/viper"
+)
+
+// useReadiness starts the readiness probe afresh with the cache duration. It returns a function that restores the configured probe.
+func useReadiness(cacheFor time.Duration) func() {
+	viper.Set(util.ReadinessCacheMs, cacheFor.Milliseconds())
+	readinessChecks.once = sync.Once{}
+	return func() {
+		viper.Set(util.ReadinessCacheMs, 0)
+		readinessChecks.once = sync.Once{}
+	}
+}
+
+func executeReadiness(t *testing.T) (*httptest.ResponseRecorder, *readiness.Report) {
+	req, err := http.NewRequest("GET", "/api/health/ready", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := executeRequest(req)
+	report := &readiness.Report{}
+	if err := json.Unmarshal(rr.Body.Bytes(), report); err != nil {
+		t.Fatal(err)
+	}
+	return rr, report
+}
+
+func TestLiveness(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/health/live", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := executeRequest(req)
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"status":"up"}` {
+		t.Errorf("unexpected liveness %v %v", rr.Code, rr.Body.String())
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	defer useReadiness(time.Minute)()
+
+	rr, report := executeReadiness(t)
+	if rr.Code != http.StatusOK || report.Status != readiness.StatusUp {
+		t.Fatalf("expected the service to be ready but got %v %v", rr.Code, rr.Body.String())
+	}
+	for endpoint := range upstreamPaths {
+		for _, name := range []string{"upstream." + endpoint, "breaker." + endpoint} {
+			if component, ok := report.Components[name]; !ok || component.Status != readiness.StatusUp || !component.Critical {
+				t.Errorf("expected %v to be up and critical but got %+v", name, component)
+			}
+		}
+	}
+
+	// the outcome of the checks is cached
+	executeReadiness(t)
+	if calls := stub.callCount("charge_level"); calls != 1 {
+		t.Errorf("expected the charge level endpoint to be probed once but got %v", calls)
+	}
+}
+
+func TestReadinessUpstreamDown(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	defer useReadiness(0)()
+	stub.Close()
+
+	rr, report := executeReadiness(t)
+	if rr.Code != http.StatusServiceUnavailable || report.Status != readiness.StatusDown {
+		t.Fatalf("expected the service not to be ready but got %v %v", rr.Code, rr.Body.String())
+	}
+	if component := report.Components["upstream."+util.EndpointCharge]; component.Status != readiness.StatusDown || component.Error == "" {
+		t.Errorf("expected the charge level endpoint to be down with an error but got %+v", component)
+	}
+}
+
+func TestReadinessBreakerOpen(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	defer useReadiness(0)()
+	for i := 0; i < util.DefaultBrkFailures; i++ {
+		if err := getBreaker(util.EndpointCharge).Allow(); err != nil {
+			t.Fatal(err)
+		}
+		getBreaker(util.EndpointCharge).Done(false)
+	}
+
+	rr, report := executeReadiness(t)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the service not to be ready but got %v %v", rr.Code, rr.Body.String())
+	}
+	if component := report.Components["breaker."+util.EndpointCharge]; component.Status != readiness.StatusDown {
+		t.Errorf("expected the breaker of the charge level endpoint to be down but got %+v", component)
+	}
+
+	// the open breaker fails the travels without calling the endpoint
+	rr = executeFromIP(t, util.ApiV2, "W1K2062161F0046", "10.0.0.1")
+	assertProblem(t, "v2 breaker open", rr, fmt.Sprintf(util.ErrCodeUpstream, util.EndpointCharge))
+	if calls := stub.callCount("charge_level"); calls != 1 {
+		t.Errorf("expected only the probe to call the charge level endpoint but got %v calls", calls)
+	}
+}
+
+func TestUpstreamServerError(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	stub.status = http.StatusServiceUnavailable
+	limiter := loadshed.New(loadshed.Config{InitialLimit: 10, MinLimit: 1, MaxLimit: 10, QueueSize: 10, QueueTimeout: time.Second,
+		LatencyThreshold: time.Minute, Backoff: 0.5})
+	defer useComputeLimiter(limiter)()
+
+	// the 5xx responses are failures of the upstream, which open the breaker and cut the limit
+	for i := 0; i < util.DefaultBrkFailures; i++ {
+		rr := executeFromIP(t, util.ApiV2, "W1K2062161F0046", "10.0.0.1")
+		assertProblem(t, "v2 upstream 503", rr, fmt.Sprintf(util.ErrCodeUpstream, util.EndpointCharge))
+	}
+	if state := getBreaker(util.EndpointCharge).State(); state != breaker.Open {
+		t.Errorf("expected the breaker of the charge level endpoint to be open but got %v", state)
+	}
+	if limit := limiter.Stats().Limit; limit >= 10 {
+		t.Errorf("expected the limit to be cut by the upstream failures but got %v", limit)
+	}
+	executeFromIP(t, util.ApiV2, "W1K2062161F0046", "10.0.0.1")
+	if calls := stub.callCount("charge_level"); calls != util.DefaultBrkFailures {
+		t.Errorf("expected the open breaker to stop the calls after %v but got %v", util.DefaultBrkFailures, calls)
+	}
+}
+
+func TestReadinessDegraded(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	viper.Set(util.ReadinessTimeoutMs, 50)
+	defer viper.Set(util.ReadinessTimeoutMs, 0)
+	defer useReadiness(0)()
+	RegisterReadinessCheck("optional", false, func(ctx context.Context) error {
+		return errors.New("unavailable")
+	})
+	RegisterReadinessCheck("slow", false, func(ctx context.Context) error {
+		time.Sleep(time.Minute)
+		return nil
+	})
+
+	rr, report := executeReadiness(t)
+	if rr.Code != http.StatusOK || report.Status != readiness.StatusDegraded {
+		t.Fatalf("expected the service to be ready and degraded but got %v %v", rr.Code, rr.Body.String())
+	}
+	if component := report.Components["slow"]; component.Status != readiness.StatusDown {
+		t.Errorf("expected the slow check to time out but got %+v", component)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var changes []string
+	b := breaker.New(breaker.Config{FailureThreshold: 2, OpenTimeout: 20 * time.Millisecond, OnChange: func(from breaker.State, to breaker.State) {
+		changes = append(changes, to.String())
+	}})
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatal(err)
+		}
+		b.Done(false)
+	}
+	if err := b.Allow(); err != breaker.ErrOpen {
+		t.Fatalf("expected the breaker to be open but got %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expected a trial call to be let through but got %v", err)
+	}
+	if err := b.Allow(); err != breaker.ErrOpen {
+		t.Errorf("expected a single trial call but got %v", err)
+	}
+	b.Done(true)
+	if state := b.State(); state != breaker.Closed {
+		t.Errorf("expected the breaker to close after the trial call but got %v", state)
+	}
+	if fmt.Sprint(changes) != "[open half-open closed]" {
+		t.Errorf("unexpected changes of state %v", changes)
+	}
+}
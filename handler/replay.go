@@ -0,0 +1,332 @@
+package handler
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/history"
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gopkg.in/guregu/null.v3"
+)
+
+var (
+	ErrPlanNotFound       = errors.New("plan not found")
+	ErrUnknownAlgorithm   = errors.New("unknown algorithm version")
+	ErrHistoryUnavailable = errors.New("plan history is unavailable")
+	errNotCaptured        = errors.New("not captured in the plan")
+)
+
+type planOptionsKey struct{}
+
+// planOptions are the inputs of the planner other than the request and the upstream data. A replayed plan is computed with the
+// options of the original plan and is not kept in the plan history. The profile of a replayed plan is the one it was computed with,
+// while the profile of a new plan is matched by its VIN.
+type planOptions struct {
+	version         string
+	departure       time.Time
+	reserve         int64
+	profile         *model.VehicleProfile
+	preferredWeight int64
+	replay          bool
+}
+
+func withPlanOptions(ctx context.Context, options planOptions) context.Context {
+	return context.WithValue(ctx, planOptionsKey{}, options)
+}
+
+// planOptionsFrom returns the plan options in ctx. Without options, the plan is computed with the latest algorithm, departing now with
+// the configured reserve and preferred operator weight.
+func planOptionsFrom(ctx context.Context) planOptions {
+	if options, ok := ctx.Value(planOptionsKey{}).(planOptions); ok {
+		return options
+	}
+	return planOptions{
+		version:         util.AlgorithmLatest,
+		departure:       timeNow(),
+		reserve:         viper.GetInt64(util.ReserveCharge),
+		preferredWeight: preferredWeight(),
+	}
+}
+
+// preferredWeight returns the configured weight added to the net charge of the stations of a preferred operator.
+func preferredWeight() int64 {
+	if weight := viper.GetInt64(util.PreferredOpWeight); weight > 0 {
+		return weight
+	}
+	return util.DefaultPrefWeight
+}
+
+// snapshotProvider serves the upstream responses captured in a plan.
+type snapshotProvider struct {
+	record *model.PlanRecord
+}
+
+func (p snapshotProvider) ChargeLevel(ctx context.Context, req *model.ReqChargeLevel) (*model.ResChargeLevel, error) {
+	if p.record.ChargeLevel == nil {
+		return nil, fmt.Errorf("charge level %w", errNotCaptured)
+	}
+	return p.record.ChargeLevel, nil
+}
+
+func (p snapshotProvider) TravelDistance(ctx context.Context, req *model.ReqTravelDistance) (*model.ResTravelDistance, error) {
+	if p.record.Distance == nil {
+		return nil, fmt.Errorf("travel distance %w", errNotCaptured)
+	}
+	return p.record.Distance, nil
+}
+
+func (p snapshotProvider) ChargingStations(ctx context.Context, req *model.ReqChargeStations) (*model.ResChargeStations, error) {
+	if p.record.Stations == nil {
+		return nil, fmt.Errorf("charging stations %w", errNotCaptured)
+	}
+	return p.record.Stations, nil
+}
+
+// ReplayPlan recomputes the plan of the transaction of the tenant with the upstream responses, departure time, reserve, vehicle profile
+// and preferred operator weight it was computed with, as the tenant it was computed for. The plans of the other tenants are not found.
+// The plan is recomputed with the algorithm version, or with the original one when version is empty.
+func ReplayPlan(tenantId string, transId int64, version string) (*model.PlanReplay, error) {
+	store := getPlanHistory()
+	if store == nil {
+		return nil, ErrHistoryUnavailable
+	}
+	flushPlans()
+	record, err := store.Get(transId)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil || record.Tenant != tenantId {
+		return nil, ErrPlanNotFound
+	}
+	return replayRecord(record, version)
+}
+
+// ReplayStoredPlan replays the plan of the transaction from the plan history store, such as one opened by OpenPlanHistory.
+func ReplayStoredPlan(store *history.Store, transId int64, version string) (*model.PlanReplay, error) {
+	record, err := store.Get(transId)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrPlanNotFound
+	}
+	return replayRecord(record, version)
+}
+
+func replayRecord(record *model.PlanRecord, version string) (*model.PlanReplay, error) {
+	originalVersion := record.AlgorithmVersion
+	if originalVersion == "" {
+		originalVersion = util.AlgorithmLatest
+	}
+	if version == "" {
+		version = originalVersion
+	}
+	if version != util.AlgorithmLegacy && version != util.AlgorithmLatest {
+		return nil, ErrUnknownAlgorithm
+	}
+	// the plan is replayed as its tenant, whatever the tenant of the replay request
+	t, err := tenantById(record.Tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay plan of tenant %q. %w", record.Tenant, err)
+	}
+	// the plans kept before the weight was captured are replayed with the configured weight
+	weight := record.PreferredWeight
+	if weight <= 0 {
+		weight = preferredWeight()
+	}
+	ctx := withPlanOptions(withTenant(context.Background(), t), planOptions{
+		version:         version,
+		departure:       record.CreatedAt,
+		reserve:         record.ReserveCharge,
+		profile:         record.VehicleProfile,
+		preferredWeight: weight,
+		replay:          true,
+	})
+	replayed, _ := computeTravel(ctx, snapshotProvider{record: record}, record.Request, record.TransactionID)
+	differences, err := diffResponses(record.Response, replayed)
+	if err != nil {
+		return nil, err
+	}
+	return &model.PlanReplay{
+		TransactionID:   record.TransactionID,
+		OriginalVersion: originalVersion,
+		ReplayedVersion: version,
+		Original:        record.Response,
+		Replayed:        replayed,
+		Differences:     differences,
+	}, nil
+}
+
+// diffResponses returns the fields of the response that differ between the original and the replayed response, by their JSON names.
+func diffResponses(original *model.Response, replayed *model.Response) ([]*model.PlanDifference, error) {
+	originalFields, err := responseFields(original)
+	if err != nil {
+		return nil, err
+	}
+	replayedFields, err := responseFields(replayed)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0)
+	for field := range originalFields {
+		fields = append(fields, field)
+	}
+	for field := range replayedFields {
+		if _, ok := originalFields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	differences := make([]*model.PlanDifference, 0)
+	for _, field := range fields {
+		if !reflect.DeepEqual(originalFields[field], replayedFields[field]) {
+			differences = append(differences, &model.PlanDifference{
+				Field:    field,
+				Original: originalFields[field],
+				Replayed: replayedFields[field],
+			})
+		}
+	}
+	return differences, nil
+}
+
+func responseFields(response *model.Response) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if response == nil {
+		return fields, nil
+	}
+	content, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// planLegacyRoute plans the stops with the original algorithm, kept to replay plans against it. The stations are taken in the order
+// of the upstream response, the detours and the preferences are ignored and the full limit of a station is charged at every stop. The
+// stations are ordered by their names.
+func planLegacyRoute(ctx context.Context, reqBody *model.Request, chargeLevel int64, distance int64, stations []*model.Station, transId int64) (*model.Response, *travelError) {
+	stationNames, err := computeLegacyRoute(stations, chargeLevel, distance)
+	if err != nil {
+		return generateExceptionResp(ctx, reqBody.Vin, reqBody.Source, reqBody.Destination, distance, chargeLevel, transId, false),
+			&travelError{code: util.ErrCodeUnreachable, err: err}
+	}
+	sort.Strings(stationNames)
+	return &model.Response{
+		TransactionID:      transId,
+		Vin:                null.StringFrom(reqBody.Vin),
+		Source:             null.StringFrom(reqBody.Source),
+		Destination:        null.StringFrom(reqBody.Destination),
+		CurrentChargeLevel: null.IntFrom(chargeLevel),
+		Distance:           null.IntFrom(distance),
+		IsChargingRequired: null.BoolFrom(true),
+		ChargingStations:   stationNames,
+	}, nil
+}
+
+// computeLegacyRoute is a frozen copy of the original computeRoute, which should not change so that the plans replayed with the legacy
+// version are computed as they were. It returns the names of the stations to recharge at in the order they were picked, or
+// errOutOfCharge. See computeRoute for the logic.
+func computeLegacyRoute(chargingStations []*model.Station, availableCharge int64, distanceToDest int64) ([]string, error) {
+	var distanceTravelled int64 = 0
+	stationsVisited := make([]string, 0)
+	pq := &legacyQueue{}
+
+	if availableCharge >= distanceToDest {
+		return stationsVisited, nil
+	}
+
+	refill := func() error {
+		if pq.Len() == 0 {
+			return errOutOfCharge
+		}
+		refillingStation := heap.Pop(pq).(*util.QueueItem)
+		refillStationData := refillingStation.Data.(*model.Station)
+		stationsVisited = append(stationsVisited, refillingStation.Value)
+		isStationInclusive := distanceTravelled > refillStationData.Distance
+		var chargeLeft int64 = 0
+		if isStationInclusive {
+			chargeLeft = availableCharge - distanceTravelled
+		} else {
+			chargeLeft = availableCharge - (refillStationData.Distance - distanceTravelled)
+			distanceTravelled = refillStationData.Distance
+		}
+		availableCharge = chargeLeft + refillingStation.Priority
+		return nil
+	}
+
+	for _, station := range chargingStations {
+		for availableCharge < (station.Distance - distanceTravelled) {
+			if err := refill(); err != nil {
+				return nil, err
+			}
+		}
+		heap.Push(pq, &util.QueueItem{
+			Value:    station.Name,
+			Priority: station.Limit,
+			Data:     station,
+		})
+	}
+	for availableCharge < (distanceToDest - distanceTravelled) {
+		if err := refill(); err != nil {
+			return nil, err
+		}
+	}
+	return stationsVisited, nil
+}
+
+// legacyQueue is the priority queue of computeLegacyRoute. Unlike util.PriorityQueue, it orders the stations by their limits only, so
+// that the stations of equal limits are picked in the original order.
+type legacyQueue []*util.QueueItem
+
+func (pq legacyQueue) Len() int { return len(pq) }
+
+func (pq legacyQueue) Less(i, j int) bool { return pq[i].Priority > pq[j].Priority }
+
+func (pq legacyQueue) Swap(i, j int) { pq[i], pq[j] = pq[j], pq[i] }
+
+func (pq *legacyQueue) Push(x interface{}) { *pq = append(*pq, x.(*util.QueueItem)) }
+
+func (pq *legacyQueue) Pop() interface{} {
+	old := *pq
+	item := old[len(old)-1]
+	*pq = old[:len(old)-1]
+	return item
+}
+
+// HandleReplayPlan responds with the plan of the transaction replayed with the algorithm version in the optional query parameter version.
+func HandleReplayPlan(c *gin.Context) {
+	transId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusNotFound, ErrPlanNotFound.Error())
+		return
+	}
+	replay, err := ReplayPlan(tenantFrom(c.Request.Context()).id, transId, c.Query("version"))
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, replay)
+	case ErrPlanNotFound:
+		c.String(http.StatusNotFound, err.Error())
+	case ErrUnknownAlgorithm:
+		c.String(http.StatusBadRequest, fmt.Sprintf("version should be %v or %v", util.AlgorithmLegacy, util.AlgorithmLatest))
+	case ErrHistoryUnavailable:
+		c.String(http.StatusServiceUnavailable, err.Error())
+	default:
+		requestLogger(c.Request.Context()).Errorf("failed to replay plan of transaction %v. %v", transId, err)
+		c.String(http.StatusInternalServerError, util.ErrTechExpMsg)
+	}
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/spf13/viper"
+)
+
+func executeReplay(t *testing.T, transId string, version string) *httptest.ResponseRecorder {
+	url := computeBaseUrl(strings.Replace(util.ApiPlanReplay, ":id", transId, 1))
+	if version != "" {
+		url += "?version=" + version
+	}
+	req, err := http.NewRequest(ReqPost, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executeRequest(req)
+}
+
+func TestReplayPlan(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0046"] = 17
+	stub.distances[routeKey("Home", "Movie Theatre")] = 70
+	stub.stations[routeKey("Home", "Movie Theatre")] = []*model.Station{
+		{Name: "S1", Limit: 30, Distance: 10},
+		{Name: "S2", Limit: 40, Distance: 40, Detour: 2},
+	}
+	viper.Set(util.ReserveCharge, 5)
+	defer viper.Set(util.ReserveCharge, 0)
+
+	req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiComputeRoute), strings.NewReader(reqTestCase4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transId := executeRequest(req).Header().Get(util.TransactionHeader)
+	// the replay uses the captured inputs, not the current upstream data or config
+	stub.chargeLevels["W1K2062161F0046"] = 90
+	viper.Set(util.ReserveCharge, 0)
+
+	rr := executeReplay(t, transId, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("replay should succeed but got %v %v", rr.Code, rr.Body.String())
+	}
+	replay := &model.PlanReplay{}
+	if err := json.Unmarshal(rr.Body.Bytes(), replay); err != nil {
+		t.Fatal(err)
+	}
+	if replay.ReplayedVersion != util.AlgorithmLatest || len(replay.Differences) != 0 {
+		t.Errorf("replay with the original version should reproduce the plan. got %+v", replay.Differences)
+	}
+	if calls := stub.callCount("charge_level"); calls != 1 {
+		t.Errorf("replay shouldn't call the upstream API. got %v calls", calls)
+	}
+
+	rr = executeReplay(t, transId, util.AlgorithmLegacy)
+	replay = &model.PlanReplay{}
+	if err := json.Unmarshal(rr.Body.Bytes(), replay); err != nil {
+		t.Fatal(err)
+	}
+	fields := make([]string, 0)
+	for _, difference := range replay.Differences {
+		fields = append(fields, difference.Field)
+	}
+	if strings.Join(fields, ",") != "detourOverhead,stops" {
+		t.Errorf("legacy replay should differ in the detour overhead and stops. got %v", fields)
+	}
+
+	if rr := executeReplay(t, transId, "3"); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown version should be rejected. got %v", rr.Code)
+	}
+	if rr := executeReplay(t, "1", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown plan should not be found. got %v", rr.Code)
+	}
+}
+
+func TestReplayPlanInputs(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0046"] = 17
+	stub.distances[routeKey("Home", "Movie Theatre")] = 40
+	stub.stations[routeKey("Home", "Movie Theatre")] = []*model.Station{
+		{Name: "S1", Limit: 40, Distance: 10, Connectors: []string{"CHAdeMO"}},
+		{Name: "S2", Limit: 30, Distance: 10, Operator: "ionity"},
+		{Name: "S3", Limit: 35, Distance: 10},
+	}
+	ccsOnly, anyConnector := filepath.Join(testDir, "ccs.json"), filepath.Join(testDir, "any.json")
+	if err := ioutil.WriteFile(ccsOnly, []byte(`[{"name":"eqs","vinPrefix":"W1K","connectors":["CCS"]}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(anyConnector, []byte(`[{"name":"eqs","vinPrefix":"W1K","connectors":["CCS","CHAdeMO"]}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set(util.VehicleProfiles, ccsOnly)
+	defer viper.Set(util.VehicleProfiles, "")
+	viper.Set(util.PreferredOpWeight, 10)
+	defer viper.Set(util.PreferredOpWeight, 0)
+
+	payload := `{"vin":"W1K2062161F0046","source":"Home","destination":"Movie Theatre","preferOperators":["ionity"]}`
+	req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiComputeRoute), strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := executeRequest(req)
+	response := &model.Response{}
+	if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(response.ChargingStations, ",") != "S2" {
+		t.Fatalf("the preferred and compatible station should be picked but got %v", rr.Body.String())
+	}
+
+	// the replay uses the captured profile and weight, not the current config
+	viper.Set(util.VehicleProfiles, anyConnector)
+	viper.Set(util.PreferredOpWeight, 1)
+	rr = executeReplay(t, rr.Header().Get(util.TransactionHeader), "")
+	replay := &model.PlanReplay{}
+	if err := json.Unmarshal(rr.Body.Bytes(), replay); err != nil {
+		t.Fatal(err)
+	}
+	if len(replay.Differences) != 0 {
+		t.Errorf("replay should reproduce the plan with the captured inputs. got %+v", replay.Differences)
+	}
+}
+
+func TestLegacyRoute(t *testing.T) {
+	// the legacy algorithm takes the stations in the order of the response and picks the stations of equal limits in the order they
+	// were queued, which runs out of charge where the latest algorithm reaches the destination
+	stations := []*model.Station{
+		{Name: "A", Limit: 20, Distance: 30},
+		{Name: "B", Limit: 20, Distance: 10},
+	}
+	if _, err := computeLegacyRoute(stations, 35, 60); err != errOutOfCharge {
+		t.Errorf("the legacy algorithm should run out of charge but got %v", err)
+	}
+	stationsVisited, err := computeRoute(context.Background(), stations, 35, 60, "W1K2062161F0046", &model.Preferences{}, util.DefaultPrefWeight)
+	if err != nil || len(stationsVisited) != 2 {
+		t.Errorf("the latest algorithm should reach the destination but got %v %v", stationsVisited, err)
+	}
+
+	stationNames, err := computeLegacyRoute([]*model.Station{{Name: "S1", Limit: 20, Distance: 10}, {Name: "S2", Limit: 15, Distance: 25}}, 17, 50)
+	if err != nil || strings.Join(stationNames, ",") != "S1,S2" {
+		t.Errorf("the legacy algorithm should visit S1 and S2 but got %v %v", stationNames, err)
+	}
+}
@@ -1,11 +1,12 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
+	"time"
 
-	"github.com/SDJLee/mercedes-benz/metrics"
 	"github.com/SDJLee/mercedes-benz/model"
 	"github.com/SDJLee/mercedes-benz/util"
 	"gopkg.in/guregu/null.v3"
@@ -14,48 +15,96 @@ import (
 // TODO: PPT
 // TODO: Readme
 
-// computeTravel contains the logic that handles http calls to retrieve charge level, distance to destination and charging station data to determine
+var (
+	errOutOfCharge  = errors.New("out of charge")
+	errTooManyStops = errors.New("more stops than the driver allows")
+)
+
+// planTravel contains the logic that handles http calls to retrieve charge level, distance to destination and charging station data to determine
 // if the car can travel to destination with current charge level. If the car cannot reach the destination with current charge level,
 // the logic computes the minimum number of charging stations to visit.
+// The data is retrieved with the provider p and the API calls are cancelled when ctx is done. Each step is reported to the progress listener in ctx, if any.
 // It returns the response that contains the cumulative information from above API calls and computed stations to visit list. In case of error or if
-// the destination/station cannot be reached with current charge, it returns appropriate error code and message.
-func computeTravel(reqBody *model.Request, transId int64) (response *model.Response) {
+// the destination/station cannot be reached with current charge, it returns appropriate error code and message along with the failure that
+// describes the error. The failure is nil when the travel is computed.
+func planTravel(ctx context.Context, p provider, reqBody *model.Request, transId int64) (response *model.Response, failure *travelError) {
+	ctx = withTransaction(ctx, transId)
+	logger := requestLogger(ctx)
+	options := planOptionsFrom(ctx)
+	if !options.replay {
+		options.profile = tenantFrom(ctx).vehicleProfile(reqBody.Vin)
+	}
+	// keep the plan with its inputs in the plan history and post its events to the webhooks. this runs last, after a panic is recovered
+	started := time.Now()
+	record := &model.PlanRecord{
+		TransactionID:    transId,
+		Tenant:           tenantFrom(ctx).id,
+		Vin:              reqBody.Vin,
+		CreatedAt:        options.departure.UTC(),
+		AlgorithmVersion: options.version,
+		ReserveCharge:    options.reserve,
+		VehicleProfile:   options.profile,
+		PreferredWeight:  options.preferredWeight,
+		Request:          reqBody,
+	}
+	p = &recordingProvider{next: p, record: record}
+	defer func() {
+		if options.replay {
+			return
+		}
+		record.DurationMs = time.Since(started).Milliseconds()
+		record.Response = response
+		savePlan(record)
+		publishPlanEvents(record, failure)
+	}()
 	// recover a panic and return technical exception
 	defer func() {
 		if ex := recover(); ex != nil {
 			logger.Error("panic recovered", reqBody.Vin, ex)
-			response = generateExceptionResp("", "", "", 0, 0, transId, true)
+			response = generateExceptionResp(ctx, "", "", "", 0, 0, transId, true)
+			failure = &travelError{code: util.ErrCodeInternal, err: fmt.Errorf("%v", ex)}
 		}
 	}()
-	defer metrics.StatTime(fmt.Sprintf("%v.computetravel", reqBody.Vin))()
+	defer tenantFrom(ctx).stats.StatTime(fmt.Sprintf("%v.computetravel", reqBody.Vin))()
 	// step 1: find charge level and handle error
-	chargeLevel, err := getChargeLevel(reqBody)
+	chargeLevel, err := getChargeLevel(ctx, p, reqBody)
 	if err != nil {
 		logger.Error("error on fetching charge level", reqBody.Vin, err)
-		return generateExceptionResp(reqBody.Vin, reqBody.Source, reqBody.Destination, 0, 0, transId, true)
+		return generateExceptionResp(ctx, reqBody.Vin, reqBody.Source, reqBody.Destination, 0, 0, transId, true), upstreamFailure(util.EndpointCharge, err)
 	}
 	if chargeLevel.Error.Valid {
 		logger.Error("error on fetching charge level", reqBody.Vin, chargeLevel.Error.String)
-		return generateExceptionResp(reqBody.Vin, reqBody.Source, reqBody.Destination, 0, 0, transId, true)
+		return generateExceptionResp(ctx, reqBody.Vin, reqBody.Source, reqBody.Destination, 0, 0, transId, true),
+			&travelError{code: util.ErrCodeInvalidVin, endpoint: util.EndpointCharge, err: errors.New(chargeLevel.Error.String)}
 	}
 	logger.Debugf("%v :: chargeLevel", reqBody.Vin, chargeLevel)
+	reportProgress(ctx, util.PhaseChargeLevel, chargeLevel)
 
 	// step 2: find distance and handle error
-	travelDistance, err := getTravelDistance(reqBody)
+	travelDistance, err := getTravelDistance(ctx, p, reqBody)
 	if err != nil {
 		logger.Error("error on fetching travel distance", reqBody.Vin, err)
-		return generateExceptionResp(reqBody.Vin, reqBody.Source, reqBody.Destination, 0, chargeLevel.CurrentChargeLevel, transId, true)
+		return generateExceptionResp(ctx, reqBody.Vin, reqBody.Source, reqBody.Destination, 0, chargeLevel.CurrentChargeLevel, transId, true),
+			upstreamFailure(util.EndpointDistance, err)
 	}
 	if travelDistance.Error.Valid {
 		logger.Error("error on fetching travel distance", reqBody.Vin, travelDistance.Error.String)
-		return generateExceptionResp(reqBody.Vin, reqBody.Source, reqBody.Destination, 0, chargeLevel.CurrentChargeLevel, transId, true)
+		return generateExceptionResp(ctx, reqBody.Vin, reqBody.Source, reqBody.Destination, 0, chargeLevel.CurrentChargeLevel, transId, true),
+			&travelError{code: util.ErrCodeUnknownLoc, endpoint: util.EndpointDistance, err: errors.New(travelDistance.Error.String)}
 	}
 	logger.Debugf("%v :: travelDistance", reqBody.Vin, travelDistance)
+	reportProgress(ctx, util.PhaseDistance, travelDistance)
 
 	// step 3: handle if current level is sufficient to reach the destination
-	if chargeLevel.CurrentChargeLevel >= travelDistance.Distance {
+	// the car should arrive the destination with the configured reserve charge left.
+	// the legacy algorithm doesn't keep a reserve.
+	reserve := options.reserve
+	if options.version == util.AlgorithmLegacy {
+		reserve = 0
+	}
+	if chargeLevel.CurrentChargeLevel >= travelDistance.Distance+reserve {
 		// with current charge level greater/equal to the total distance, there is no need to charge
-		// when current charge level is equal to total distance, the charge level on arriving
+		// when current charge level is equal to total distance and no reserve is configured, the charge level on arriving
 		// the destination will be 0 which is acceptable.
 		response = &model.Response{
 			TransactionID:      transId,
@@ -69,34 +118,103 @@ func computeTravel(reqBody *model.Request, transId int64) (response *model.Respo
 			Errors:             nil,
 		}
 		logger.Debugf("%v :: final response", reqBody.Vin, response)
-		metrics.StatCount(fmt.Sprintf("counters.computetravel.%v.sufficientfuel", reqBody.Vin), 1)
-		return response
+		tenantFrom(ctx).stats.StatCount(fmt.Sprintf("counters.computetravel.%v.sufficientfuel", reqBody.Vin), 1)
+		return response, nil
 	}
 
 	// at this point, we know that with current charge level, we cannot reach the distance. continue further to retrieve list of available charging
 	// stations and pick the minimum number of stations to visit.
 
 	// step 4: find stations
-	chargeStations, err := getChargingStations(reqBody)
+	chargeStations, err := getChargingStations(ctx, p, reqBody)
 	if err != nil {
 		logger.Error("error on fetching charging stations", reqBody.Vin, err)
-		return generateExceptionResp(reqBody.Vin, reqBody.Source, reqBody.Destination, travelDistance.Distance, chargeLevel.CurrentChargeLevel, transId, true)
+		return generateExceptionResp(ctx, reqBody.Vin, reqBody.Source, reqBody.Destination, travelDistance.Distance, chargeLevel.CurrentChargeLevel, transId, true),
+			upstreamFailure(util.EndpointStations, err)
 	}
 	if chargeStations.Error.Valid {
 		logger.Error("error on fetching charging stations", reqBody.Vin, chargeStations.Error.String)
-		return generateExceptionResp(reqBody.Vin, reqBody.Source, reqBody.Destination, travelDistance.Distance, chargeLevel.CurrentChargeLevel, transId, true)
+		return generateExceptionResp(ctx, reqBody.Vin, reqBody.Source, reqBody.Destination, travelDistance.Distance, chargeLevel.CurrentChargeLevel, transId, true),
+			&travelError{code: util.ErrCodeUnknownLoc, endpoint: util.EndpointStations, err: errors.New(chargeStations.Error.String)}
 	}
 	logger.Debugf("%v :: chargeStations", reqBody.Vin, chargeStations)
+	reportProgress(ctx, util.PhaseStations, chargeStations)
+
+	if options.version == util.AlgorithmLegacy {
+		return planLegacyRoute(ctx, reqBody, chargeLevel.CurrentChargeLevel, travelDistance.Distance, chargeStations.ChargingStations, transId)
+	}
+
+	// step 5: leave out the stations that are unavailable, closed on arrival or incompatible with the vehicle.
+	eligibleStations, excludedStations := filterStations(ctx, chargeStations.ChargingStations, &reqBody.Preferences, options.profile, options.departure, reqBody.Vin)
+	if len(excludedStations) == 0 {
+		excludedStations = nil
+	}
 
-	// step 5: compute the minimum number of stations to visit.
-	stationsVisited, err := computeRoute(chargeStations.ChargingStations, chargeLevel.CurrentChargeLevel, travelDistance.Distance, reqBody.Vin)
+	// step 6: compute the minimum number of stations to visit and take only the charge needed at each stop to complete the trip with the reserve.
+	// charging at a stop delays the arrival at the next stops, so a stop that is closed on the delayed arrival is excluded and the route is
+	// planned again without it.
+	prefs := reqBody.Preferences
+	var stationsVisited []*model.Station
+	var charges map[*model.Station]int64
+	for {
+		stationsVisited, err = computeRoute(ctx, eligibleStations, chargeLevel.CurrentChargeLevel, travelDistance.Distance+reserve, reqBody.Vin, &prefs, options.preferredWeight)
+		if err == errTooManyStops && len(prefs.PreferOperators) > 0 {
+			// preferring an operator can cost extra stops. The maximum stops is a hard constraint, so the route is planned again without the preference.
+			logger.Infof("%v :: relaxing preferred operators to stay within %v stops", reqBody.Vin, prefs.MaxStops)
+			prefs.PreferOperators = nil
+			stationsVisited, err = computeRoute(ctx, eligibleStations, chargeLevel.CurrentChargeLevel, travelDistance.Distance+reserve, reqBody.Vin, &prefs, options.preferredWeight)
+		}
+		if err != nil {
+			break
+		}
+		charges = computeCharges(ctx, stationsVisited, chargeLevel.CurrentChargeLevel, travelDistance.Distance, reserve, reqBody.Vin)
+		closed := closedStop(ctx, stationsVisited, charges, options.departure, reqBody.Vin)
+		if closed == nil {
+			break
+		}
+		excludedStations = append(excludedStations, &model.ResExcludedStation{Name: closed.Name, Reason: util.ExclClosed})
+		remaining := make([]*model.Station, 0, len(eligibleStations)-1)
+		for _, station := range eligibleStations {
+			if station != closed {
+				remaining = append(remaining, station)
+			}
+		}
+		eligibleStations = remaining
+	}
+	appliedPrefs := appliedPreferences(&reqBody.Preferences, &prefs, excludedStations, stationsVisited)
+	if err == errTooManyStops {
+		// the stops run out before it is known whether the destination can be reached at all, so the route is planned again without
+		// the maximum stops. only a destination that can be reached that way fails for the maximum stops.
+		unlimited := prefs
+		unlimited.MaxStops = 0
+		if _, unlimitedErr := computeRoute(ctx, eligibleStations, chargeLevel.CurrentChargeLevel, travelDistance.Distance+reserve, reqBody.Vin, &unlimited, options.preferredWeight); unlimitedErr != nil {
+			err = unlimitedErr
+		}
+	}
+	if err == errTooManyStops {
+		// the v1 API reports the unreachable error 8888, while the failure tells the maximum stops apart for the v2 and gRPC APIs
+		logger.Warnf("%v :: destination can't be reached within %v stops", reqBody.Vin, prefs.MaxStops)
+		response = generateExceptionResp(ctx, reqBody.Vin, reqBody.Source, reqBody.Destination, travelDistance.Distance, chargeLevel.CurrentChargeLevel, transId, false)
+		response.ExcludedStations = excludedStations
+		response.AppliedPreferences = appliedPrefs
+		return response, &travelError{code: util.ErrCodeMaxStops, err: err}
+	}
 	if err != nil {
 		logger.Warn("no more charge left. will be unable to reach destination", reqBody.Vin, err)
-		return generateExceptionResp(reqBody.Vin, reqBody.Source, reqBody.Destination, travelDistance.Distance, chargeLevel.CurrentChargeLevel, transId, false)
+		response = generateExceptionResp(ctx, reqBody.Vin, reqBody.Source, reqBody.Destination, travelDistance.Distance, chargeLevel.CurrentChargeLevel, transId, false)
+		response.ExcludedStations = excludedStations
+		response.AppliedPreferences = appliedPrefs
+		return response, &travelError{code: util.ErrCodeUnreachable, err: err}
 	}
 
-	// sort the stations slice order the station names lexicographically
-	sort.Strings(stationsVisited)
+	// sort the stations visited by their names lexicographically or in the driving order
+	orderStations(stationsVisited, reqBody.StationOrder)
+	stationNames := make([]string, 0, len(stationsVisited))
+	for _, station := range stationsVisited {
+		stationNames = append(stationNames, station.Name)
+	}
+	stops, detourOverhead := buildStops(stationsVisited, charges)
+	reportProgress(ctx, util.PhasePlan, stops)
 
 	response = &model.Response{
 		TransactionID:      transId,
@@ -106,20 +224,24 @@ func computeTravel(reqBody *model.Request, transId int64) (response *model.Respo
 		CurrentChargeLevel: null.IntFrom(chargeLevel.CurrentChargeLevel),
 		Distance:           null.IntFrom(travelDistance.Distance),
 		IsChargingRequired: null.BoolFrom(true),
-		ChargingStations:   stationsVisited,
+		ChargingStations:   stationNames,
+		Stops:              stops,
+		DetourOverhead:     null.IntFrom(detourOverhead),
+		ExcludedStations:   excludedStations,
+		AppliedPreferences: appliedPrefs,
 		Errors:             nil,
 	}
 	logger.Debugf("%v :: final response", reqBody.Vin, response)
-	metrics.StatCount(fmt.Sprintf("counters.computetravel.%v.success", reqBody.Vin), 1)
-	return response
+	tenantFrom(ctx).stats.StatCount(fmt.Sprintf("counters.computetravel.%v.success", reqBody.Vin), 1)
+	return response, nil
 }
 
 // getChargeLevel method handles the API call to retrieve current charge level
-func getChargeLevel(reqBody *model.Request) (*model.ResChargeLevel, error) {
+func getChargeLevel(ctx context.Context, p provider, reqBody *model.Request) (*model.ResChargeLevel, error) {
 	chargeLevelReq := &model.ReqChargeLevel{
 		Vin: reqBody.Vin,
 	}
-	chargeLevel, err := GetChargeLevel(chargeLevelReq)
+	chargeLevel, err := p.ChargeLevel(ctx, chargeLevelReq)
 	if err != nil {
 		return nil, err
 	}
@@ -127,12 +249,12 @@ func getChargeLevel(reqBody *model.Request) (*model.ResChargeLevel, error) {
 }
 
 // getTravelDistance method handles the API call to retrieve the travel distance
-func getTravelDistance(reqBody *model.Request) (*model.ResTravelDistance, error) {
+func getTravelDistance(ctx context.Context, p provider, reqBody *model.Request) (*model.ResTravelDistance, error) {
 	travelDistanceReq := &model.ReqTravelDistance{
 		Source:      reqBody.Source,
 		Destination: reqBody.Destination,
 	}
-	travelDistance, err := GetTravelDistance(travelDistanceReq)
+	travelDistance, err := p.TravelDistance(ctx, travelDistanceReq)
 	if err != nil {
 		return nil, err
 	}
@@ -140,12 +262,12 @@ func getTravelDistance(reqBody *model.Request) (*model.ResTravelDistance, error)
 }
 
 // getChargingStations method handles the API call to retrieve slice of charging stations between source and destination
-func getChargingStations(reqBody *model.Request) (*model.ResChargeStations, error) {
+func getChargingStations(ctx context.Context, p provider, reqBody *model.Request) (*model.ResChargeStations, error) {
 	chargingStationsReq := &model.ReqChargeStations{
 		Source:      reqBody.Source,
 		Destination: reqBody.Destination,
 	}
-	chargingStations, err := GetChargingStations(chargingStationsReq)
+	chargingStations, err := p.ChargingStations(ctx, chargingStationsReq)
 	if err != nil {
 		return nil, err
 	}
@@ -154,7 +276,7 @@ func getChargingStations(reqBody *model.Request) (*model.ResChargeStations, erro
 
 // generateExceptionResp is a helper method to generate error responses. The type of error is differentiated by techExp param.
 // If techExp is true, error 9999 is generated. Else error 8888 is generated.
-func generateExceptionResp(vin string, source string, dest string, distance int64, chargeLevel int64, transId int64, techExp bool) *model.Response {
+func generateExceptionResp(ctx context.Context, vin string, source string, dest string, distance int64, chargeLevel int64, transId int64, techExp bool) *model.Response {
 
 	// generates an error for "Technical Exception" for invalid request/data or computational failure
 	generateTechException := func() []*model.ResError {
@@ -164,7 +286,7 @@ func generateExceptionResp(vin string, source string, dest string, distance int6
 			Description: util.ErrTechExpMsg,
 		}
 		resErrors = append(resErrors, resError)
-		metrics.StatCount(fmt.Sprintf("counters.computetravel.%v.failure", vin), 1)
+		tenantFrom(ctx).stats.StatCount(fmt.Sprintf("counters.computetravel.%v.failure", vin), 1)
 		return resErrors
 	}
 
@@ -176,7 +298,7 @@ func generateExceptionResp(vin string, source string, dest string, distance int6
 			Description: util.ErrUnreachableMsg,
 		}
 		resErrors = append(resErrors, resError)
-		metrics.StatCount(fmt.Sprintf("counters.computetravel.%v.nocharge", vin), 1)
+		tenantFrom(ctx).stats.StatCount(fmt.Sprintf("counters.computetravel.%v.nocharge", vin), 1)
 		return resErrors
 	}
 
@@ -215,19 +337,27 @@ func generateExceptionResp(vin string, source string, dest string, distance int6
 // The priority queue will be in descending order respect to the charge available in station. For example, if the station and charge pair are S1:10, S2:20, S3:30, then the priority queue will return
 // in the order S3:30, S2:20, S1:10. We always pick the next station that provides maximum charge.
 // 4. If the charge in a station is not sufficient, we pick the next station from the priority queue. This is done till either the queue is empty or the charge becomes sufficient.
-// 5. The station names where the car recharges are added to the returning slice.
-// The method returns a slice containing names of the stations where the car is recharged. The slice is empty if no station is visited. This is when the charge is sufficient to reach destination.
+// 5. The stations where the car recharges are added to the returning slice.
+// The stations are iterated in the driving order, which is the ascending order of their distance from the source and then of their names.
+// Stations that provide equal charge are picked nearest first and then by their names, so the route doesn't depend on the order of the stations in input.
+// Stations that are not exactly on the route carry a detour, the distance in miles between the route and the station. The car spends the detour
+// to reach the station and spends it again to come back to the route, so the charge a station provides is its limit minus twice the detour.
+// Stations are queued by this net charge, and a station ahead of the car that cannot be reached with the charge left after including its detour is skipped.
+// The driver preferences are honored while planning. Stations of a preferred operator are queued with preferredWeight added to their net charge,
+// so they are picked over stations that provide slightly more charge. The route fails with errTooManyStops when it needs more stops than the driver allows.
+// The method returns a slice containing the stations where the car is recharged in the order they were picked. The slice is empty if no station is visited.
+// This is when the charge is sufficient to reach destination.
 // The method also returns a error variable. This error is to denote that the car will not make it to the destination as there is no sufficient charge.
 // The time complexity of this logic is O(nlog(n)). We iterate n times and greedily check if recharge is required.
 // The space complexity of this logic is O(n)
-func computeRoute(chargingStations []*model.Station, availableCharge int64, distanceToDest int64, vin string) ([]string, error) {
-
-	defer metrics.StatTime(fmt.Sprintf("%v.computetravel.computeroute", vin))()
+func computeRoute(ctx context.Context, chargingStations []*model.Station, availableCharge int64, distanceToDest int64, vin string, prefs *model.Preferences, preferredWeight int64) ([]*model.Station, error) {
+	logger := requestLogger(ctx)
+	defer tenantFrom(ctx).stats.StatTime(fmt.Sprintf("%v.computetravel.computeroute", vin))()
 	logger.Info("computing route", vin)
 	defer logger.Info("route computed", vin)
 	var distanceTravelled int64 = 0
 	logger.Debugf("%v :: computeRoute with availableCharge %v distanceToDest %v distanceTravelled %v", vin, availableCharge, distanceToDest, distanceTravelled)
-	stationsVisited := make([]string, 0)
+	stationsVisited := make([]*model.Station, 0)
 	pq := util.InitQueue()
 
 	// if available charge is >= distance to destination, there is no need to stop at stations to recharge. Return empty slice.
@@ -235,34 +365,28 @@ func computeRoute(chargingStations []*model.Station, availableCharge int64, dist
 		return stationsVisited, nil
 	}
 
-	// iterate through stations to apply greedy approach
-	for _, station := range chargingStations {
-		logger.Debugf("%v :: checking charge availableCharge < (station.Distance - distanceTravelled) :: %v < %v - %v = %v",
-			vin, availableCharge, station.Distance, distanceTravelled, (station.Distance - distanceTravelled))
-		// This condition is to check if the charge left in car is sufficient to reach the next station.
-		// The calculation (station.Distance - distanceTravelled) is done because, the distance provided in station struct doesn't denote the distance between the stations. It denotes the distance between
-		// the source and the station. As the car travels from source to destination and passes through each station, we should subtract this travelled distance with the distance provided in station struct.
-		// In simpler terms, the distance provided in station struct includes the distance travelled by the car. We need the difference between the two to check if the car will be able to reach the next station
-		// from a previous station/source with current charge.
-		for availableCharge < (station.Distance - distanceTravelled) {
-			logger.Debugf("%v :: charge not sufficient, needs refill", vin)
-			// If there are no more stations left with charge, then there is no sufficient charge for the car to reach the destination. return error.
-			if pq.IsEmpty() {
-				logger.Warnf("%v :: out of charge", vin)
-				return nil, errors.New("out of charge")
+	// refill pops the station that provides the maximum charge from the priority queue and recharges the car in it.
+	// It returns errOutOfCharge when there are no more stations left in the queue to recharge and errTooManyStops when the
+	// stop exceeds the maximum stops allowed by the driver.
+	refill := func() error {
+		// a station whose detour can't be covered with the charge left may be reached once the car has charged at another station,
+		// so the stations skipped for their detour are put back in the queue for the next refill.
+		skipped := make([]*util.QueueItem, 0)
+		defer func() {
+			for _, item := range skipped {
+				pq.PushItem(item)
 			}
-			// The priority queue pops the element with greater priority value. Here, the charge left in a station is the priority. This pop will return next station that has the maximum charge left for consumption.
+		}()
+		for !pq.IsEmpty() {
+			// The priority queue pops the element with greater priority value. Here, the net charge provided by a station is the priority.
 			refillingStation := pq.PopItem()
-			nextMaxCharge := refillingStation.Priority
 			refillStationData := refillingStation.Data.(*model.Station)
-			// push the station into stationsVisited slice. This slice keeps track of stations that are visited to recharge.
-			stationsVisited = append(stationsVisited, refillingStation.Value)
 			// compute chargeLeft. It is the difference between the initial available charge from source or last station visit and the distance travelled to this station from source or a previous station.
 			// (refillStationData.Distance - distanceTravelled) gives the distance between the station.
 			logger.Infof("%v :: checking if isStationInclusive. distance travelled so far %v, distance to this station (new distance) %v",
 				vin, distanceTravelled, refillStationData.Distance)
 			isStationInclusive := distanceTravelled > refillStationData.Distance
-			logger.Infof("%v is station delta?", vin, isStationInclusive)
+			logger.Infof("%v :: is station delta?", vin, isStationInclusive)
 			var chargeLeft int64 = 0
 			if isStationInclusive {
 				chargeLeft = availableCharge - distanceTravelled
@@ -270,9 +394,22 @@ func computeRoute(chargingStations []*model.Station, availableCharge int64, dist
 					vin, availableCharge, distanceTravelled, chargeLeft)
 			} else {
 				chargeLeft = availableCharge - (refillStationData.Distance - distanceTravelled)
-				logger.Infof("%v :: computing charge left with params :: availableCharge - (refillStationData.Distance - distanceTravelled) = chargeLeft :: %v - (%v - %v) = %v ",
+				logger.Infof("%v :: computing charge left with params :: availableCharge - (refillStationData.Distance - distanceTravelled) = chargeLeft :: %v - (%v - %v) = %v",
 					vin, availableCharge, refillStationData.Distance, distanceTravelled, chargeLeft)
 			}
+			// the car leaves the route to reach a station ahead of it. If the charge left cannot cover the detour, the station is unreachable and the next one is picked.
+			if !isStationInclusive && chargeLeft < refillStationData.Detour {
+				logger.Infof("%v :: station %v is unreachable with detour %v and charge left %v",
+					vin, refillingStation.Value, refillStationData.Detour, chargeLeft)
+				skipped = append(skipped, refillingStation)
+				continue
+			}
+			// push the station into stationsVisited slice. This slice keeps track of stations that are visited to recharge.
+			stationsVisited = append(stationsVisited, refillStationData)
+			if prefs.MaxStops > 0 && len(stationsVisited) > prefs.MaxStops {
+				logger.Warnf("%v :: route needs more than %v stops", vin, prefs.MaxStops)
+				return errTooManyStops
+			}
 			// update the total distance travelled with the station's distance. This is because, the station's distance is the distance from the source.
 			// Since the stations are out of order in the priority queue, the distanceTravelled should be updated only if it is lesser than the distance to the station.
 			// For example, distance from source could be more for S3 when compared to S2 in the data S3:50, S2:40. But if S2 provides more charge than S3, then the priority queue
@@ -284,17 +421,53 @@ func computeRoute(chargingStations []*model.Station, availableCharge int64, dist
 			}
 			logger.Infof("%v :: updated distanceTravelled", vin, distanceTravelled)
 
-			logger.Debugf("%v :: refilling at station %v availableCharge %v chargeLeft %v charge at station %v distanceTravelled %v distanceToDest %v",
-				vin, refillingStation.Value, availableCharge, chargeLeft, refillingStation.Priority, refillStationData.Distance, distanceToDest)
-			// This shows the refilling process. The availableCharge value is updated to the sum between chargeLeft and the charge available at the station depicted by variable nextMaxCharge.
-			availableCharge = chargeLeft + nextMaxCharge
+			logger.Debugf("%v :: refilling at station %v availableCharge %v chargeLeft %v charge at station %v detour %v distanceTravelled %v distanceToDest %v",
+				vin, refillingStation.Value, availableCharge, chargeLeft, refillStationData.Limit, refillStationData.Detour, refillStationData.Distance, distanceToDest)
+			// This shows the refilling process. The availableCharge value is updated to the sum between chargeLeft and the charge available at the station
+			// minus the detour travelled to the station and back to the route.
+			availableCharge = chargeLeft + refillStationData.Limit - 2*refillStationData.Detour
 			logger.Debugf("%v :: refilled at station %v availableCharge %v with charge %v distanceToDest %v",
 				vin, refillingStation.Value, availableCharge, refillingStation.Priority, distanceToDest)
+			return nil
+		}
+		logger.Warnf("%v :: out of charge", vin)
+		return errOutOfCharge
+	}
+
+	// iterate through stations in the driving order to apply greedy approach
+	drivingOrder := make([]*model.Station, len(chargingStations))
+	copy(drivingOrder, chargingStations)
+	orderStations(drivingOrder, util.OrderByDriving)
+	for _, station := range drivingOrder {
+		logger.Debugf("%v :: checking charge availableCharge < (station.Distance - distanceTravelled) :: %v < %v - %v = %v",
+			vin, availableCharge, station.Distance, distanceTravelled, (station.Distance - distanceTravelled))
+		// This condition is to check if the charge left in car is sufficient to reach the next station.
+		// The calculation (station.Distance - distanceTravelled) is done because, the distance provided in station struct doesn't denote the distance between the stations. It denotes the distance between
+		// the source and the station. As the car travels from source to destination and passes through each station, we should subtract this travelled distance with the distance provided in station struct.
+		// In simpler terms, the distance provided in station struct includes the distance travelled by the car. We need the difference between the two to check if the car will be able to reach the next station
+		// from a previous station/source with current charge.
+		for availableCharge < (station.Distance - distanceTravelled) {
+			logger.Debugf("%v :: charge not sufficient, needs refill", vin)
+			// If there are no more stations left with charge, then there is no sufficient charge for the car to reach the destination. return error.
+			if err := refill(); err != nil {
+				return nil, err
+			}
+		}
+		// a station whose detour costs at least the charge it provides never helps the car. leave it out of the queue.
+		netCharge := station.Limit - 2*station.Detour
+		if netCharge <= 0 {
+			logger.Debugf("%v :: skipping station %v with limit %v and detour %v", vin, station.Name, station.Limit, station.Detour)
+			continue
 		}
-		// regardless if car stops for recharge, push the station into priority queue on each iteration. This station will be consumed in above for loop when charge is required.
+		priority := netCharge
+		if containsFold(prefs.PreferOperators, station.Operator) {
+			priority += preferredWeight
+		}
+		// regardless if car stops for recharge, push the station into priority queue on each iteration. This station will be consumed in refill when charge is required.
 		pq.PushItem(&util.QueueItem{
 			Value:    station.Name,
-			Priority: station.Limit,
+			Priority: priority,
+			Order:    station.Distance,
 			Data:     station,
 		})
 		logger.Debugf("%v :: added station %v to queue", vin, station.Name)
@@ -303,55 +476,138 @@ func computeRoute(chargingStations []*model.Station, availableCharge int64, dist
 
 	// handling edge case where the car hasn't reached the destination yet.
 	// The logic repeats the same step from above.
-
 	for availableCharge < (distanceToDest - distanceTravelled) {
-		// TODO: Recheck this computation, move to closure
-		logger.Infof("%v :: checking if the car has reached the destination. availableCharge < (distanceToDest - distanceTravelled) :: %v >= (%v - %v) i.e, (%v)\n",
+		logger.Infof("%v :: checking if the car has reached the destination. availableCharge < (distanceToDest - distanceTravelled) :: %v >= (%v - %v) i.e, (%v)",
 			vin, availableCharge, distanceToDest, distanceTravelled, (distanceToDest - distanceTravelled))
 
 		logger.Infof("%v :: need more charge, visiting more charging stations", vin)
 
-		if pq.IsEmpty() {
-			// If there are no more stations left with charge, then there is no sufficient charge for the car to reach the destination. return error.
-			logger.Warnf("%v :: out of charge", vin)
-			return nil, errors.New("out of charge")
+		// If there are no more stations left with charge, then there is no sufficient charge for the car to reach the destination. return error.
+		if err := refill(); err != nil {
+			return nil, err
 		}
-		refillingStation := pq.PopItem()
-		nextMaxCharge := refillingStation.Priority
-		refillStationData := refillingStation.Data.(*model.Station)
-		stationsVisited = append(stationsVisited, refillingStation.Value)
-
-		logger.Infof("%v :: checking if isStationInclusive. distance travelled so far %v, distance to this station (new distance) %v\n",
-			vin, distanceTravelled, refillStationData.Distance)
-		isStationInclusive := distanceTravelled > refillStationData.Distance
-		logger.Infof("%v :: is station delta?", vin, isStationInclusive)
-		var chargeLeft int64 = 0
-		if isStationInclusive {
-			chargeLeft = availableCharge - distanceTravelled
-			logger.Infof("%v :: computing charge left with params :: availableCharge - distanceTravelled = chargeLeft :: %v - %v = %v \n",
-				vin, availableCharge, distanceTravelled, chargeLeft)
-		} else {
-			chargeLeft = availableCharge - (refillStationData.Distance - distanceTravelled)
-			logger.Infof("%v :: computing charge left with params :: availableCharge - (refillStationData.Distance - distanceTravelled) = chargeLeft :: %v - (%v - %v) = %v \n",
-				vin, availableCharge, refillStationData.Distance, distanceTravelled, chargeLeft)
+	}
+	logger.Infof("%v :: the car has travelled %v distance so far. remaining charge is %v. distance left to cover is (distanceToDest - distanceTravelled) :: %v",
+		vin, distanceTravelled, availableCharge, (distanceToDest - distanceTravelled))
+	logger.Infof("%v :: stationsVisited", vin, stationsVisited)
+	return stationsVisited, nil
+}
+
+// buildStops converts the visited stations into the stops returned in response along with the total detour overhead of the trip.
+// The detour overhead of a stop is the distance travelled off the route to reach the station and come back. The charge of a stop
+// is taken from charges computed by computeCharges.
+func buildStops(stationsVisited []*model.Station, charges map[*model.Station]int64) ([]*model.ResStop, int64) {
+	stops := make([]*model.ResStop, 0, len(stationsVisited))
+	var detourOverhead int64 = 0
+	for _, station := range stationsVisited {
+		stop := &model.ResStop{
+			Name:           station.Name,
+			Distance:       station.Distance,
+			Detour:         station.Detour,
+			DetourOverhead: 2 * station.Detour,
+			Charge:         charges[station],
+			MaxPower:       station.MaxPower,
 		}
+		detourOverhead += stop.DetourOverhead
+		stops = append(stops, stop)
+	}
+	return stops, detourOverhead
+}
 
-		if !isStationInclusive {
-			logger.Infof("%v :: reassigning distanceTravelled. distance travelled so far %v, distance to this station (new distance) %v\n",
-				vin, distanceTravelled, refillStationData.Distance)
-			distanceTravelled = refillStationData.Distance
+// computeCharges is a pass over the stops chosen by computeRoute that computes the minimum charge to take at each stop, instead of the
+// station's full limit, so that the car completes the trip with the reserve charge left.
+// Below is the logical explanation of the method.
+// 1. The stops are ordered by their distance from the source, which is the order the car drives through them.
+// 2. The cost of a leg is the distance from a stop to the next stop or the destination, including the detour back to the route from the stop
+// and the detour to the next stop.
+// 3. Walking backwards from the destination, we find the minimum charge the car needs on arriving each stop. It is the charge needed to cover
+// the leg and arrive the next stop with its own minimum charge, less what the stop can provide.
+// 4. Walking forwards from the source, the car takes just the charge needed at each stop to arrive the next stop with the charge it needs.
+// The method returns the charge to take at each stop keyed by the stop.
+// The time complexity of this logic is O(nlog(n)) to order the stops. The space complexity is O(n).
+func computeCharges(ctx context.Context, stationsVisited []*model.Station, availableCharge int64, distanceToDest int64, reserve int64, vin string) map[*model.Station]int64 {
+	logger := requestLogger(ctx)
+	stops := make([]*model.Station, len(stationsVisited))
+	copy(stops, stationsVisited)
+	orderStations(stops, util.OrderByDriving)
+
+	// legCost returns the charge needed to travel from the stop at index i back to the route and to the next stop or the destination.
+	legCost := func(i int) int64 {
+		if i == len(stops)-1 {
+			return stops[i].Detour + (distanceToDest - stops[i].Distance)
 		}
-		logger.Infof("%v :: updated distanceTravelled", vin, distanceTravelled)
+		return stops[i].Detour + (stops[i+1].Distance - stops[i].Distance) + stops[i+1].Detour
+	}
 
-		logger.Infof("%v :: refilling at station %v availableCharge %v chargeLeft %v charge at station %v distanceTravelled %v distanceToDest %v\n",
-			vin, refillingStation.Value, availableCharge, chargeLeft, refillingStation.Priority, refillStationData.Distance, distanceToDest)
+	// needed[i] is the minimum charge needed on arriving the stop at index i. needed[len(stops)] is the reserve needed at the destination.
+	needed := make([]int64, len(stops)+1)
+	needed[len(stops)] = reserve
+	for i := len(stops) - 1; i >= 0; i-- {
+		needed[i] = legCost(i) + needed[i+1] - stops[i].Limit
+		if needed[i] < 0 {
+			needed[i] = 0
+		}
+	}
 
-		availableCharge = chargeLeft + nextMaxCharge
-		logger.Infof("%v :: refilled at station %v availableCharge %v with charge %v distanceToDest %v\n",
-			vin, refillingStation.Value, availableCharge, nextMaxCharge, distanceToDest)
+	charges := make(map[*model.Station]int64, len(stops))
+	if len(stops) == 0 {
+		return charges
 	}
-	logger.Infof("%v :: the car has travelled %v distance so far. remaining charge is %v. distance left to cover is (distanceToDest - distanceTravelled) :: %v\n",
-		vin, distanceTravelled, availableCharge, (distanceToDest - distanceTravelled))
-	logger.Infof("%v :: stationsVisited", vin, stationsVisited)
-	return stationsVisited, nil
+	arrivalCharge := availableCharge - stops[0].Distance - stops[0].Detour
+	for i, stop := range stops {
+		charge := legCost(i) + needed[i+1] - arrivalCharge
+		if charge < 0 {
+			charge = 0
+		}
+		if charge > stop.Limit {
+			// the stop cannot provide the charge needed. It happens only when the stops are not feasible in the driving order.
+			logger.Warnf("%v :: stop %v needs charge %v more than its limit %v", vin, stop.Name, charge, stop.Limit)
+			charge = stop.Limit
+		}
+		charges[stop] = charge
+		arrivalCharge = arrivalCharge + charge - legCost(i)
+		logger.Debugf("%v :: charging %v at stop %v. charge on arriving next stop %v", vin, charge, stop.Name, arrivalCharge)
+	}
+	return charges
+}
+
+// orderStations sorts the stations in place. The driving order sorts the stations by their distance from the source and then by their names.
+// Any other order sorts the stations by their names and then by their distance from the source.
+func orderStations(stations []*model.Station, order string) {
+	sort.SliceStable(stations, func(i, j int) bool {
+		if order == util.OrderByDriving && stations[i].Distance != stations[j].Distance {
+			return stations[i].Distance < stations[j].Distance
+		}
+		if stations[i].Name != stations[j].Name {
+			return stations[i].Name < stations[j].Name
+		}
+		return stations[i].Distance < stations[j].Distance
+	})
+}
+
+// appliedPreferences states the driver preferences applied to plan the route. requested are the preferences in request and planned are the
+// preferences the route was planned with, which differ when the preferred operators were relaxed. It returns nil if the driver set no preferences.
+func appliedPreferences(requested *model.Preferences, planned *model.Preferences, excludedStations []*model.ResExcludedStation, stationsVisited []*model.Station) *model.ResPreferences {
+	if len(requested.AvoidStations) == 0 && len(requested.AvoidOperators) == 0 && len(requested.PreferOperators) == 0 && requested.MaxStops <= 0 {
+		return nil
+	}
+	applied := &model.ResPreferences{
+		AvoidedOperators:   requested.AvoidOperators,
+		PreferredOperators: planned.PreferOperators,
+		PreferencesRelaxed: len(requested.PreferOperators) > len(planned.PreferOperators),
+	}
+	if requested.MaxStops > 0 {
+		applied.MaxStops = requested.MaxStops
+	}
+	for _, station := range excludedStations {
+		if station.Reason == util.ExclAvoided {
+			applied.AvoidedStations = append(applied.AvoidedStations, station.Name)
+		}
+	}
+	for _, station := range stationsVisited {
+		if containsFold(planned.PreferOperators, station.Operator) {
+			applied.PreferredStops = append(applied.PreferredStops, station.Name)
+		}
+	}
+	return applied
 }
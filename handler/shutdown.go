@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/health"
+)
+
+// draining is set once the service stops taking requests. The health checks fail from then on, so the load balancer stops sending
+// requests while the requests in flight complete.
+var draining int32
+
+var grpcHealth struct {
+	mu      sync.Mutex
+	servers []*health.Server
+}
+
+func trackGRPCHealth(server *health.Server) {
+	grpcHealth.mu.Lock()
+	defer grpcHealth.mu.Unlock()
+	grpcHealth.servers = append(grpcHealth.servers, server)
+	if isDraining() {
+		server.Shutdown()
+	}
+}
+
+func isDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// StartDraining fails the health checks of the HTTP and gRPC APIs. The requests are still served.
+func StartDraining() {
+	atomic.StoreInt32(&draining, 1)
+	grpcHealth.mu.Lock()
+	defer grpcHealth.mu.Unlock()
+	for _, server := range grpcHealth.servers {
+		server.Shutdown()
+	}
+}
+
+// Shutdown stops the background work once the servers are stopped. The job workers complete their running jobs until ctx is done, and
+// the webhook deliveries in flight complete while the ones waiting for a retry are kept for the next start. The queued plans are
+// written until ctx is done and the plan history is closed.
+func Shutdown(ctx context.Context) error {
+	var err error
+	if manager := jobs.manager; manager != nil {
+		err = manager.stop(ctx)
+	}
+	if dispatcher := webhooks.dispatcher; dispatcher != nil {
+		if closeErr := dispatcher.Close(ctx); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	closePlanHistory(ctx)
+	return err
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/routepb"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestDraining(t *testing.T) {
+	conn, closeConn := dialGRPC(t)
+	defer closeConn()
+	StartDraining()
+	defer atomic.StoreInt32(&draining, 0)
+
+	req, _ := http.NewRequest("GET", "/api/health", nil)
+	rr := executeRequest(req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+	if expected := `{"status":"draining"}`; rr.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+
+	res, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{
+		Service: routepb.RouteChecker_ServiceDesc.ServiceName,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("expected the route checker to be not serving but got %v", res.Status)
+	}
+}
+
+// TestJobsStop checks that the stopped workers complete the running job and leave the queued jobs for the next start.
+func TestJobsStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stub := defaultRouteStub()
+	defer stub.use()()
+	var once sync.Once
+	started, unblock := make(chan struct{}), make(chan struct{})
+	stub.onCall = func(endpoint string) {
+		once.Do(func() { close(started) })
+		<-unblock
+	}
+
+	manager, err := newJobManager(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.start(1)
+	var ids []string
+	for i := 0; i < 2; i++ {
+		job, err := manager.submit(&model.JobRequest{
+			Request: &model.Request{Vin: "W1K2062161F0046", Source: "Home", Destination: "Movie Theatre"},
+		}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, job.ID)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := manager.stop(ctx); err == nil {
+		t.Error("expected stop to time out while a job is running")
+	}
+	close(unblock)
+	if err := manager.stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	running, queued := manager.get(ids[0]), manager.get(ids[1])
+	if running.Status != model.JobCompleted || queued.Status != model.JobQueued {
+		t.Errorf("expected one job completed and one queued but got %v and %v", running.Status, queued.Status)
+	}
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/spf13/viper"
+)
+
+// timeNow is the clock of the handlers, used for the departure time of the plans and the expiry of the idempotency keys. It is replaced
+// in tests to fix the time.
+var timeNow = time.Now
+
+// filterStations removes the stations the car cannot or should not charge at before planning the route. A station is excluded when the driver
+// prefers to avoid it or its operator, when it is not available, when it is closed at the estimated time of arrival or when it has no connector
+// supported by the vehicle profile. The arrival time is estimated from the departure time and the configured average speed, counting the detour to the station.
+// It returns the stations eligible for planning and the stations excluded along with the reason.
+func filterStations(ctx context.Context, stations []*model.Station, prefs *model.Preferences, profile *model.VehicleProfile, departure time.Time, vin string) ([]*model.Station, []*model.ResExcludedStation) {
+	logger := requestLogger(ctx)
+	avgSpeed := averageSpeed()
+	eligible := make([]*model.Station, 0, len(stations))
+	excluded := make([]*model.ResExcludedStation, 0)
+	exclude := func(station *model.Station, reason string) {
+		logger.Debugf("%v :: excluding station %v. %v", vin, station.Name, reason)
+		excluded = append(excluded, &model.ResExcludedStation{
+			Name:   station.Name,
+			Reason: reason,
+		})
+	}
+	for _, station := range stations {
+		if containsFold(prefs.AvoidStations, station.Name) || containsFold(prefs.AvoidOperators, station.Operator) {
+			exclude(station, util.ExclAvoided)
+			continue
+		}
+		if station.Available.Valid && !station.Available.Bool {
+			exclude(station, util.ExclUnavailable)
+			continue
+		}
+		if profile != nil && !hasCompatibleConnector(station, profile) {
+			exclude(station, util.ExclIncompatible)
+			continue
+		}
+		hours := float64(station.Distance+station.Detour) / avgSpeed
+		arrival := departure.Add(time.Duration(hours * float64(time.Hour)))
+		open, err := isOpen(station.OpeningHours, arrival)
+		if err != nil {
+			// the station is not excluded for malformed data from upstream
+			logger.Warnf("%v :: invalid opening hours %q for station %v. %v", vin, station.OpeningHours, station.Name, err)
+		} else if !open {
+			exclude(station, util.ExclClosed)
+			continue
+		}
+		eligible = append(eligible, station)
+	}
+	return eligible, excluded
+}
+
+// closedStop returns the first stop in driving order that is closed at the estimated time of arrival once the charging at the earlier stops
+// is counted, or nil when every stop is open. The time to charge at a stop is estimated from the charge taken at the stop and its maximum
+// power. filterStations has already excluded the stations that are closed when the car drives straight to them.
+func closedStop(ctx context.Context, stops []*model.Station, charges map[*model.Station]int64, departure time.Time, vin string) *model.Station {
+	avgSpeed := averageSpeed()
+	drivingOrder := make([]*model.Station, len(stops))
+	copy(drivingOrder, stops)
+	orderStations(drivingOrder, util.OrderByDriving)
+	var charging time.Duration
+	for _, stop := range drivingOrder {
+		hours := float64(stop.Distance+stop.Detour) / avgSpeed
+		arrival := departure.Add(time.Duration(hours*float64(time.Hour)) + charging)
+		// the invalid opening hours were logged by filterStations
+		if open, err := isOpen(stop.OpeningHours, arrival); err == nil && !open {
+			requestLogger(ctx).Debugf("%v :: stop %v is closed on arrival at %v after charging for %v", vin, stop.Name, arrival, charging)
+			return stop
+		}
+		charging += chargingTime(stop, charges[stop])
+	}
+	return nil
+}
+
+// chargingTime estimates the time to take the charge, in miles, at the station. The station charges at its maximum power, or at the
+// configured charging power when the upstream API doesn't report it, and the charge is converted to energy with the configured miles per kWh.
+func chargingTime(station *model.Station, charge int64) time.Duration {
+	power := station.MaxPower
+	if power <= 0 {
+		power = viper.GetFloat64(util.ChargingPower)
+	}
+	if power <= 0 {
+		power = util.DefaultChargePower
+	}
+	milesPerKwh := viper.GetFloat64(util.MilesPerKwh)
+	if milesPerKwh <= 0 {
+		milesPerKwh = util.DefaultMilesPerKwh
+	}
+	hours := float64(charge) / milesPerKwh / power
+	return time.Duration(hours * float64(time.Hour))
+}
+
+// averageSpeed returns the configured average speed in miles per hour used to estimate the arrival at the stations.
+func averageSpeed() float64 {
+	if speed := viper.GetFloat64(util.AverageSpeed); speed > 0 {
+		return speed
+	}
+	return util.DefaultAvgSpeed
+}
+
+// hasCompatibleConnector checks if the station has at least one connector supported by the vehicle. Connector types are compared case insensitively.
+// A station that doesn't list its connectors is considered compatible.
+func hasCompatibleConnector(station *model.Station, profile *model.VehicleProfile) bool {
+	if len(station.Connectors) == 0 {
+		return true
+	}
+	for _, connector := range station.Connectors {
+		for _, supported := range profile.Connectors {
+			if strings.EqualFold(connector, supported) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsFold checks if the list contains the value, comparing case insensitively. An empty value is never contained.
+func containsFold(list []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOpen checks if the time t falls in the opening hours given in "HH:MM-HH:MM" format. An empty value means the station is always open.
+// Opening hours that end before they start span midnight, for example "22:00-06:00".
+func isOpen(openingHours string, t time.Time) (bool, error) {
+	if openingHours == "" {
+		return true, nil
+	}
+	window := strings.Split(openingHours, "-")
+	if len(window) != 2 {
+		return false, fmt.Errorf("expected format HH:MM-HH:MM")
+	}
+	opens, err := minuteOfDay(window[0])
+	if err != nil {
+		return false, err
+	}
+	closes, err := minuteOfDay(window[1])
+	if err != nil {
+		return false, err
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if opens <= closes {
+		return minute >= opens && minute < closes, nil
+	}
+	return minute >= opens || minute < closes, nil
+}
+
+// minuteOfDay parses a time given in HH:MM format into the minutes elapsed since midnight. "24:00" is accepted as the end of the day.
+func minuteOfDay(value string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(strings.TrimSpace(value), "%d:%d", &hour, &minute); err != nil {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute > 0) {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return hour*60 + minute, nil
+}
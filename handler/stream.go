@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type progressKey struct{}
+
+// progressListener receives each step of computeTravel as it completes, with the data of the step.
+type progressListener func(phase string, data interface{})
+
+// withProgress returns a copy of ctx that reports the progress of computeTravel to listener.
+func withProgress(ctx context.Context, listener progressListener) context.Context {
+	return context.WithValue(ctx, progressKey{}, listener)
+}
+
+// reportProgress reports the step to the progress listener in ctx. It does nothing if there is no listener.
+func reportProgress(ctx context.Context, phase string, data interface{}) {
+	if listener, ok := ctx.Value(progressKey{}).(progressListener); ok {
+		listener(phase, data)
+	}
+}
+
+// batchListener receives each step of the requests of a batch as it completes, with the index of the request in the batch.
+type batchListener func(index int, phase string, data interface{})
+
+type progressEvent struct {
+	phase string
+	data  interface{}
+}
+
+// HandleFuelCheckStream computes the travel like HandleFuelCheck and streams each step as a server-sent event as it completes.
+// The events are the charge level, the distance, the charging stations and the planned stops, ending with the response. Some events
+// are not sent when the travel doesn't need them or fails before them. When the client disconnects, the remaining steps are cancelled.
+func HandleFuelCheckStream(c *gin.Context) {
+	var reqBody model.Request
+	if err := c.ShouldBindBodyWith(&reqBody, binding.JSON); err != nil {
+		abortInvalidRequest(c, err)
+		return
+	}
+	transId := transactionId(c)
+	streamEvents(c, func(ctx context.Context, send progressListener) {
+		response, _ := computeTravel(withProgress(ctx, send), tenantFrom(ctx).provider, &reqBody, transId)
+		if ctx.Err() != nil {
+			requestLogger(ctx).Warnf("%v :: client disconnected from stream of transaction %v", reqBody.Vin, transId)
+			return
+		}
+		send(util.PhaseResponse, response)
+	})
+}
+
+// HandleBatchFuelCheckStream computes the batch like HandleBatchFuelCheck and streams the steps of each request as server-sent events
+// as they complete, with the index of the request in the batch as {"index": 0, "data": ...}. The response event of a request is its
+// batch item, and the stream ends with the summary of the batch. When the client disconnects, the remaining steps are cancelled.
+func HandleBatchFuelCheckStream(c *gin.Context) {
+	items, ok := bindBatch(c)
+	if !ok {
+		return
+	}
+	streamEvents(c, func(ctx context.Context, send progressListener) {
+		listener := func(index int, phase string, data interface{}) {
+			if phase == util.PhaseResponse {
+				send(phase, data)
+				return
+			}
+			send(phase, &model.BatchProgress{Index: index, Data: data})
+		}
+		response := computeBatch(ctx, tenantFrom(ctx).provider, items, listener)
+		if ctx.Err() != nil {
+			requestLogger(ctx).Warnf("client disconnected from stream of batch of %v requests", len(items))
+			return
+		}
+		send(util.PhaseSummary, response.Summary)
+	})
+}
+
+// streamEvents runs compute in the background and streams the events it sends as server-sent events until it returns. The events are
+// no longer sent once the client disconnects.
+func streamEvents(c *gin.Context, compute func(ctx context.Context, send progressListener)) {
+	ctx := c.Request.Context()
+	events := make(chan progressEvent)
+	send := func(phase string, data interface{}) {
+		select {
+		case events <- progressEvent{phase: phase, data: data}:
+		case <-ctx.Done():
+		}
+	}
+	go func() {
+		defer close(events)
+		compute(ctx, send)
+	}()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	for event := range events {
+		c.SSEvent(event.phase, event.data)
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+)
+
+func TestFuelCheckStream(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+
+	req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiComputeStream), bytes.NewBufferString(reqTestCase4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := executeRequest(req)
+	if contentType := rr.Header().Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("expected content type text/event-stream but got %v", contentType)
+	}
+
+	phases, data := readEvents(rr.Body.String())
+	expected := []string{util.PhaseChargeLevel, util.PhaseDistance, util.PhaseStations, util.PhasePlan, util.PhaseResponse}
+	if strings.Join(phases, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected events %v but got %v", expected, phases)
+	}
+	response := &model.Response{}
+	if err := json.Unmarshal([]byte(data[len(data)-1]), response); err != nil {
+		t.Fatal(err)
+	}
+	if !response.IsChargingRequired.Bool || len(response.ChargingStations) != 2 {
+		t.Errorf("response should charge at S1 and S2. got %v", response.ChargingStations)
+	}
+}
+
+// TestFuelCheckStreamDisconnect checks that the remaining steps are not computed once the client disconnects.
+func TestFuelCheckStreamDisconnect(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0046"] = 17
+	stub.distances[routeKey("Home", "Movie Theatre")] = 50
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stub.onCall = func(endpoint string) {
+		if endpoint == "charge_level" {
+			cancel()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, ReqPost, computeBaseUrl(util.ApiComputeStream), bytes.NewBufferString(reqTestCase4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := executeRequest(req)
+	if phases, _ := readEvents(rr.Body.String()); len(phases) != 0 {
+		t.Errorf("no events should be sent after disconnect. got %v", phases)
+	}
+	if calls := stub.callCount("distance"); calls != 0 {
+		t.Errorf("travel distance shouldn't be retrieved after disconnect. got %v calls", calls)
+	}
+}
+
+// readEvents parses the server-sent events in body into their names and data.
+func readEvents(body string) ([]string, []string) {
+	phases := make([]string, 0)
+	data := make([]string, 0)
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event:") {
+			phases = append(phases, strings.TrimPrefix(line, "event:"))
+		}
+		if strings.HasPrefix(line, "data:") {
+			data = append(data, strings.TrimPrefix(line, "data:"))
+		}
+	}
+	return phases, data
+}
+
+func TestBatchFuelCheckStream(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+
+	batch := `[` + reqTestCase4 + `, "not a request"]`
+	req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiBatchStream), bytes.NewBufferString(batch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := executeRequest(req)
+	phases, data := readEvents(rr.Body.String())
+	if len(phases) == 0 || phases[len(phases)-1] != util.PhaseSummary {
+		t.Fatalf("expected the stream to end with the summary but got %v", phases)
+	}
+	steps := make([]string, 0)
+	items := make(map[int]*model.BatchItem)
+	for i, phase := range phases[:len(phases)-1] {
+		if phase == util.PhaseResponse {
+			item := &model.BatchItem{}
+			if err := json.Unmarshal([]byte(data[i]), item); err != nil {
+				t.Fatal(err)
+			}
+			items[item.Index] = item
+			continue
+		}
+		progress := &model.BatchProgress{}
+		if err := json.Unmarshal([]byte(data[i]), progress); err != nil || progress.Index != 0 {
+			t.Errorf("expected the steps of the first request but got %v. %v", data[i], err)
+		}
+		steps = append(steps, phase)
+	}
+	expected := []string{util.PhaseChargeLevel, util.PhaseDistance, util.PhaseStations, util.PhasePlan}
+	if strings.Join(steps, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected the steps %v but got %v", expected, steps)
+	}
+	if len(items) != 2 || items[0].Response == nil || len(items[0].Response.ChargingStations) != 2 || items[1].Error != "invalid request" {
+		t.Errorf("expected the result of each request but got %+v", items)
+	}
+	summary := &model.BatchSummary{}
+	if err := json.Unmarshal([]byte(data[len(data)-1]), summary); err != nil || summary.Total != 2 || summary.Failed != 1 {
+		t.Errorf("expected the summary of the batch but got %+v. %v", summary, err)
+	}
+}
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/SDJLee/mercedes-benz/breaker"
+	"github.com/SDJLee/mercedes-benz/loadshed"
+	"github.com/SDJLee/mercedes-benz/metrics"
+	"github.com/SDJLee/mercedes-benz/model"
+	tenantconfig "github.com/SDJLee/mercedes-benz/tenant"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type tenantKey struct{}
+
+var errTenantConfig = errors.New("invalid tenant config")
+
+// tenant serves the requests of a tenant with the provider for its upstream API, and its own circuit breakers, compute limiter, vehicle
+// profiles and rate limits. Its idempotency keys and rate limit buckets are namespaced by its ID and its metrics are prefixed. The default tenant
+// serves the requests of no tenant with the global settings, without a namespace or a prefix, like a deployment without tenants.
+type tenant struct {
+	id       string
+	config   *tenantconfig.Tenant
+	provider provider
+	breakers map[string]*breaker.Breaker
+	limiter  *loadshed.Limiter
+	profiles *vehicleProfiles
+	rules    map[string][]*rateRule
+	stats    metrics.Prefix
+}
+
+// tenantSet are the configured tenants by ID and by the IDs of their clients.
+type tenantSet struct {
+	byId     map[string]*tenant
+	byClient map[string]*tenant
+}
+
+var defaultTenant = newDefaultTenant()
+
+var tenancy struct {
+	once    sync.Once
+	tenants *tenantSet
+	err     error
+}
+
+func newDefaultTenant() *tenant {
+	t := &tenant{profiles: &profiles}
+	t.provider = apiProvider{tenant: t}
+	return t
+}
+
+// getTenants returns the tenants of the TENANTS_PATH file. There are none when it is not set. An invalid file is an error, so that the
+// requests of a tenant are not served with the settings of another.
+func getTenants() (*tenantSet, error) {
+	tenancy.once.Do(func() {
+		tenancy.tenants, tenancy.err = loadTenants()
+		if tenancy.err != nil {
+			logger.Error("failed to load tenants. the requests of tenants will be rejected", tenancy.err)
+			tenancy.tenants = &tenantSet{}
+		}
+	})
+	return tenancy.tenants, tenancy.err
+}
+
+func loadTenants() (*tenantSet, error) {
+	set := &tenantSet{byId: make(map[string]*tenant), byClient: make(map[string]*tenant)}
+	path := viper.GetString(util.TenantsPath)
+	if path == "" {
+		return set, nil
+	}
+	configs, err := tenantconfig.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range configs {
+		t, err := newTenant(config)
+		if err != nil {
+			return nil, err
+		}
+		set.byId[t.id] = t
+		for _, client := range config.Clients {
+			set.byClient[client] = t
+		}
+	}
+	return set, nil
+}
+
+func newTenant(config *tenantconfig.Tenant) (*tenant, error) {
+	t := &tenant{id: config.ID, config: config, profiles: &vehicleProfiles{}, stats: metrics.Prefix(config.MetricPrefix)}
+	if config.RateLimits != "" {
+		rules, err := parseRateLimits(config.RateLimits)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %v has invalid rate limits. %v", config.ID, err)
+		}
+		t.rules = rules
+	}
+	t.breakers = newUpstreamBreakers(config.ID, t.stats)
+	t.limiter = newComputeLimiter(t.stats)
+	t.provider = apiProvider{tenant: t}
+	return t, nil
+}
+
+// tenantById returns the tenant with the id, or the default tenant for the empty id.
+func tenantById(id string) (*tenant, error) {
+	if id == "" {
+		return defaultTenant, nil
+	}
+	tenants, err := getTenants()
+	if err != nil {
+		return nil, errTenantConfig
+	}
+	t, ok := tenants.byId[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown tenant %q", id)
+	}
+	return t, nil
+}
+
+// resolveTenant returns the tenant of the request. An authenticated client that belongs to a tenant is served as its tenant, and can't
+// ask for another. An authenticated client that belongs to no tenant is served as the default tenant, and can't ask for any, so that
+// it can't use the upstream credentials, limits and jobs of a tenant. With authentication disabled, the requests are served as the
+// tenant asked for in header, if any, or as the default tenant.
+func resolveTenant(ctx context.Context, header string) (*tenant, *travelError) {
+	tenants, err := getTenants()
+	if err != nil {
+		return nil, &travelError{code: util.ErrCodeInternal, err: errTenantConfig}
+	}
+	if clientId, ok := clientIdFrom(ctx); ok {
+		t, ok := tenants.byClient[clientId]
+		if !ok {
+			if header != "" {
+				return nil, &travelError{code: util.ErrCodeForbidden, err: fmt.Errorf("client %v belongs to no tenant", clientId)}
+			}
+			return defaultTenant, nil
+		}
+		if header != "" && header != t.id {
+			return nil, &travelError{code: util.ErrCodeForbidden, err: fmt.Errorf("client %v belongs to tenant %v", clientId, t.id)}
+		}
+		return t, nil
+	}
+	t, err := tenantById(header)
+	if err != nil {
+		return nil, &travelError{code: util.ErrCodeInvalidReq, err: err}
+	}
+	return t, nil
+}
+
+// TenantMiddleware serves the request as the tenant of the authenticated client or the tenant in the X-Tenant-Id header. The tenant is
+// available to the logs of the request with requestLogger. It should come after AuthMiddleware and before the middlewares that keep
+// state for the request, such as RateLimitMiddleware and IdempotencyMiddleware. reject responds to the requests of an unknown tenant.
+func TenantMiddleware(reject func(c *gin.Context, failure *travelError)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t, failure := resolveTenant(c.Request.Context(), c.GetHeader(util.TenantHeader))
+		if failure != nil {
+			reject(c, failure)
+			c.Abort()
+			return
+		}
+		if t.id != "" {
+			c.Set(util.TenantKey, t.id)
+		}
+		c.Request = c.Request.WithContext(withTenant(c.Request.Context(), t))
+		c.Next()
+	}
+}
+
+// grpcTenant serves the call as a tenant like TenantMiddleware, by the authenticated client or the x-tenant-id header. The public
+// methods are served as the default tenant.
+func grpcTenant(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if _, ok := grpcScopes[info.FullMethod]; !ok {
+		return handler(ctx, req)
+	}
+	var header string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(util.GrpcTenantKey); len(values) > 0 {
+		header = values[0]
+	}
+	t, failure := resolveTenant(ctx, header)
+	if failure != nil {
+		transId, _ := transactionIdFrom(ctx)
+		return nil, grpcStatus(failure, nil, transId)
+	}
+	return handler(withTenant(ctx, t), req)
+}
+
+func withTenant(ctx context.Context, t *tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// tenantFrom returns the tenant of the request in the context, or the default tenant.
+func tenantFrom(ctx context.Context) *tenant {
+	if t, ok := ctx.Value(tenantKey{}).(*tenant); ok {
+		return t
+	}
+	return defaultTenant
+}
+
+// apiAddress returns the address of the upstream API of the tenant.
+func (t *tenant) apiAddress() string {
+	if t.config == nil {
+		return viper.GetString(util.ApiAddress)
+	}
+	return t.config.ApiAddress
+}
+
+// upstreamHeaders returns the headers with the credentials of the tenant for its upstream API, if any.
+func (t *tenant) upstreamHeaders() map[string]string {
+	if t.config == nil || t.config.ApiKey == "" {
+		return nil
+	}
+	return map[string]string{util.ApiKeyHeader: t.config.ApiKey}
+}
+
+func (t *tenant) breaker(endpoint string) *breaker.Breaker {
+	if t.breakers == nil {
+		return getBreaker(endpoint)
+	}
+	return t.breakers[endpoint]
+}
+
+// computeLimiter returns the limiter of the travels of the tenant computed at once.
+func (t *tenant) computeLimiter() *loadshed.Limiter {
+	if t.limiter == nil {
+		return getComputeLimiter()
+	}
+	return t.limiter
+}
+
+// vehicleProfile returns the profile of the vin from the vehicle profiles of the tenant, or the global ones when it has none.
+func (t *tenant) vehicleProfile(vin string) *model.VehicleProfile {
+	path := viper.GetString(util.VehicleProfiles)
+	if t.config != nil && t.config.VehicleProfiles != "" {
+		path = t.config.VehicleProfiles
+	}
+	return t.profiles.match(vin, path)
+}
+
+// rateRules returns the rate limits of the tenant, or the global ones when it has none.
+func (t *tenant) rateRules(global map[string][]*rateRule) map[string][]*rateRule {
+	if t.rules != nil {
+		return t.rules
+	}
+	return global
+}
+
+// namespace prefixes the key of a cache with the ID of the tenant, so that the tenants don't share entries.
+func (t *tenant) namespace(key string) string {
+	if t.id == "" {
+		return key
+	}
+	return t.id + ":" + key
+}
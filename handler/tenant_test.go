@@ -0,0 +1,463 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/ratelimit"
+	"github.com/SDJLee/mercedes-benz/routepb"
+	tenantconfig "github.com/SDJLee/mercedes-benz/tenant"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const tenantPayload = `{ "vin": "W1K2062161F0046", "source": "Home", "destination": "Movie Theatre" }`
+
+// useTenants writes the tenants into the tenants file. It returns a function that removes them.
+func useTenants(t *testing.T, tenants ...*tenantconfig.Tenant) func() {
+	path := filepath.Join(testDir, "tenants.json")
+	writeJSON(t, path, tenants)
+	viper.Set(util.TenantsPath, path)
+	resetTenants()
+	return func() {
+		viper.Set(util.TenantsPath, "")
+		resetTenants()
+	}
+}
+
+func resetTenants() {
+	tenancy.once = sync.Once{}
+	tenancy.tenants, tenancy.err = nil, nil
+}
+
+// executeAsTenant posts the payload to the url from the same IP with the headers and the tenant in the X-Tenant-Id header, if any.
+func executeAsTenant(t *testing.T, url string, tenantId string, payload string, header http.Header) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(ReqPost, url, bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "10.0.0.1:40000"
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if tenantId != "" {
+		req.Header.Set(util.TenantHeader, tenantId)
+	}
+	return executeRequest(req)
+}
+
+// tenantStubs returns the upstream stubs of brand-a, where the VIN needs charging, and brand-b, where it doesn't.
+func tenantStubs() (*upstreamStub, *upstreamStub) {
+	brandA, brandB := defaultRouteStub(), defaultRouteStub()
+	brandB.chargeLevels["W1K2062161F0046"] = 60
+	return brandA, brandB
+}
+
+func TestTenantUpstream(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	brandA, brandB := tenantStubs()
+	defer brandA.Close()
+	defer brandB.Close()
+	var mu sync.Mutex
+	var apiKeys []string
+	handler := brandA.Config.Handler
+	brandA.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		apiKeys = append(apiKeys, r.Header.Get(util.ApiKeyHeader))
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	})
+	defer useTenants(t,
+		&tenantconfig.Tenant{ID: "brand-a", ApiAddress: brandA.URL, ApiKey: "brand-a-upstream-key"},
+		&tenantconfig.Tenant{ID: "brand-b", ApiAddress: brandB.URL},
+	)()
+
+	url := computeBaseUrl(util.ApiComputeRoute)
+	for _, test := range []struct {
+		tenant   string
+		stub     *upstreamStub
+		charging bool
+	}{{"brand-a", brandA, true}, {"brand-b", brandB, false}, {"", stub, true}} {
+		rr := executeAsTenant(t, url, test.tenant, tenantPayload, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("tenant %q: handler returned wrong status code: got %v want %v", test.tenant, rr.Code, http.StatusOK)
+		}
+		response := &model.Response{}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatal(err)
+		}
+		if response.IsChargingRequired.Bool != test.charging {
+			t.Errorf("tenant %q: expected charging required to be %v", test.tenant, test.charging)
+		}
+		if calls := test.stub.callCount("charge_level"); calls != 1 {
+			t.Errorf("tenant %q: expected its upstream to be called once but got %v", test.tenant, calls)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range apiKeys {
+		if key != "brand-a-upstream-key" {
+			t.Errorf("expected the upstream key of the tenant but got %q", key)
+		}
+	}
+}
+
+func TestTenantResolution(t *testing.T) {
+	brandA, brandB := tenantStubs()
+	defer brandA.Close()
+	defer brandB.Close()
+	defer useTenants(t,
+		&tenantconfig.Tenant{ID: "brand-a", ApiAddress: brandA.URL, Clients: []string{"fleet-app"}},
+		&tenantconfig.Tenant{ID: "brand-b", ApiAddress: brandB.URL},
+	)()
+
+	rr := executeAsTenant(t, computeBaseUrl(util.ApiComputeRoute), "unknown", tenantPayload, nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown tenant to be rejected but got %v", rr.Code)
+	}
+	rr = executeAsTenant(t, util.ApiBasePath+util.ApiV2+util.ApiComputeRoute, "unknown", tenantPayload, nil)
+	problem := &model.Problem{}
+	if err := json.Unmarshal(rr.Body.Bytes(), problem); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusBadRequest || problem.Code != util.ErrCodeInvalidReq {
+		t.Errorf("expected an invalid request problem but got %v %v", rr.Code, problem.Code)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer useAuth(t, key)()
+	header := http.Header{util.ApiKeyHeader: {testApiKey}}
+	if rr := executeAsTenant(t, computeBaseUrl(util.ApiComputeRoute), "", tenantPayload, header); rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if calls := brandA.callCount("charge_level"); calls != 1 {
+		t.Errorf("expected the client to be served as its tenant but got %v calls", calls)
+	}
+	if rr := executeAsTenant(t, computeBaseUrl(util.ApiComputeRoute), "brand-b", tenantPayload, header); rr.Code != http.StatusForbidden {
+		t.Errorf("expected the client to be forbidden another tenant but got %v", rr.Code)
+	}
+
+	conn, closeConn := dialGRPC(t)
+	defer closeConn()
+	client := routepb.NewRouteCheckerClient(conn)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), util.GrpcApiKeyKey, testApiKey, util.GrpcTenantKey, "brand-b")
+	_, err = client.ComputeRoute(ctx, &routepb.ComputeRouteRequest{Vin: "W1K2062161F0046", Source: "Home", Destination: "Movie Theatre"})
+	if code := status.Code(err); code != codes.PermissionDenied {
+		t.Errorf("expected code %v but got %v", codes.PermissionDenied, err)
+	}
+}
+
+func TestTenantUnassignedClient(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	brandA, brandB := tenantStubs()
+	defer brandA.Close()
+	defer brandB.Close()
+	defer useTenants(t,
+		&tenantconfig.Tenant{ID: "brand-a", ApiAddress: brandA.URL, ApiKey: "brand-a-upstream-key"},
+		&tenantconfig.Tenant{ID: "brand-b", ApiAddress: brandB.URL, Clients: []string{"brand-b-app"}},
+	)()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer useAuth(t, key)()
+
+	// fleet-app belongs to no tenant, so it is served with the global settings and can't ask for a tenant
+	header := http.Header{util.ApiKeyHeader: {testApiKey}}
+	if rr := executeAsTenant(t, computeBaseUrl(util.ApiComputeRoute), "brand-a", tenantPayload, header); rr.Code != http.StatusForbidden {
+		t.Errorf("expected the client of no tenant to be forbidden brand-a but got %v", rr.Code)
+	}
+	if rr := executeAsTenant(t, computeBaseUrl(util.ApiComputeRoute), "", tenantPayload, header); rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if calls := brandA.callCount("charge_level"); calls != 0 {
+		t.Errorf("expected the upstream of brand-a not to be called but got %v calls", calls)
+	}
+	if calls := stub.callCount("charge_level"); calls != 1 {
+		t.Errorf("expected the global upstream to be called but got %v calls", calls)
+	}
+	// nor read the jobs of a tenant
+	req, _ := http.NewRequest("GET", computeBaseUrl(util.ApiJobs)+"/unknown", nil)
+	req.Header.Set(util.ApiKeyHeader, testBatchApiKey)
+	req.Header.Set(util.TenantHeader, "brand-a")
+	if rr := executeRequest(req); rr.Code != http.StatusForbidden {
+		t.Errorf("expected the client of no tenant to be forbidden the jobs of brand-a but got %v", rr.Code)
+	}
+
+	conn, closeConn := dialGRPC(t)
+	defer closeConn()
+	client := routepb.NewRouteCheckerClient(conn)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), util.GrpcApiKeyKey, testApiKey, util.GrpcTenantKey, "brand-a")
+	_, err = client.ComputeRoute(ctx, &routepb.ComputeRouteRequest{Vin: "W1K2062161F0046", Source: "Home", Destination: "Movie Theatre"})
+	if code := status.Code(err); code != codes.PermissionDenied {
+		t.Errorf("expected code %v but got %v", codes.PermissionDenied, err)
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	brandA, brandB := tenantStubs()
+	defer brandA.Close()
+	defer brandB.Close()
+	defer useRateLimits(t, ratelimit.NewMemory(), "")()
+	defer useTenants(t,
+		&tenantconfig.Tenant{ID: "brand-a", ApiAddress: brandA.URL, RateLimits: "compute-route:ip=1/m"},
+		&tenantconfig.Tenant{ID: "brand-b", ApiAddress: brandB.URL},
+	)()
+	url := computeBaseUrl(util.ApiComputeRoute)
+
+	// the same idempotency key is not replayed to another tenant
+	header := http.Header{util.IdempotencyHeader: {"same-key"}}
+	if rr := executeAsTenant(t, url, "brand-a", tenantPayload, header); rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	rr := executeAsTenant(t, url, "brand-b", tenantPayload, header)
+	if rr.Code != http.StatusOK || rr.Header().Get(util.IdempotentReplayed) != "" {
+		t.Errorf("expected the request of another tenant not to be replayed but got %v", rr.Code)
+	}
+
+	// only brand-a is rate limited
+	if rr := executeAsTenant(t, url, "brand-a", tenantPayload, nil); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the tenant to be rate limited but got %v", rr.Code)
+	}
+	if rr := executeAsTenant(t, url, "brand-b", tenantPayload, nil); rr.Code != http.StatusOK {
+		t.Errorf("expected another tenant not to be rate limited but got %v", rr.Code)
+	}
+
+	// a failing upstream of brand-b doesn't open the circuit breakers of the other tenants
+	tenant, err := tenantById("brand-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < util.DefaultBrkFailures; i++ {
+		tenant.breaker(util.EndpointCharge).Allow()
+		tenant.breaker(util.EndpointCharge).Done(false)
+	}
+	states := breakerStates()
+	if states["brand-b/"+util.EndpointCharge] != "open" || states["brand-a/"+util.EndpointCharge] != "closed" ||
+		states[util.EndpointCharge] != "closed" {
+		t.Errorf("unexpected breaker states %v", states)
+	}
+	calls := brandB.callCount("charge_level")
+	if rr := executeAsTenant(t, url, "brand-b", tenantPayload, nil); rr.Code != http.StatusOK {
+		t.Errorf("expected the failure to be responded with the 9999 error but got %v", rr.Code)
+	}
+	if calls := brandB.callCount("charge_level") - calls; calls != 0 {
+		t.Errorf("expected the open breaker to reject the call but got %v calls", calls)
+	}
+}
+
+func TestTenantJobs(t *testing.T) {
+	brandA, brandB := tenantStubs()
+	defer brandA.Close()
+	defer brandB.Close()
+	defer useTenants(t,
+		&tenantconfig.Tenant{ID: "brand-a", ApiAddress: brandA.URL},
+		&tenantconfig.Tenant{ID: "brand-b", ApiAddress: brandB.URL},
+	)()
+	// the jobs are kept queued by a manager without workers
+	manager, err := newJobManager(filepath.Join(testDir, "tenant-jobs"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getJobManager()
+	previous := jobs.manager
+	jobs.manager = manager
+	defer func() { jobs.manager = previous }()
+
+	rr := executeAsTenant(t, computeBaseUrl(util.ApiJobs), "brand-a", `{"request": `+tenantPayload+`}`, nil)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+	job := &model.Job{}
+	if err := json.Unmarshal(rr.Body.Bytes(), job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Tenant != "brand-a" {
+		t.Errorf("expected the job of brand-a but got %q", job.Tenant)
+	}
+	for tenantId, code := range map[string]int{"brand-a": http.StatusOK, "brand-b": http.StatusNotFound, "": http.StatusNotFound} {
+		req, _ := http.NewRequest("GET", computeBaseUrl(util.ApiJobs)+"/"+job.ID, nil)
+		if tenantId != "" {
+			req.Header.Set(util.TenantHeader, tenantId)
+		}
+		if rr := executeRequest(req); rr.Code != code {
+			t.Errorf("tenant %q: expected status %v but got %v", tenantId, code, rr.Code)
+		}
+	}
+}
+
+func TestTenantInvalidConfig(t *testing.T) {
+	for _, tenants := range [][]*tenantconfig.Tenant{
+		{{ID: "brand a", ApiAddress: "http://localhost"}},
+		{{ID: "brand-a"}},
+		{{ID: "brand-a", ApiAddress: "http://localhost"}, {ID: "brand-a", ApiAddress: "http://localhost"}},
+		{{ID: "brand-a", ApiAddress: "http://localhost", Clients: []string{"fleet-app"}},
+			{ID: "brand-b", ApiAddress: "http://localhost", Clients: []string{"fleet-app"}}},
+		{{ID: "brand-a", ApiAddress: "http://localhost", RateLimits: "compute-route:user=1/s"}},
+	} {
+		restore := useTenants(t, tenants...)
+		rr := executeAsTenant(t, computeBaseUrl(util.ApiComputeRoute), "", tenantPayload, nil)
+		restore()
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("expected the invalid tenants %v to fail the requests but got %v", tenants[0].ID, rr.Code)
+		}
+	}
+
+	tenants := []*tenantconfig.Tenant{{ID: "brand-a", ApiAddress: "http://localhost"}}
+	if err := tenantconfig.Validate(tenants); err != nil || tenants[0].MetricPrefix != "tenants.brand-a" {
+		t.Errorf("expected the default metric prefix but got %q %v", tenants[0].MetricPrefix, err)
+	}
+}
+
+func TestTenantReplay(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	brandA, brandB := tenantStubs()
+	defer brandA.Close()
+	defer brandB.Close()
+	removeTenants := useTenants(t,
+		&tenantconfig.Tenant{ID: "brand-a", ApiAddress: brandA.URL},
+		&tenantconfig.Tenant{ID: "brand-b", ApiAddress: brandB.URL},
+	)
+	defer removeTenants()
+
+	rr := executeAsTenant(t, computeBaseUrl(util.ApiComputeRoute), "brand-a", tenantPayload, nil)
+	transId := rr.Header().Get(util.TransactionHeader)
+	store := getPlanHistory()
+	flushPlans()
+	id, _ := strconv.ParseInt(transId, 10, 64)
+	record, err := store.Get(id)
+	if err != nil || record == nil || record.Tenant != "brand-a" {
+		t.Fatalf("expected the plan of brand-a to be kept but got %+v %v", record, err)
+	}
+
+	replay, err := ReplayPlan("brand-a", id, "")
+	if err != nil || len(replay.Differences) != 0 {
+		t.Errorf("expected the plan to be replayed as brand-a but got %+v %v", replay, err)
+	}
+
+	// the plan of a tenant that was removed can't be replayed as another tenant
+	removeTenants()
+	useTenants(t, &tenantconfig.Tenant{ID: "brand-b", ApiAddress: brandB.URL})
+	if _, err := ReplayPlan("brand-a", id, ""); err == nil {
+		t.Error("expected the plan of an unknown tenant not to be replayed")
+	}
+}
+
+func TestTenantPlans(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	brandA, brandB := tenantStubs()
+	defer brandA.Close()
+	defer brandB.Close()
+	defer useTenants(t,
+		&tenantconfig.Tenant{ID: "brand-a", ApiAddress: brandA.URL},
+		&tenantconfig.Tenant{ID: "brand-b", ApiAddress: brandB.URL},
+	)()
+
+	rr := executeAsTenant(t, computeBaseUrl(util.ApiComputeRoute), "brand-a", tenantPayload, nil)
+	transId := rr.Header().Get(util.TransactionHeader)
+	flushPlans()
+
+	// the plans of brand-a are not listed, read or replayed by brand-b
+	get := func(tenantId string, url string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set(util.TenantHeader, tenantId)
+		return executeRequest(req)
+	}
+	planUrl := computeBaseUrl(util.ApiPlans + "/" + transId)
+	if rr := get("brand-a", planUrl); rr.Code != http.StatusOK {
+		t.Errorf("expected the plan to be found by brand-a but got %v", rr.Code)
+	}
+	if rr := get("brand-b", planUrl); rr.Code != http.StatusNotFound {
+		t.Errorf("expected the plan not to be found by brand-b but got %v", rr.Code)
+	}
+	for tenantId, count := range map[string]int{"brand-a": 1, "brand-b": 0} {
+		page := &model.PlanPage{}
+		rr := get(tenantId, computeBaseUrl(util.ApiPlans+"?vin=W1K2062161F0046&limit=500"))
+		if err := json.Unmarshal(rr.Body.Bytes(), page); err != nil {
+			t.Fatal(err)
+		}
+		found := 0
+		for _, plan := range page.Plans {
+			if strconv.FormatInt(plan.TransactionID, 10) == transId {
+				found++
+			}
+			if plan.Tenant != tenantId {
+				t.Errorf("expected only the plans of %v but got one of %q", tenantId, plan.Tenant)
+			}
+		}
+		if found != count {
+			t.Errorf("expected %v to list the plan %v times but got %v", tenantId, count, found)
+		}
+	}
+	replayUrl := computeBaseUrl(strings.Replace(util.ApiPlanReplay, ":id", transId, 1))
+	if rr := executeAsTenant(t, replayUrl, "brand-b", "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("expected the plan not to be replayed by brand-b but got %v", rr.Code)
+	}
+	if rr := executeAsTenant(t, replayUrl, "brand-a", "", nil); rr.Code != http.StatusOK {
+		t.Errorf("expected the plan to be replayed by brand-a but got %v", rr.Code)
+	}
+}
+
+func TestTenantComputeLimiter(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	brandA, brandB := tenantStubs()
+	defer brandA.Close()
+	defer brandB.Close()
+	brandA.status = http.StatusServiceUnavailable
+	defer useTenants(t,
+		&tenantconfig.Tenant{ID: "brand-a", ApiAddress: brandA.URL},
+		&tenantconfig.Tenant{ID: "brand-b", ApiAddress: brandB.URL},
+	)()
+
+	// the failures of the upstream API of brand-a cut its own limit only
+	url := computeBaseUrl(util.ApiComputeRoute)
+	defaultLimit := getComputeLimiter().Stats().Limit
+	for i := 0; i < 3; i++ {
+		executeAsTenant(t, url, "brand-a", tenantPayload, nil)
+	}
+	brandATenant, err := tenantById("brand-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	brandBTenant, err := tenantById("brand-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit := brandATenant.computeLimiter().Stats().Limit; limit >= util.DefaultConcLimit {
+		t.Errorf("expected the limit of brand-a to be cut but got %v", limit)
+	}
+	if limit := brandBTenant.computeLimiter().Stats().Limit; limit != util.DefaultConcLimit {
+		t.Errorf("expected the limit of brand-b to be kept but got %v", limit)
+	}
+	if limit := getComputeLimiter().Stats().Limit; limit != defaultLimit {
+		t.Errorf("expected the limit of the default tenant to be kept at %v but got %v", defaultLimit, limit)
+	}
+	if rr := executeAsTenant(t, url, "brand-b", tenantPayload, nil); rr.Code != http.StatusOK {
+		t.Errorf("expected brand-b to be served but got %v", rr.Code)
+	}
+}
@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/auth"
+	"github.com/SDJLee/mercedes-benz/routepb"
+	"github.com/SDJLee/mercedes-benz/tlsconfig"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const testClientSubject = "CN=fleet-app,O=Acme"
+
+// testPKI is a CA with the server certificate and the client certificate it issued, written as PEM files in dir.
+type testPKI struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	pool   *x509.CertPool
+	client tls.Certificate
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir, err := ioutil.TempDir(testDir, "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pki := &testPKI{dir: dir}
+	pki.caKey, pki.ca = pki.issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, 1)
+	pki.pool = x509.NewCertPool()
+	pki.pool.AddCert(pki.ca)
+	pki.writePEM(t, "ca.pem", "CERTIFICATE", pki.ca.Raw)
+	pki.writeServerCert(t, 2)
+
+	clientKey, client := pki.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "fleet-app", Organization: []string{"Acme"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, 3)
+	pki.client = tls.Certificate{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey}
+	return pki
+}
+
+// issue signs the template with the CA, or self-signs it when there is no CA yet.
+func (pki *testPKI) issue(t *testing.T, template *x509.Certificate, serial int64) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(serial)
+	template.NotBefore, template.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	parent, signer := template, key
+	if pki.ca != nil {
+		parent, signer = pki.ca, pki.caKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// writeServerCert writes a server certificate for 127.0.0.1 with the serial number.
+func (pki *testPKI) writeServerCert(t *testing.T, serial int64) {
+	key, cert := pki.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "route-checker"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, serial)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pki.writePEM(t, "server-key.pem", "EC PRIVATE KEY", keyDer)
+	pki.writePEM(t, "server.pem", "CERTIFICATE", cert.Raw)
+}
+
+func (pki *testPKI) writePEM(t *testing.T, name string, kind string, der []byte) {
+	if err := ioutil.WriteFile(filepath.Join(pki.dir, name), pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (pki *testPKI) options() tlsconfig.Options {
+	return tlsconfig.Options{
+		CertFile:     filepath.Join(pki.dir, "server.pem"),
+		KeyFile:      filepath.Join(pki.dir, "server-key.pem"),
+		ClientCAFile: filepath.Join(pki.dir, "ca.pem"),
+	}
+}
+
+// httpClient returns an HTTP client trusting the CA, with the client certificate when withCert is set. Connections are not reused, so
+// every request makes a handshake.
+func (pki *testPKI) httpClient(withCert bool, maxVersion uint16) *http.Client {
+	config := &tls.Config{RootCAs: pki.pool, MaxVersion: maxVersion}
+	if withCert {
+		config.Certificates = []tls.Certificate{pki.client}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+}
+
+// serveTLS serves the router with the TLS config on a local port. It returns the base URL and a function that stops the server.
+func serveTLS(t *testing.T, config *tls.Config) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: router}
+	go server.Serve(tls.NewListener(listener, config))
+	return "https://" + listener.Addr().String(), func() {
+		server.Close()
+	}
+}
+
+// useClientCerts enables authentication with the client certificate of the test PKI. It returns a function that disables it.
+func useClientCerts(t *testing.T) func() {
+	path := filepath.Join(testDir, "client-certs.json")
+	writeJSON(t, path, []*auth.ClientCert{{Subject: testClientSubject, ClientID: "fleet-app", Scopes: []string{util.ScopeComputeRoute}}})
+	viper.Set(util.AuthClientCerts, path)
+	resetAuth()
+	return func() {
+		viper.Set(util.AuthClientCerts, "")
+		resetAuth()
+	}
+}
+
+func TestTLSClientCert(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	defer useClientCerts(t)()
+	pki := newTestPKI(t)
+	reloader, err := tlsconfig.New(pki.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, stop := serveTLS(t, reloader.Config("http/1.1"))
+	defer stop()
+
+	payload := `{ "vin": "W1K2062161F0046", "source": "Home", "destination": "Movie Theatre" }`
+	res, err := pki.httpClient(true, 0).Post(url+util.ApiBasePath+util.ApiV1+util.ApiComputeRoute, "application/json",
+		bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("the client should be authenticated by its certificate but got %v", res.StatusCode)
+	}
+
+	// the client certificate is required
+	if _, err := pki.httpClient(false, 0).Get(url + "/api/health"); err == nil {
+		t.Error("expected the handshake without a client certificate to fail")
+	}
+}
+
+func TestTLSOptionalClientCert(t *testing.T) {
+	defer useClientCerts(t)()
+	pki := newTestPKI(t)
+	options := pki.options()
+	options.ClientAuth = tlsconfig.ClientAuthOptional
+	reloader, err := tlsconfig.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, stop := serveTLS(t, reloader.Config("http/1.1"))
+	defer stop()
+
+	res, err := pki.httpClient(false, 0).Get(url + "/api/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("the health check should be served without a client certificate but got %v", res.StatusCode)
+	}
+	res, err = pki.httpClient(false, 0).Post(url+util.ApiBasePath+util.ApiV1+util.ApiComputeRoute, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("the client without a certificate should be unauthorized but got %v", res.StatusCode)
+	}
+}
+
+func TestTLSReload(t *testing.T) {
+	pki := newTestPKI(t)
+	reloader, err := tlsconfig.New(pki.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx, 10*time.Millisecond)
+	url, stop := serveTLS(t, reloader.Config("http/1.1"))
+	defer stop()
+
+	serial := func() int64 {
+		res, err := pki.httpClient(true, 0).Get(url + "/api/health")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+	if got := serial(); got != 2 {
+		t.Fatalf("expected the certificate with serial 2 but got %v", got)
+	}
+
+	pki.writeServerCert(t, 4)
+	// the modification time has a coarse resolution on some file systems
+	later := time.Now().Add(time.Second)
+	for _, name := range []string{"server.pem", "server-key.pem"} {
+		if err := os.Chtimes(filepath.Join(pki.dir, name), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for serial() != 4 {
+		if time.Now().After(deadline) {
+			t.Fatal("the renewed certificate wasn't served")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	pki := newTestPKI(t)
+	options := pki.options()
+	options.MinVersion = "1.3"
+	reloader, err := tlsconfig.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, stop := serveTLS(t, reloader.Config("http/1.1"))
+	defer stop()
+	if _, err := pki.httpClient(true, tls.VersionTLS12).Get(url + "/api/health"); err == nil {
+		t.Error("expected TLS 1.2 to be rejected with the minimum version 1.3")
+	}
+
+	invalid := []func(options *tlsconfig.Options){
+		func(options *tlsconfig.Options) { options.MinVersion = "1.4" },
+		func(options *tlsconfig.Options) { options.CipherPolicy = "TLS_RSA_WITH_RC4_128_SHA" },
+		func(options *tlsconfig.Options) { options.ClientAuth = "sometimes" },
+		func(options *tlsconfig.Options) {
+			options.ClientCAFile, options.ClientAuth = "", tlsconfig.ClientAuthRequire
+		},
+		func(options *tlsconfig.Options) { options.KeyFile = filepath.Join(pki.dir, "ca.pem") },
+	}
+	for i, change := range invalid {
+		options := pki.options()
+		change(&options)
+		if _, err := tlsconfig.New(options); err == nil {
+			t.Errorf("expected the options %v to be invalid: %+v", i, options)
+		}
+	}
+	options = pki.options()
+	options.CipherPolicy = "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"
+	if _, err := tlsconfig.New(options); err != nil {
+		t.Errorf("expected the cipher suites to be valid but got %v", err)
+	}
+}
+
+func TestGRPCClientCert(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	defer useClientCerts(t)()
+	pki := newTestPKI(t)
+	reloader, err := tlsconfig.New(pki.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewGRPCServer(grpc.Creds(credentials.NewTLS(reloader.Config("h2"))))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		RootCAs:      pki.pool,
+		Certificates: []tls.Certificate{pki.client},
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = routepb.NewRouteCheckerClient(conn).ComputeRoute(context.Background(), &routepb.ComputeRouteRequest{
+		Vin: "W1K2062161F0046", Source: "Home", Destination: "Movie Theatre",
+	})
+	if err != nil {
+		t.Errorf("the client should be authenticated by its certificate but got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+type transactionKey struct{}
+
+var transactions struct {
+	once      sync.Once
+	generator util.IdGenerator
+}
+
+// nextTransactionId generates a transaction ID with the configured generator. The node ID of the Snowflake generator is taken from
+// NODE_ID and derived from the host name otherwise. Replicas should be configured with distinct node IDs, as host names can collide.
+func nextTransactionId() int64 {
+	transactions.once.Do(func() {
+		nodeId := viper.GetInt64(util.NodeId)
+		if !viper.IsSet(util.NodeId) {
+			nodeId = hostNodeId()
+			logger.Warnf("%v is not set. using node id %v derived from the host name", util.NodeId, nodeId)
+		}
+		generator, err := util.NewIdGenerator(viper.GetString(util.IdGeneratorKind), nodeId)
+		if err != nil {
+			logger.Error("invalid id generator config. using snowflake generator", err)
+			generator, _ = util.NewSnowflake(hostNodeId())
+		}
+		transactions.generator = generator
+	})
+	return transactions.generator.NextId()
+}
+
+func hostNodeId() int64 {
+	hostname, _ := os.Hostname()
+	hash := fnv.New32a()
+	hash.Write([]byte(hostname))
+	return int64(hash.Sum32() % (util.MaxNodeId + 1))
+}
+
+// TransactionMiddleware assigns a transaction ID to the request. The ID is responded in the X-Transaction-Id header, and is available to
+// the handlers with transactionId and to the logs of the request with requestLogger.
+func TransactionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transId := nextTransactionId()
+		c.Set(util.TransactionIdKey, transId)
+		c.Header(util.TransactionHeader, strconv.FormatInt(transId, 10))
+		c.Request = c.Request.WithContext(withTransaction(c.Request.Context(), transId))
+		c.Next()
+	}
+}
+
+// transactionId returns the transaction ID of the request, assigned by TransactionMiddleware.
+func transactionId(c *gin.Context) int64 {
+	return c.GetInt64(util.TransactionIdKey)
+}
+
+func withTransaction(ctx context.Context, transId int64) context.Context {
+	return context.WithValue(ctx, transactionKey{}, transId)
+}
+
+// requestLogger returns the logger with the transaction ID in the context, if any, as the correlation field, and the ID of the
+// authenticated client and the tenant, if any.
+func requestLogger(ctx context.Context) *zap.SugaredLogger {
+	requestLogger := logger
+	if transId, ok := transactionIdFrom(ctx); ok {
+		requestLogger = requestLogger.With(util.TransactionIdKey, transId)
+	}
+	if clientId, ok := clientIdFrom(ctx); ok {
+		requestLogger = requestLogger.With(util.ClientIdKey, clientId)
+	}
+	if clientCert, ok := clientCertFrom(ctx); ok {
+		requestLogger = requestLogger.With(util.ClientCertKey, clientCert)
+	}
+	if t := tenantFrom(ctx); t.id != "" {
+		requestLogger = requestLogger.With(util.TenantKey, t.id)
+	}
+	return requestLogger
+}
+
+// transactionIdFrom returns the transaction ID in the context, if any.
+func transactionIdFrom(ctx context.Context) (int64, bool) {
+	transId, ok := ctx.Value(transactionKey{}).(int64)
+	return transId, ok
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+)
+
+func TestSnowflakeUnique(t *testing.T) {
+	generator, err := util.NewSnowflake(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const workers, idsPerWorker = 8, 5000
+	ids := make(chan int64, workers*idsPerWorker)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < idsPerWorker; j++ {
+				ids <- generator.NextId()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	seen := make(map[int64]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("id %v is generated more than once", id)
+		}
+		seen[id] = true
+	}
+
+	// a restarted generator continues after the IDs of the previous one
+	last := generator.NextId()
+	time.Sleep(2 * time.Millisecond)
+	restarted, _ := util.NewSnowflake(42)
+	if id := restarted.NextId(); id <= last {
+		t.Errorf("id %v of the restarted generator should be after %v", id, last)
+	}
+
+	// generators of different nodes don't collide within the same millisecond
+	other, _ := util.NewSnowflake(43)
+	if restarted.NextId() == other.NextId() {
+		t.Error("generators of different nodes should generate different ids")
+	}
+
+	if _, err := util.NewSnowflake(util.MaxNodeId + 1); err == nil {
+		t.Error("node id out of range should be rejected")
+	}
+}
+
+func TestTransactionHeader(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0046"] = 60
+	stub.distances[routeKey("Home", "Movie Theatre")] = 50
+
+	previous := int64(0)
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiComputeRoute), strings.NewReader(reqTestCase4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := executeRequest(req)
+		transId, err := strconv.ParseInt(rr.Header().Get(util.TransactionHeader), 10, 64)
+		if err != nil {
+			t.Fatalf("invalid %v header. %v", util.TransactionHeader, err)
+		}
+		responseBody := &model.Response{}
+		if err := json.Unmarshal(rr.Body.Bytes(), responseBody); err != nil {
+			t.Fatal(err)
+		}
+		if responseBody.TransactionID != transId {
+			t.Errorf("transaction id %v in response should be the one in the header %v", responseBody.TransactionID, transId)
+		}
+		// the ID is above the integers that JSON numbers hold exactly, so it is sent as a string
+		if body := rr.Body.String(); !strings.Contains(body, fmt.Sprintf(`"transactionId":"%v"`, transId)) {
+			t.Errorf("expected the transaction id %v as a string in the response but got %v", transId, body)
+		}
+		if transId <= previous {
+			t.Errorf("transaction id %v should be after %v", transId, previous)
+		}
+		previous = transId
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/spf13/viper"
+)
+
+// HandleFuelCheckV2 computes the travel like HandleFuelCheck. Failures are responded with their HTTP status in the RFC 7807
+// problem details format instead of the error IDs in response. The travel is bounded by the configured request timeout.
+func HandleFuelCheckV2(c *gin.Context) {
+	var reqBody model.Request
+	if err := c.ShouldBindBodyWith(&reqBody, binding.JSON); err != nil {
+		logger.Error("invalid request", err)
+		writeProblem(c, &travelError{code: util.ErrCodeInvalidReq, err: err}, transactionId(c))
+		return
+	}
+	transId := transactionId(c)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout())
+	defer cancel()
+	response, failure := computeTravel(ctx, tenantFrom(ctx).provider, &reqBody, transId)
+	if failure != nil {
+		writeProblem(c, failure, transId)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// requestTimeout returns the configured time allowed to compute a travel.
+func requestTimeout() time.Duration {
+	timeout := viper.GetInt(util.RequestTimeout)
+	if timeout <= 0 {
+		timeout = util.DefaultReqTimeout
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// writeProblem responds with the problem details for the failure.
+func writeProblem(c *gin.Context, failure *travelError, transId int64) {
+	status, title := problemStatus(failure.code)
+	problem := &model.Problem{
+		Type:          fmt.Sprintf(util.ProblemTypeFormat, failure.code),
+		Title:         title,
+		Status:        status,
+		Detail:        problemDetail(failure),
+		Instance:      c.Request.URL.Path,
+		Code:          failure.code,
+		TransactionID: transId,
+		Endpoint:      failure.endpoint,
+		InvalidParams: invalidParams(failure.err),
+	}
+	content, err := json.Marshal(problem)
+	if err != nil {
+		logger.Error("failed to serialize problem", err)
+		c.String(http.StatusInternalServerError, util.ErrTechExpMsg)
+		return
+	}
+	c.Data(status, util.ProblemContentType, content)
+}
+
+// problemDetail explains the failure to the client. Errors from calling the upstream API and internal errors are not exposed.
+func problemDetail(failure *travelError) string {
+	switch failure.code {
+	case util.ErrCodeInvalidReq:
+		if invalidParams(failure.err) != nil {
+			return "the request has invalid params"
+		}
+		return failure.err.Error()
+	case util.ErrCodeInvalidVin, util.ErrCodeUnknownLoc, util.ErrCodeIdempotency, util.ErrCodeUnauthed, util.ErrCodeForbidden,
+		util.ErrCodeRateLimited, util.ErrCodeOverloaded:
+		return failure.err.Error()
+	case util.ErrCodeUnreachable:
+		return util.ErrUnreachableMsg
+	case util.ErrCodeMaxStops:
+		return util.ErrMaxStopsMsg
+	case util.ErrCodeInternal:
+		return util.ErrTechExpMsg
+	default:
+		return fmt.Sprintf("failed to retrieve %v", failure.endpoint)
+	}
+}
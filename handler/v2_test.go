@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/spf13/viper"
+)
+
+func TestFuelCheckV2(t *testing.T) {
+	stub := defaultRouteStub()
+	defer stub.use()()
+	stub.chargeLevels["W1K2062161F0080"] = 5
+	// the stops run out on the way to the airport, but it can't be reached with any number of stops either
+	stub.chargeLevels["W1K2062161F0081"] = 10
+	stub.distances[routeKey("Home", "Airport")] = 1000
+	stub.stations[routeKey("Home", "Airport")] = []*model.Station{
+		{Name: "S1", Limit: 10, Distance: 10},
+		{Name: "S2", Limit: 10, Distance: 20},
+	}
+
+	testCases := []struct {
+		name    string
+		payload string
+		status  int
+		code    string
+	}{
+		{"success", reqTestCase4, http.StatusOK, ""},
+		{"invalid request", `{ "vin": 1 }`, http.StatusBadRequest, util.ErrCodeInvalidReq},
+		{"invalid vin", `{ "vin": "W1K2062161F0099", "source": "Home", "destination": "Movie Theatre" }`, http.StatusUnprocessableEntity, util.ErrCodeInvalidVin},
+		{"unknown location", `{ "vin": "W1K2062161F0046", "source": "Home", "destination": "Moon" }`, http.StatusUnprocessableEntity, util.ErrCodeUnknownLoc},
+		{"unreachable", `{ "vin": "W1K2062161F0080", "source": "Home", "destination": "Movie Theatre" }`, http.StatusUnprocessableEntity, util.ErrCodeUnreachable},
+		{"too many stops", `{ "vin": "W1K2062161F0046", "source": "Home", "destination": "Movie Theatre", "maxStops": 1 }`,
+			http.StatusUnprocessableEntity, util.ErrCodeMaxStops},
+		{"unreachable within max stops", `{ "vin": "W1K2062161F0081", "source": "Home", "destination": "Airport", "maxStops": 1 }`,
+			http.StatusUnprocessableEntity, util.ErrCodeUnreachable},
+	}
+	for _, testCase := range testCases {
+		rr := executeV2Request(t, testCase.payload)
+		if rr.Code != testCase.status {
+			t.Errorf("%v: handler returned wrong status code: got %v want %v", testCase.name, rr.Code, testCase.status)
+			continue
+		}
+		if testCase.code == "" {
+			continue
+		}
+		assertProblem(t, testCase.name, rr, testCase.code)
+	}
+}
+
+func TestFuelCheckV2UpstreamFailure(t *testing.T) {
+	// the upstream API is unreachable once the stub is closed
+	stub := newUpstreamStub()
+	defer stub.use()()
+	stub.Close()
+
+	rr := executeV2Request(t, reqTestCase4)
+	if rr.Code != http.StatusBadGateway {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadGateway)
+	}
+	problem := assertProblem(t, "upstream failure", rr, fmt.Sprintf(util.ErrCodeUpstream, util.EndpointCharge))
+	if problem.Endpoint != util.EndpointCharge {
+		t.Errorf("expected endpoint %v but got %v", util.EndpointCharge, problem.Endpoint)
+	}
+}
+
+func TestFuelCheckV2Timeout(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+	stub.onCall = func(endpoint string) {
+		time.Sleep(1500 * time.Millisecond)
+	}
+	viper.Set(util.RequestTimeout, 1)
+	defer viper.Set(util.RequestTimeout, 0)
+
+	rr := executeV2Request(t, reqTestCase4)
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusGatewayTimeout)
+	}
+	assertProblem(t, "timeout", rr, util.ErrCodeTimeout)
+}
+
+func executeV2Request(t *testing.T, payload string) *httptest.ResponseRecorder {
+	url := fmt.Sprintf("http://localhost:%s%s%s%s", viper.GetString(util.Port), util.ApiBasePath, util.ApiV2, util.ApiComputeRoute)
+	req, err := http.NewRequest(ReqPost, url, bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executeRequest(req)
+}
+
+// assertProblem checks that the response is a problem with the code
+func assertProblem(t *testing.T, name string, rr *httptest.ResponseRecorder, code string) *model.Problem {
+	if contentType := rr.Header().Get("Content-Type"); contentType != util.ProblemContentType {
+		t.Errorf("%v: expected content type %v but got %v", name, util.ProblemContentType, contentType)
+	}
+	problem := &model.Problem{}
+	if err := json.Unmarshal(rr.Body.Bytes(), problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Code != code || problem.Status != rr.Code {
+		t.Errorf("%v: expected problem %v with status %v but got %+v", name, code, rr.Code, problem)
+	}
+	return problem
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/viper"
+)
+
+var errBodyTooLarge = errors.New("request body is too large")
+
+// vinValues and vinWeights are the transliteration of the VIN characters into numbers and the weights of the VIN positions
+// used to compute the check digit as per ISO 3779 and 49 CFR 565.
+var (
+	vinValues = map[rune]int{
+		'A': 1, 'B': 2, 'C': 3, 'D': 4, 'E': 5, 'F': 6, 'G': 7, 'H': 8,
+		'J': 1, 'K': 2, 'L': 3, 'M': 4, 'N': 5, 'P': 7, 'R': 9,
+		'S': 2, 'T': 3, 'U': 4, 'V': 5, 'W': 6, 'X': 7, 'Y': 8, 'Z': 9,
+	}
+	vinWeights = []int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+)
+
+// locationPunctuation is the punctuation allowed in source and destination along with letters, digits and spaces.
+const locationPunctuation = ".,'-&()/"
+
+// the validations are registered with the validator used by gin to bind requests
+func init() {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	validate.RegisterTagNameFunc(jsonFieldName)
+	validate.RegisterValidation("vinchars", validateVinChars)
+	validate.RegisterValidation("vincheck", validateVinCheckDigit)
+	validate.RegisterValidation("location", validateLocation)
+	validate.RegisterStructValidation(validateRoute, model.Request{})
+}
+
+// jsonFieldName names the fields in validation errors by their JSON names.
+func jsonFieldName(field reflect.StructField) string {
+	return strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+}
+
+// validateVinChars checks that the VIN has only digits and capital letters. The letters I, O and Q are not used in a VIN.
+func validateVinChars(fl validator.FieldLevel) bool {
+	for _, char := range fl.Field().String() {
+		if _, ok := vinValues[char]; !ok && (char < '0' || char > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateVinCheckDigit checks the check digit at the 9th position of the VIN. The check digit is mandatory for the 17 character VINs of
+// vehicles made for North America, whose VIN starts with 1 to 5. Other VINs are not checked.
+func validateVinCheckDigit(fl validator.FieldLevel) bool {
+	vin := fl.Field().String()
+	if len(vin) != 17 || vin[0] < '1' || vin[0] > '5' {
+		return true
+	}
+	sum := 0
+	for i, char := range vin {
+		value, ok := vinValues[char]
+		if !ok {
+			value = int(char - '0')
+		}
+		sum += value * vinWeights[i]
+	}
+	checkDigit := byte('0' + sum%11)
+	if sum%11 == 10 {
+		checkDigit = 'X'
+	}
+	return vin[8] == checkDigit
+}
+
+// validateLocation checks that the location has at least a letter or a digit, and only letters, digits, spaces and the allowed punctuation.
+func validateLocation(fl validator.FieldLevel) bool {
+	hasAlphaNumeric := false
+	for _, char := range fl.Field().String() {
+		switch {
+		case unicode.IsLetter(char) || unicode.IsDigit(char):
+			hasAlphaNumeric = true
+		case char == ' ' || strings.ContainsRune(locationPunctuation, char):
+		default:
+			return false
+		}
+	}
+	return hasAlphaNumeric
+}
+
+// validateRoute checks that the source and destination are different locations, ignoring case and surrounding spaces.
+func validateRoute(sl validator.StructLevel) {
+	req := sl.Current().Interface().(model.Request)
+	source := strings.TrimSpace(req.Source)
+	if source != "" && strings.EqualFold(source, strings.TrimSpace(req.Destination)) {
+		sl.ReportError(req.Destination, "destination", "Destination", "nefield", "source")
+	}
+}
+
+// invalidParams converts the validation errors into the invalid params of the request. It returns nil if err is not a validation error.
+func invalidParams(err error) []*model.InvalidParam {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+	params := make([]*model.InvalidParam, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		params = append(params, &model.InvalidParam{
+			Name:   paramName(fieldError.Namespace()),
+			Reason: validationReason(fieldError),
+		})
+	}
+	return params
+}
+
+// paramName converts the namespace of a field into its path in the JSON request. The fields are named by their JSON names, so the segments
+// that start with a capital letter are the request type or embedded structs, which are not in the JSON request.
+func paramName(namespace string) string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(namespace, ".") {
+		if segment != "" && unicode.IsUpper(rune(segment[0])) {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, ".")
+}
+
+// validationReason explains the failed validation of a field.
+func validationReason(fieldError validator.FieldError) string {
+	unit := ""
+	switch fieldError.Kind() {
+	case reflect.String:
+		unit = " characters"
+	case reflect.Slice:
+		unit = " items"
+	}
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return fmt.Sprintf("must be at least %v%v", fieldError.Param(), unit)
+	case "max":
+		return fmt.Sprintf("must be at most %v%v", fieldError.Param(), unit)
+	case "oneof":
+		return fmt.Sprintf("must be one of %v", strings.ReplaceAll(fieldError.Param(), " ", ", "))
+	case "vinchars":
+		return "must contain only digits and capital letters other than I, O and Q"
+	case "vincheck":
+		return "has an invalid check digit"
+	case "location":
+		return fmt.Sprintf("must contain only letters, digits, spaces and %v", strings.Join(strings.Split(locationPunctuation, ""), " "))
+	case "nefield":
+		return fmt.Sprintf("must be different from %v", fieldError.Param())
+	default:
+		return "is invalid"
+	}
+}
+
+// readBody reads the body of the request up to MAX_BODY_BYTES and leaves it to be read again by the handler. A larger body fails with
+// errBodyTooLarge.
+func readBody(c *gin.Context) ([]byte, error) {
+	limit := viper.GetInt64(util.MaxBodyBytes)
+	if limit <= 0 {
+		limit = util.DefaultMaxBody
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil && int64(len(body)) >= limit {
+		return nil, errBodyTooLarge
+	}
+	return body, err
+}
+
+// abortInvalidRequest responds to a request that couldn't be bound. Validation failures are responded with the invalid params.
+func abortInvalidRequest(c *gin.Context, err error) {
+	logger.Error("invalid request", err)
+	if params := invalidParams(err); params != nil {
+		c.JSON(http.StatusBadRequest, &model.ResInvalidRequest{InvalidParams: params})
+		return
+	}
+	c.String(http.StatusBadRequest, `invalid request`)
+}
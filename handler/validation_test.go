@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/gin-gonic/gin/binding"
+)
+
+func TestValidateVin(t *testing.T) {
+	testCases := []struct {
+		vin   string
+		valid bool
+	}{
+		{"W1K2062161F0046", true},
+		{"1M8GDM9AXKP042788", true},
+		// the check digit isn't verified for VINs outside North America
+		{"WDD2220821A000001", true},
+		{"1M8GDM9A1KP042788", false},
+		{"", false},
+		{"W1K20621", false},
+		{"W1K2062161F0046000", false},
+		{"w1k2062161f0046", false},
+		{"W1K2O62161F0046", false},
+		{"W1K2062161F00-6", false},
+	}
+	for _, testCase := range testCases {
+		req := &model.Request{Vin: testCase.vin, Source: "Home", Destination: "Airport"}
+		err := binding.Validator.ValidateStruct(req)
+		if valid := err == nil; valid != testCase.valid {
+			t.Errorf("vin %q should be valid: %v, got error %v", testCase.vin, testCase.valid, err)
+		}
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	testCases := []struct {
+		name    string
+		req     *model.Request
+		invalid []string
+	}{
+		{"valid", &model.Request{Vin: "W1K2062161F0046", Source: "St. Mary's Hospital", Destination: "Terminal 1 (Arrivals)"}, nil},
+		{"empty", &model.Request{}, []string{"vin", "source", "destination"}},
+		{"same route", &model.Request{Vin: "W1K2062161F0046", Source: "Home", Destination: " home "}, []string{"destination"}},
+		{"charset", &model.Request{Vin: "W1K2062161F0046", Source: "@$%%%", Destination: "Home; DROP"}, []string{"source", "destination"}},
+		{"length", &model.Request{Vin: "W1K2062161F0046", Source: strings.Repeat("a", 101), Destination: "Home"}, []string{"source"}},
+		{"station order", &model.Request{Vin: "W1K2062161F0046", Source: "Home", Destination: "Airport", StationOrder: "fastest"}, []string{"stationOrder"}},
+		{"preferences", &model.Request{Vin: "W1K2062161F0046", Source: "Home", Destination: "Airport",
+			Preferences: model.Preferences{AvoidStations: []string{""}, MaxStops: -1}}, []string{"avoidStations[0]", "maxStops"}},
+	}
+	for _, testCase := range testCases {
+		params := invalidParams(binding.Validator.ValidateStruct(testCase.req))
+		names := make([]string, 0)
+		for _, param := range params {
+			names = append(names, param.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(testCase.invalid, ",") {
+			t.Errorf("%v: expected invalid params %v but got %v", testCase.name, testCase.invalid, names)
+		}
+	}
+}
+
+func TestInvalidReqNotSentUpstream(t *testing.T) {
+	stub := newUpstreamStub()
+	defer stub.use()()
+
+	payload := `{ "vin": "", "source": "Home", "destination": "Home" }`
+	req, err := http.NewRequest(ReqPost, computeBaseUrl(util.ApiComputeRoute), strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := executeRequest(req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	responseBody := &model.ResInvalidRequest{}
+	if err := json.Unmarshal(rr.Body.Bytes(), responseBody); err != nil {
+		t.Fatal(err)
+	}
+	if len(responseBody.InvalidParams) != 2 {
+		t.Errorf("expected invalid vin and destination but got %v", rr.Body.String())
+	}
+
+	rr = executeV2Request(t, payload)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("v2 handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	problem := assertProblem(t, "invalid request", rr, util.ErrCodeInvalidReq)
+	if problem != nil && len(problem.InvalidParams) != 2 {
+		t.Errorf("expected invalid params in the problem but got %v", rr.Body.String())
+	}
+
+	for _, endpoint := range []string{"charge_level", "distance", "charging_stations"} {
+		if stub.callCount(endpoint) != 0 {
+			t.Errorf("%v shouldn't be called for an invalid request", endpoint)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/spf13/viper"
+)
+
+// vehicleProfiles are the vehicle profiles read from a JSON file, cached until the path changes or the cache is invalidated.
+type vehicleProfiles struct {
+	sync.Mutex
+	loaded bool
+	path   string
+	list   []*model.VehicleProfile
+}
+
+// profiles are the vehicle profiles of the file configured in VEHICLE_PROFILES.
+var profiles vehicleProfiles
+
+// getVehicleProfile returns the profile whose VIN prefix is the longest match for the vin. It returns nil if no profile matches
+// or if the profiles are not configured.
+func getVehicleProfile(vin string) *model.VehicleProfile {
+	return profiles.match(vin, viper.GetString(util.VehicleProfiles))
+}
+
+// invalidateVehicleProfiles reads the vehicle profiles of every tenant again on their next use, so that the changes of the files are
+// taken.
+func invalidateVehicleProfiles() {
+	profiles.invalidate()
+	tenants, _ := getTenants()
+	for _, t := range tenants.byId {
+		t.profiles.invalidate()
+	}
+}
+
+// match returns the profile of the file at the path whose VIN prefix is the longest match for the vin, if any.
+func (p *vehicleProfiles) match(vin string, path string) *model.VehicleProfile {
+	var match *model.VehicleProfile
+	for _, profile := range p.load(path) {
+		if !strings.HasPrefix(vin, profile.VinPrefix) {
+			continue
+		}
+		if match == nil || len(profile.VinPrefix) > len(match.VinPrefix) {
+			match = profile
+		}
+	}
+	return match
+}
+
+func (p *vehicleProfiles) invalidate() {
+	p.Lock()
+	defer p.Unlock()
+	p.loaded = false
+}
+
+func (p *vehicleProfiles) load(path string) []*model.VehicleProfile {
+	p.Lock()
+	defer p.Unlock()
+	if p.loaded && path == p.path {
+		return p.list
+	}
+	p.loaded, p.path = true, path
+	p.list = nil
+	if path == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Error("failed to read vehicle profiles", err)
+		return nil
+	}
+	list := make([]*model.VehicleProfile, 0)
+	if err := json.Unmarshal(content, &list); err != nil {
+		logger.Error("failed to parse vehicle profiles", err)
+		return nil
+	}
+	p.list = list
+	return list
+}
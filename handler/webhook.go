@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/SDJLee/mercedes-benz/webhook"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+var webhooks struct {
+	once       sync.Once
+	dispatcher *webhook.Dispatcher
+}
+
+// getWebhooks returns the dispatcher of the webhook subscriptions of the WEBHOOKS_PATH file and starts its workers. It returns nil when
+// it is not set or invalid, in which case no events are posted.
+func getWebhooks() *webhook.Dispatcher {
+	webhooks.once.Do(func() {
+		path := viper.GetString(util.WebhooksPath)
+		if path == "" {
+			return
+		}
+		subscriptions, err := webhook.Load(path)
+		if err != nil {
+			logger.Error("failed to load webhooks. events will not be posted", err)
+			return
+		}
+		deadLetter, err := webhookDeadLetterPath()
+		if err != nil {
+			logger.Error("failed to locate the webhook dead-letter log. events will not be posted", err)
+			return
+		}
+		// the pending deliveries are kept next to the dead-letter log by default
+		stateDir := viper.GetString(util.WebhookStatePath)
+		if stateDir == "" {
+			stateDir = filepath.Join(filepath.Dir(deadLetter), util.DefaultHookState)
+		}
+		webhooks.dispatcher = webhook.New(subscriptions, webhook.Config{
+			MaxAttempts:    viper.GetInt(util.WebhookAttempts),
+			Backoff:        time.Duration(viper.GetInt(util.WebhookBackoffMs)) * time.Millisecond,
+			Timeout:        time.Duration(viper.GetInt(util.WebhookTimeoutMs)) * time.Millisecond,
+			Workers:        viper.GetInt(util.WebhookWorkers),
+			QueueSize:      viper.GetInt(util.WebhookQueueSize),
+			DeadLetterPath: deadLetter,
+			StateDir:       stateDir,
+		})
+	})
+	return webhooks.dispatcher
+}
+
+// webhookDeadLetterPath returns the WEBHOOK_DEAD_LETTER_PATH setting, or a file next to the plan history or in the jobs directory when
+// they are set. The dead-letter log and the pending deliveries next to it must survive a restart, so they are never kept in the
+// temporary directory, and the webhooks fail to start when none of the settings is set.
+func webhookDeadLetterPath() (string, error) {
+	if path := viper.GetString(util.WebhookDeadLetter); path != "" {
+		return path, nil
+	}
+	if path := viper.GetString(util.HistoryPath); path != "" {
+		return filepath.Join(filepath.Dir(path), util.DefaultDeadLetter), nil
+	}
+	if dir := viper.GetString(util.JobsPath); dir != "" {
+		return filepath.Join(dir, util.DefaultDeadLetter), nil
+	}
+	return "", fmt.Errorf("%v is not set", util.WebhookDeadLetter)
+}
+
+// publishPlanEvents posts the events about the computed plan to the webhook subscriptions: plan.unreachable when the destination or a
+// station can't be reached, and plan.too-many-stops when the plan has more stops than the maxStops of a subscription. The failure of the
+// plan tells an unreachable destination apart from one that is only unreachable within the maxStops of the request, which both have the
+// error 8888. A subscription of a tenant only gets the events of the plans of its tenant.
+func publishPlanEvents(record *model.PlanRecord, failure *travelError) {
+	dispatcher := getWebhooks()
+	if dispatcher == nil || record.Response == nil {
+		return
+	}
+	response := record.Response
+	plan := &model.PlanEvent{
+		TransactionID:    record.TransactionID,
+		Tenant:           record.Tenant,
+		Vin:              response.Vin.String,
+		Source:           response.Source.String,
+		Destination:      response.Destination.String,
+		Distance:         response.Distance.Int64,
+		Stops:            len(response.ChargingStations),
+		ChargingStations: response.ChargingStations,
+		Errors:           response.Errors,
+	}
+	ofTenant := func(subscription *webhook.Subscription) bool {
+		return subscription.Tenant == "" || subscription.Tenant == record.Tenant
+	}
+	publish := func(eventType string, accept func(subscription *webhook.Subscription) bool) {
+		event, err := webhook.NewEvent(eventType, plan)
+		if err != nil {
+			logger.Errorf("failed to publish %v event of transaction %v. %v", eventType, record.TransactionID, err)
+			return
+		}
+		dispatcher.Publish(event, accept)
+	}
+	if failure != nil && failure.code == util.ErrCodeUnreachable {
+		publish(util.EventUnreachable, ofTenant)
+	}
+	if plan.Stops > 0 {
+		publish(util.EventTooManyStops, func(subscription *webhook.Subscription) bool {
+			return ofTenant(subscription) && plan.Stops > subscription.MaxStops
+		})
+	}
+}
+
+// HandleWebhookDeliveries responds with the status of the latest webhook deliveries, newest first. The deliveries are filtered by the
+// optional query parameters status and subscription.
+func HandleWebhookDeliveries(c *gin.Context) {
+	deliveries := []*model.WebhookDelivery{}
+	dispatcher := getWebhooks()
+	if dispatcher == nil {
+		c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+		return
+	}
+	status, subscription := c.Query("status"), c.Query("subscription")
+	for _, delivery := range dispatcher.Deliveries() {
+		if (status == "" || delivery.Status == status) && (subscription == "" || delivery.Subscription == subscription) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
@@ -0,0 +1,366 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+	"github.com/SDJLee/mercedes-benz/webhook"
+	"github.com/spf13/viper"
+)
+
+const testWebhookSecret = "webhook-test-secret"
+
+// webhookReceiver is a webhook subscriber. It verifies the signature of the events and keeps them by the path they are posted to.
+// The first failures events posted to a path are responded with a 500.
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	failures int
+	attempts map[string]int
+	events   map[string][]*model.WebhookEvent
+}
+
+func newWebhookReceiver(t *testing.T, failures int) *webhookReceiver {
+	receiver := &webhookReceiver{failures: failures, attempts: make(map[string]int), events: make(map[string][]*model.WebhookEvent)}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := webhook.Verify(testWebhookSecret, r.Header.Get(util.SignatureHeader), body, time.Minute); err != nil {
+			t.Errorf("webhook posted with invalid signature. %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		event := &model.WebhookEvent{}
+		if err := json.Unmarshal(body, event); err != nil || event.Type != r.Header.Get(util.WebhookEventHeader) {
+			t.Errorf("webhook posted with invalid event %s", body)
+		}
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		receiver.attempts[r.URL.Path]++
+		if receiver.attempts[r.URL.Path] <= receiver.failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		receiver.events[r.URL.Path] = append(receiver.events[r.URL.Path], event)
+	}))
+	return receiver
+}
+
+func (receiver *webhookReceiver) received(path string) []*model.WebhookEvent {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return receiver.events[path]
+}
+
+// useWebhooks writes the subscriptions into the webhooks file, with a backoff of a millisecond. It returns a function that closes the
+// dispatcher and removes them.
+func useWebhooks(t *testing.T, maxAttempts int, subscriptions ...*webhook.Subscription) func() {
+	path := filepath.Join(testDir, "webhooks.json")
+	writeJSON(t, path, subscriptions)
+	viper.Set(util.WebhooksPath, path)
+	viper.Set(util.WebhookAttempts, maxAttempts)
+	viper.Set(util.WebhookBackoffMs, 1)
+	viper.Set(util.WebhookDeadLetter, filepath.Join(testDir, "webhooks.dead.jsonl"))
+	resetWebhooks()
+	return func() {
+		if dispatcher := getWebhooks(); dispatcher != nil {
+			dispatcher.Close(context.Background())
+		}
+		viper.Set(util.WebhooksPath, "")
+		viper.Set(util.WebhookAttempts, 0)
+		viper.Set(util.WebhookBackoffMs, 0)
+		viper.Set(util.WebhookDeadLetter, "")
+		resetWebhooks()
+	}
+}
+
+func resetWebhooks() {
+	webhooks.once = sync.Once{}
+	webhooks.dispatcher = nil
+}
+
+// awaitDeliveries waits until the webhooks have count deliveries, none of them pending, and returns them.
+func awaitDeliveries(t *testing.T, count int) []*model.WebhookDelivery {
+	dispatcher := getWebhooks()
+	if dispatcher == nil {
+		t.Fatal("expected the webhooks to be enabled")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries := dispatcher.Deliveries()
+		done := len(deliveries) == count
+		for _, delivery := range deliveries {
+			done = done && delivery.Status != model.DeliveryPending
+		}
+		if done {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %v completed deliveries but got %v", count, len(deliveries))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// webhookStub returns the upstream stub where W1K2062161F0046 reaches the destination with 2 stops and W1K2062161F0080 can't reach it.
+func webhookStub() *upstreamStub {
+	stub := defaultRouteStub()
+	stub.chargeLevels["W1K2062161F0080"] = 5
+	return stub
+}
+
+func computeForWebhooks(t *testing.T, vin string) {
+	payload := `{ "vin": "` + vin + `", "source": "Home", "destination": "Movie Theatre" }`
+	if rr := executeAsTenant(t, computeBaseUrl(util.ApiComputeRoute), "", payload, nil); rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestWebhookEvents(t *testing.T) {
+	stub := webhookStub()
+	defer stub.use()()
+	receiver := newWebhookReceiver(t, 0)
+	defer receiver.Close()
+	subscription := func(id string, maxStops int, tenant string, events ...string) *webhook.Subscription {
+		return &webhook.Subscription{ID: id, URL: receiver.URL + "/" + id, Secret: testWebhookSecret, Events: events, Tenant: tenant,
+			MaxStops: maxStops}
+	}
+	defer useWebhooks(t, 1,
+		subscription("unreachable", 0, "", util.EventUnreachable),
+		subscription("one-stop", 1, "", util.EventTooManyStops),
+		subscription("five-stops", 5, "", util.EventTooManyStops),
+		subscription("brand-b", 1, "brand-b", util.EventUnreachable, util.EventTooManyStops),
+	)()
+
+	computeForWebhooks(t, "W1K2062161F0046")
+	computeForWebhooks(t, "W1K2062161F0080")
+	for _, delivery := range awaitDeliveries(t, 2) {
+		if delivery.Status != model.DeliveryDelivered || delivery.Attempts != 1 {
+			t.Errorf("expected delivery to %v to be delivered at once but got %v after %v attempts", delivery.Subscription,
+				delivery.Status, delivery.Attempts)
+		}
+	}
+	unreachable := receiver.received("/unreachable")
+	if len(unreachable) != 1 || unreachable[0].Type != util.EventUnreachable || unreachable[0].Data.Vin != "W1K2062161F0080" {
+		t.Fatalf("expected an unreachable event of W1K2062161F0080 but got %v", unreachable)
+	}
+	if errors := unreachable[0].Data.Errors; len(errors) != 1 || errors[0].ID != util.ErrUnreachableId {
+		t.Errorf("expected the unreachable event to have error 8888 but got %v", errors)
+	}
+	stops := receiver.received("/one-stop")
+	if len(stops) != 1 || stops[0].Type != util.EventTooManyStops || stops[0].Data.Vin != "W1K2062161F0046" || stops[0].Data.Stops != 2 {
+		t.Fatalf("expected a too-many-stops event of W1K2062161F0046 with 2 stops but got %v", stops)
+	}
+	for _, path := range []string{"/five-stops", "/brand-b"} {
+		if events := receiver.received(path); len(events) != 0 {
+			t.Errorf("expected no events for %v but got %v", path, len(events))
+		}
+	}
+
+	body, _ := json.Marshal(stops[0])
+	signature := webhook.Sign(testWebhookSecret, time.Now(), body)
+	if err := webhook.Verify(testWebhookSecret, signature, body, time.Minute); err != nil {
+		t.Errorf("expected the signature to be valid but got %v", err)
+	}
+	tampered := append([]byte{}, body...)
+	tampered[len(tampered)-2] = ' '
+	if err := webhook.Verify(testWebhookSecret, signature, tampered, time.Minute); err == nil {
+		t.Error("expected the signature of a tampered body to be invalid")
+	}
+	if err := webhook.Verify("another-secret", signature, body, time.Minute); err == nil {
+		t.Error("expected the signature with another secret to be invalid")
+	}
+	old := webhook.Sign(testWebhookSecret, time.Now().Add(-time.Hour), body)
+	if err := webhook.Verify(testWebhookSecret, old, body, time.Minute); err == nil {
+		t.Error("expected an old signature to be invalid")
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	stub := webhookStub()
+	defer stub.use()()
+	receiver := newWebhookReceiver(t, 2)
+	defer receiver.Close()
+	defer useWebhooks(t, 3, &webhook.Subscription{ID: "unreachable", URL: receiver.URL + "/unreachable", Secret: testWebhookSecret,
+		Events: []string{util.EventUnreachable}})()
+
+	computeForWebhooks(t, "W1K2062161F0080")
+	deliveries := awaitDeliveries(t, 1)
+	if delivery := deliveries[0]; delivery.Status != model.DeliveryDelivered || delivery.Attempts != 3 || delivery.LastError != "" {
+		t.Errorf("expected the delivery to succeed on the third attempt but got %v after %v attempts (%v)", delivery.Status,
+			delivery.Attempts, delivery.LastError)
+	}
+	if events := receiver.received("/unreachable"); len(events) != 1 || events[0].ID != deliveries[0].EventID {
+		t.Errorf("expected the event to be received once but got %v", events)
+	}
+}
+
+func TestWebhookMaxStops(t *testing.T) {
+	stub := webhookStub()
+	defer stub.use()()
+	receiver := newWebhookReceiver(t, 0)
+	defer receiver.Close()
+	defer useWebhooks(t, 1,
+		&webhook.Subscription{ID: "unreachable", URL: receiver.URL + "/unreachable", Secret: testWebhookSecret,
+			Events: []string{util.EventUnreachable}},
+	)()
+
+	// the destination can be reached with 2 stops, so a plan within 1 stop keeps the v1 error but is not unreachable
+	payload := `{ "vin": "W1K2062161F0046", "source": "Home", "destination": "Movie Theatre", "maxStops": 1 }`
+	rr := executeAsTenant(t, computeBaseUrl(util.ApiComputeRoute), "", payload, nil)
+	response := &model.Response{}
+	if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].ID != util.ErrUnreachableId {
+		t.Errorf("expected error %v but got %+v", util.ErrUnreachableId, response.Errors)
+	}
+	computeForWebhooks(t, "W1K2062161F0080")
+	awaitDeliveries(t, 1)
+	if events := receiver.received("/unreachable"); len(events) != 1 || events[0].Data.Vin != "W1K2062161F0080" {
+		t.Errorf("expected only the unreachable event of W1K2062161F0080 but got %v", events)
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	stub := webhookStub()
+	defer stub.use()()
+	receiver := newWebhookReceiver(t, 100)
+	defer receiver.Close()
+	deadLetter := filepath.Join(testDir, "webhooks.dead.jsonl")
+	os.Remove(deadLetter)
+	defer useWebhooks(t, 2,
+		&webhook.Subscription{ID: "failing", URL: receiver.URL + "/failing", Secret: testWebhookSecret,
+			Events: []string{util.EventUnreachable}},
+		&webhook.Subscription{ID: "stops", URL: receiver.URL + "/stops", Secret: testWebhookSecret,
+			Events: []string{util.EventTooManyStops}, MaxStops: 1},
+	)()
+	router := useAdmin(t)
+
+	computeForWebhooks(t, "W1K2062161F0080")
+	deliveries := awaitDeliveries(t, 1)
+	if delivery := deliveries[0]; delivery.Status != model.DeliveryFailed || delivery.Attempts != 2 ||
+		delivery.LastStatusCode != http.StatusInternalServerError || delivery.NextAttemptAt != nil {
+		t.Errorf("expected the delivery to fail after 2 attempts but got %v after %v attempts", delivery.Status, delivery.Attempts)
+	}
+	file, err := os.Open(deadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lines []map[string]json.RawMessage
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("expected the failed delivery in the dead-letter log but got %v lines", len(lines))
+	}
+	event := &model.WebhookEvent{}
+	if err := json.Unmarshal(lines[0]["event"], event); err != nil || event.ID != deliveries[0].EventID ||
+		event.Data.Vin != "W1K2062161F0080" {
+		t.Errorf("expected the dead-letter log to have the event but got %s", lines[0]["event"])
+	}
+
+	receiver.mu.Lock()
+	receiver.failures = 0
+	receiver.mu.Unlock()
+	computeForWebhooks(t, "W1K2062161F0046")
+	awaitDeliveries(t, 2)
+	for _, testCase := range []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"stops", "failing"}},
+		{"?status=failed", []string{"failing"}},
+		{"?status=delivered&subscription=stops", []string{"stops"}},
+		{"?subscription=unknown", []string{}},
+	} {
+		rr := executeAdmin(router, "GET", util.AdminWebhooks+testCase.query, "", testAdminKey)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		var response struct {
+			Deliveries []*model.WebhookDelivery `json:"deliveries"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		var subscriptions []string
+		for _, delivery := range response.Deliveries {
+			subscriptions = append(subscriptions, delivery.Subscription)
+		}
+		if len(subscriptions) != len(testCase.expected) {
+			t.Errorf("%q: expected deliveries to %v but got %v", testCase.query, testCase.expected, subscriptions)
+			continue
+		}
+		for i := range subscriptions {
+			if subscriptions[i] != testCase.expected[i] {
+				t.Errorf("%q: expected deliveries to %v but got %v", testCase.query, testCase.expected, subscriptions)
+				break
+			}
+		}
+	}
+}
+
+func TestWebhookInvalidConfig(t *testing.T) {
+	for _, testCase := range []struct {
+		name         string
+		subscription *webhook.Subscription
+	}{
+		{"no secret", &webhook.Subscription{ID: "a", URL: "http://localhost/a", Events: []string{util.EventUnreachable}}},
+		{"invalid url", &webhook.Subscription{ID: "a", URL: "ftp://localhost/a", Secret: "s", Events: []string{util.EventUnreachable}}},
+		{"unknown event", &webhook.Subscription{ID: "a", URL: "http://localhost/a", Secret: "s", Events: []string{"plan.computed"}}},
+		{"no max stops", &webhook.Subscription{ID: "a", URL: "http://localhost/a", Secret: "s", Events: []string{util.EventTooManyStops}}},
+	} {
+		if err := webhook.Validate([]*webhook.Subscription{testCase.subscription}); err == nil {
+			t.Errorf("%v: expected the subscription to be invalid", testCase.name)
+		}
+	}
+	path := filepath.Join(testDir, "webhooks.json")
+	writeJSON(t, path, []*webhook.Subscription{
+		{ID: "a", URL: "http://localhost/a", Secret: "s", Events: []string{util.EventUnreachable}},
+		{ID: "a", URL: "http://localhost/b", Secret: "s", Events: []string{util.EventUnreachable}},
+	})
+	viper.Set(util.WebhooksPath, path)
+	defer viper.Set(util.WebhooksPath, "")
+	resetWebhooks()
+	defer resetWebhooks()
+	if getWebhooks() != nil {
+		t.Error("expected the webhooks with a duplicate id to be disabled")
+	}
+}
+
+func TestWebhookDeadLetterPath(t *testing.T) {
+	history := viper.GetString(util.HistoryPath)
+	defer viper.Set(util.HistoryPath, history)
+
+	// the dead-letter log is kept next to the plan history, or in the jobs directory, but never in the temporary directory
+	if path, err := webhookDeadLetterPath(); err != nil || path != filepath.Join(filepath.Dir(history), util.DefaultDeadLetter) {
+		t.Errorf("expected the dead-letter log next to the plan history but got %v %v", path, err)
+	}
+	viper.Set(util.HistoryPath, "")
+	viper.Set(util.JobsPath, testDir)
+	defer viper.Set(util.JobsPath, "")
+	if path, err := webhookDeadLetterPath(); err != nil || path != filepath.Join(testDir, util.DefaultDeadLetter) {
+		t.Errorf("expected the dead-letter log in the jobs directory but got %v %v", path, err)
+	}
+	viper.Set(util.JobsPath, "")
+	if path, err := webhookDeadLetterPath(); err == nil {
+		t.Errorf("expected the dead-letter log to require a path but got %v", path)
+	}
+}
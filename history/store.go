@@ -0,0 +1,245 @@
+package history
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// The plans are kept in a bbolt file. The plans bucket has the plans by transaction ID. The time index has the transaction IDs by the
+// time of the plans, and the VIN index by the VIN and the time of the plans, so both are listed in time order.
+
+var (
+	plansBucket = []byte("plans")
+	timeIndex   = []byte("time")
+	vinIndex    = []byte("vin")
+)
+
+// ErrInvalidCursor is returned when the cursor to list the plans is not one returned by List.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// DefaultLimit is the number of plans in a page when the query has no limit.
+const DefaultLimit = 50
+
+// Store is the plan history.
+type Store struct {
+	db *bolt.DB
+}
+
+// Query filters the plans to list. Only the plans of Tenant are listed, where the default tenant is empty. Vin, From and To are optional.
+// From is inclusive and To is exclusive. Cursor continues a previous listing and Limit is the maximum number of plans in the page,
+// DefaultLimit if not set.
+type Query struct {
+	Tenant string
+	Vin    string
+	From   time.Time
+	To     time.Time
+	Cursor string
+	Limit  int
+}
+
+// Open opens the plan history in the file at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{plansBucket, timeIndex, vinIndex} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Save adds the plans to the history in one transaction, so that none of them is added if one fails. A plan with the same transaction
+// ID is replaced.
+func (s *Store) Save(records ...*model.PlanRecord) error {
+	contents := make([][]byte, len(records))
+	for i, record := range records {
+		content, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		contents[i] = content
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for i, record := range records {
+			if err := putPlan(tx, record, contents[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func putPlan(tx *bolt.Tx, record *model.PlanRecord, content []byte) error {
+	if err := deletePlan(tx, record.TransactionID); err != nil {
+		return err
+	}
+	timeKey := indexKey(record.CreatedAt, record.TransactionID)
+	if err := tx.Bucket(plansBucket).Put(idKey(record.TransactionID), content); err != nil {
+		return err
+	}
+	if err := tx.Bucket(timeIndex).Put(timeKey, nil); err != nil {
+		return err
+	}
+	return tx.Bucket(vinIndex).Put(append(vinPrefix(record.Vin), timeKey...), nil)
+}
+
+// Get returns the plan of the transaction. It returns nil if there is no such plan.
+func (s *Store) Get(transId int64) (*model.PlanRecord, error) {
+	var record *model.PlanRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		record, err = getPlan(tx, transId)
+		return err
+	})
+	return record, err
+}
+
+// List returns a page of the plans that match the query, newest first.
+func (s *Store) List(query Query) (*model.PlanPage, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultLimit
+	}
+	prefix := []byte{}
+	bucket := timeIndex
+	if query.Vin != "" {
+		prefix = vinPrefix(query.Vin)
+		bucket = vinIndex
+	}
+	lower := append(append([]byte{}, prefix...), indexKey(query.From, 0)...)
+	upper := append(append([]byte{}, prefix...), 0xff)
+	if !query.To.IsZero() {
+		upper = append(append([]byte{}, prefix...), indexKey(query.To, 0)...)
+	}
+	if query.Cursor != "" {
+		cursorKey, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err != nil || len(cursorKey) != 16 {
+			return nil, ErrInvalidCursor
+		}
+		if cursorUpper := append(append([]byte{}, prefix...), cursorKey...); bytes.Compare(cursorUpper, upper) < 0 {
+			upper = cursorUpper
+		}
+	}
+
+	page := &model.PlanPage{Plans: make([]*model.PlanRecord, 0)}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(bucket).Cursor()
+		// the keys before upper are listed backwards down to lower
+		key, _ := cursor.Seek(upper)
+		if key == nil {
+			key, _ = cursor.Last()
+		} else {
+			key, _ = cursor.Prev()
+		}
+		for ; key != nil && bytes.Compare(key, lower) >= 0; key, _ = cursor.Prev() {
+			if len(page.Plans) == query.Limit {
+				// the next page starts after the last plan of this page
+				last := page.Plans[len(page.Plans)-1]
+				page.NextCursor = base64.RawURLEncoding.EncodeToString(indexKey(last.CreatedAt, last.TransactionID))
+				break
+			}
+			record, err := getPlan(tx, int64(binary.BigEndian.Uint64(key[len(key)-8:])))
+			if err != nil {
+				return err
+			}
+			if record != nil && record.Tenant == query.Tenant {
+				page.Plans = append(page.Plans, record)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Prune deletes the plans created before the time. It returns the number of plans deleted.
+func (s *Store) Prune(before time.Time) (int, error) {
+	pruned := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		upper := indexKey(before, 0)
+		ids := make([]int64, 0)
+		cursor := tx.Bucket(timeIndex).Cursor()
+		for key, _ := cursor.First(); key != nil && bytes.Compare(key, upper) < 0; key, _ = cursor.Next() {
+			ids = append(ids, int64(binary.BigEndian.Uint64(key[8:])))
+		}
+		for _, id := range ids {
+			if err := deletePlan(tx, id); err != nil {
+				return err
+			}
+		}
+		pruned = len(ids)
+		return nil
+	})
+	return pruned, err
+}
+
+func getPlan(tx *bolt.Tx, transId int64) (*model.PlanRecord, error) {
+	content := tx.Bucket(plansBucket).Get(idKey(transId))
+	if content == nil {
+		return nil, nil
+	}
+	record := &model.PlanRecord{}
+	if err := json.Unmarshal(content, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// deletePlan deletes the plan and its index entries, if the plan exists.
+func deletePlan(tx *bolt.Tx, transId int64) error {
+	record, err := getPlan(tx, transId)
+	if err != nil || record == nil {
+		return err
+	}
+	timeKey := indexKey(record.CreatedAt, record.TransactionID)
+	if err := tx.Bucket(vinIndex).Delete(append(vinPrefix(record.Vin), timeKey...)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(timeIndex).Delete(timeKey); err != nil {
+		return err
+	}
+	return tx.Bucket(plansBucket).Delete(idKey(transId))
+}
+
+func idKey(transId int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(transId))
+	return key
+}
+
+// indexKey orders the plans by time and then by transaction ID.
+func indexKey(createdAt time.Time, transId int64) []byte {
+	key := make([]byte, 16)
+	if !createdAt.IsZero() && createdAt.UnixNano() > 0 {
+		binary.BigEndian.PutUint64(key, uint64(createdAt.UnixNano()))
+	}
+	binary.BigEndian.PutUint64(key[8:], uint64(transId))
+	return key
+}
+
+// vinPrefix separates the VIN from the time in the VIN index. VINs don't have the separator.
+func vinPrefix(vin string) []byte {
+	return append([]byte(vin), 0)
+}
@@ -0,0 +1,182 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/model"
+)
+
+// openStore opens a store in a temporary directory that is closed at the end of the test.
+func openStore(t *testing.T) *Store {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := Open(filepath.Join(dir, "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+		os.RemoveAll(dir)
+	})
+	return store
+}
+
+// plan returns a plan of the vin created minutes after start.
+func plan(transId int64, tenant, vin string, start time.Time, minutes int) *model.PlanRecord {
+	return &model.PlanRecord{TransactionID: transId, Tenant: tenant, Vin: vin, CreatedAt: start.Add(time.Duration(minutes) * time.Minute)}
+}
+
+// transIds returns the transaction IDs of the plans in the page.
+func transIds(page *model.PlanPage) []int64 {
+	ids := make([]int64, len(page.Plans))
+	for i, record := range page.Plans {
+		ids[i] = record.TransactionID
+	}
+	return ids
+}
+
+func assertTransIds(t *testing.T, name string, page *model.PlanPage, expected ...int64) {
+	ids := transIds(page)
+	if len(ids) != len(expected) {
+		t.Errorf("%v: expected plans %v but got %v", name, expected, ids)
+		return
+	}
+	for i := range ids {
+		if ids[i] != expected[i] {
+			t.Errorf("%v: expected plans %v but got %v", name, expected, ids)
+			return
+		}
+	}
+}
+
+func TestSaveGet(t *testing.T) {
+	store := openStore(t)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := store.Save(plan(1, "", "W1K2062161F0046", start, 0), plan(2, "", "W1K2062161F0046", start, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := store.Get(1)
+	if err != nil || record == nil || record.Vin != "W1K2062161F0046" || !record.CreatedAt.Equal(start) {
+		t.Fatalf("expected plan 1 but got %+v %v", record, err)
+	}
+	if record, err := store.Get(3); err != nil || record != nil {
+		t.Errorf("expected no plan 3 but got %+v %v", record, err)
+	}
+
+	// a plan saved again with another VIN and time replaces the plan and its index entries
+	if err := store.Save(plan(1, "", "W1K2062161F0080", start, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if record, _ := store.Get(1); record == nil || record.Vin != "W1K2062161F0080" {
+		t.Errorf("expected plan 1 to be replaced but got %+v", record)
+	}
+	page, err := store.List(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTransIds(t, "replaced", page, 1, 2)
+	page, _ = store.List(Query{Vin: "W1K2062161F0046"})
+	assertTransIds(t, "replaced vin", page, 2)
+}
+
+func TestList(t *testing.T) {
+	store := openStore(t)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := store.Save(
+		plan(1, "", "W1K2062161F0046", start, 0),
+		plan(2, "", "W1K2062161F0080", start, 1),
+		plan(3, "", "W1K2062161F0046", start, 2),
+		plan(4, "brand-a", "W1K2062161F0046", start, 3),
+		plan(5, "", "W1K2062161F0046", start, 4),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		query    Query
+		expected []int64
+	}{
+		{"all", Query{}, []int64{5, 3, 2, 1}},
+		{"tenant", Query{Tenant: "brand-a"}, []int64{4}},
+		{"vin", Query{Vin: "W1K2062161F0046"}, []int64{5, 3, 1}},
+		{"unknown vin", Query{Vin: "W1K2062161F0099"}, []int64{}},
+		{"from", Query{From: start.Add(time.Minute)}, []int64{5, 3, 2}},
+		{"to", Query{To: start.Add(2 * time.Minute)}, []int64{2, 1}},
+		{"vin in range", Query{Vin: "W1K2062161F0046", From: start.Add(time.Minute), To: start.Add(4 * time.Minute)}, []int64{3}},
+	}
+	for _, testCase := range testCases {
+		page, err := store.List(testCase.query)
+		if err != nil {
+			t.Errorf("%v: %v", testCase.name, err)
+			continue
+		}
+		assertTransIds(t, testCase.name, page, testCase.expected...)
+		if page.NextCursor != "" {
+			t.Errorf("%v: expected no next page but got %v", testCase.name, page.NextCursor)
+		}
+	}
+}
+
+func TestListCursor(t *testing.T) {
+	store := openStore(t)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 5; i++ {
+		if err := store.Save(plan(int64(i), "", "W1K2062161F0046", start, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the pages continue where the previous one stopped until there is no next page
+	pages := [][]int64{{5, 4}, {3, 2}, {1}}
+	query := Query{Vin: "W1K2062161F0046", Limit: 2}
+	for i, expected := range pages {
+		page, err := store.List(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTransIds(t, "page", page, expected...)
+		if last := i == len(pages)-1; last != (page.NextCursor == "") {
+			t.Fatalf("expected a next page after page %v: %v but got cursor %q", i, !last, page.NextCursor)
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	if _, err := store.List(Query{Cursor: "invalid"}); err != ErrInvalidCursor {
+		t.Errorf("expected %v but got %v", ErrInvalidCursor, err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	store := openStore(t)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := store.Save(
+		plan(1, "", "W1K2062161F0046", start, 0),
+		plan(2, "", "W1K2062161F0080", start, 1),
+		plan(3, "", "W1K2062161F0046", start, 2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the plans created before the time are deleted along with their index entries
+	pruned, err := store.Prune(start.Add(2 * time.Minute))
+	if err != nil || pruned != 2 {
+		t.Fatalf("expected 2 plans to be pruned but got %v %v", pruned, err)
+	}
+	if record, _ := store.Get(1); record != nil {
+		t.Errorf("expected plan 1 to be pruned but got %+v", record)
+	}
+	page, _ := store.List(Query{})
+	assertTransIds(t, "all", page, 3)
+	page, _ = store.List(Query{Vin: "W1K2062161F0080"})
+	assertTransIds(t, "vin", page)
+}
@@ -0,0 +1,143 @@
+package loadshed
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrShed is returned when the request is rejected because the limiter is saturated, either because the queue is full or because the
+// request waited in the queue for longer than the queue timeout.
+var ErrShed = errors.New("service is overloaded")
+
+// Config configures a Limiter. The limit starts at InitialLimit and stays between MinLimit and MaxLimit. Up to QueueSize requests wait
+// for at most QueueTimeout once the limit is reached. A request that takes longer than LatencyThreshold is a sign of overload, like a
+// request that fails from overload. Backoff is the factor the limit is multiplied with on overload.
+type Config struct {
+	InitialLimit     int
+	MinLimit         int
+	MaxLimit         int
+	QueueSize        int
+	QueueTimeout     time.Duration
+	LatencyThreshold time.Duration
+	Backoff          float64
+}
+
+// Stats is a snapshot of the limiter. Shed counts the requests rejected since the limiter was created.
+type Stats struct {
+	Limit    int
+	InFlight int
+	Queued   int
+	Shed     int64
+}
+
+// Limiter limits the number of requests in flight with an AIMD limit. The limit grows by one every limit requests that complete in time
+// while the limiter is at least half used, and is cut by the backoff factor when a request is slow or fails from overload. The requests
+// over the limit wait in a bounded FIFO queue, and are rejected right away once the queue is full.
+type Limiter struct {
+	config   Config
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	queue    *list.List
+	shed     int64
+}
+
+// waiter is a request in the queue. ready is closed when the request is let in.
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+func New(config Config) *Limiter {
+	if config.MinLimit < 1 {
+		config.MinLimit = 1
+	}
+	if config.MaxLimit < config.MinLimit {
+		config.MaxLimit = config.MinLimit
+	}
+	if config.Backoff <= 0 || config.Backoff >= 1 {
+		config.Backoff = 0.9
+	}
+	initial := math.Max(float64(config.MinLimit), math.Min(float64(config.MaxLimit), float64(config.InitialLimit)))
+	return &Limiter{config: config, limit: initial, queue: list.New()}
+}
+
+// Acquire lets the request in, waiting in the queue when the limit is reached. The returned release should be called once the request
+// completes, with overloaded set when it failed from overload, such as a timeout of the upstream API. It returns ErrShed when the request
+// is rejected, and the error of the context when it is done while the request waits.
+func (l *Limiter) Acquire(ctx context.Context) (release func(overloaded bool), err error) {
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) && l.queue.Len() == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return l.releaser(), nil
+	}
+	if l.queue.Len() >= l.config.QueueSize {
+		l.shed++
+		l.mu.Unlock()
+		return nil, ErrShed
+	}
+	w := &waiter{ready: make(chan struct{})}
+	element := l.queue.PushBack(w)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.config.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		return l.releaser(), nil
+	case <-timer.C:
+		err = ErrShed
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// the request may have been let in while it timed out
+	if w.granted {
+		return l.releaser(), nil
+	}
+	l.queue.Remove(element)
+	if err == ErrShed {
+		l.shed++
+	}
+	return nil, err
+}
+
+func (l *Limiter) releaser() func(overloaded bool) {
+	started := time.Now()
+	var once sync.Once
+	return func(overloaded bool) {
+		once.Do(func() {
+			l.release(overloaded || time.Since(started) > l.config.LatencyThreshold)
+		})
+	}
+}
+
+func (l *Limiter) release(overloaded bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if overloaded {
+		l.limit = math.Max(float64(l.config.MinLimit), l.limit*l.config.Backoff)
+	} else if float64(l.inFlight) >= l.limit/2 {
+		l.limit = math.Min(float64(l.config.MaxLimit), l.limit+1/l.limit)
+	}
+	l.inFlight--
+	for l.queue.Len() > 0 && l.inFlight < int(l.limit) {
+		w := l.queue.Remove(l.queue.Front()).(*waiter)
+		w.granted = true
+		l.inFlight++
+		close(w.ready)
+	}
+}
+
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{Limit: int(l.limit), InFlight: l.inFlight, Queued: l.queue.Len(), Shed: l.shed}
+}
@@ -0,0 +1,103 @@
+package loadshed
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// acquire lets count requests in, failing the test when one is rejected.
+func acquire(t *testing.T, l *Limiter, count int) []func(overloaded bool) {
+	releases := make([]func(overloaded bool), count)
+	for i := range releases {
+		release, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("expected request %v to be let in but got %v", i, err)
+		}
+		releases[i] = release
+	}
+	return releases
+}
+
+func TestLimiterAIMD(t *testing.T) {
+	l := New(Config{InitialLimit: 4, MinLimit: 2, MaxLimit: 6, Backoff: 0.5, LatencyThreshold: time.Hour})
+
+	// the limit grows additively while the limiter is busy, up to the max limit
+	for i := 0; i < 20; i++ {
+		for _, release := range acquire(t, l, l.Stats().Limit) {
+			release(false)
+		}
+	}
+	if limit := l.Stats().Limit; limit != 6 {
+		t.Fatalf("expected the limit to grow to the max limit but got %v", limit)
+	}
+
+	// and is cut multiplicatively on overload, down to the min limit
+	acquire(t, l, 1)[0](true)
+	if limit := l.Stats().Limit; limit != 3 {
+		t.Fatalf("expected the limit to be cut in half but got %v", limit)
+	}
+	acquire(t, l, 1)[0](true)
+	if limit := l.Stats().Limit; limit != 2 {
+		t.Fatalf("expected the limit to stop at the min limit but got %v", limit)
+	}
+
+	// a slow request is a sign of overload, and releasing twice counts once
+	l = New(Config{InitialLimit: 4, MinLimit: 1, MaxLimit: 4, Backoff: 0.5, LatencyThreshold: time.Millisecond})
+	release := acquire(t, l, 1)[0]
+	time.Sleep(5 * time.Millisecond)
+	release(false)
+	release(false)
+	if stats := l.Stats(); stats.Limit != 2 || stats.InFlight != 0 {
+		t.Errorf("expected the slow request to cut the limit once but got %+v", stats)
+	}
+
+	// an idle limiter doesn't grow
+	l = New(Config{InitialLimit: 4, MinLimit: 1, MaxLimit: 10, LatencyThreshold: time.Hour})
+	for i := 0; i < 20; i++ {
+		acquire(t, l, 1)[0](false)
+	}
+	if limit := l.Stats().Limit; limit != 4 {
+		t.Errorf("expected the limit of the idle limiter to stay but got %v", limit)
+	}
+}
+
+func TestLimiterQueue(t *testing.T) {
+	l := New(Config{InitialLimit: 1, MinLimit: 1, MaxLimit: 1, QueueSize: 1, QueueTimeout: time.Second, LatencyThreshold: time.Hour})
+	release := acquire(t, l, 1)[0]
+
+	// the request over the limit waits in the queue, and the one over the queue size is shed
+	granted := make(chan error)
+	go func() {
+		release, err := l.Acquire(context.Background())
+		if err == nil {
+			release(false)
+		}
+		granted <- err
+	}()
+	for l.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := l.Acquire(context.Background()); err != ErrShed {
+		t.Fatalf("expected the request over the queue size to be shed but got %v", err)
+	}
+	release(false)
+	if err := <-granted; err != nil {
+		t.Fatalf("expected the queued request to be let in but got %v", err)
+	}
+
+	// a request waits for at most the queue timeout or until its context is done
+	l = New(Config{InitialLimit: 1, MinLimit: 1, MaxLimit: 1, QueueSize: 2, QueueTimeout: 10 * time.Millisecond, LatencyThreshold: time.Hour})
+	acquire(t, l, 1)
+	if _, err := l.Acquire(context.Background()); err != ErrShed {
+		t.Fatalf("expected the request to be shed after the queue timeout but got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Acquire(ctx); err != context.Canceled {
+		t.Fatalf("expected the error of the context but got %v", err)
+	}
+	if stats := l.Stats(); stats.Shed != 1 || stats.Queued != 0 {
+		t.Errorf("expected one request to be shed and none queued but got %+v", stats)
+	}
+}
@@ -1,11 +1,15 @@
 package logger
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
+	"sync/atomic"
+	"time"
 
 	"github.com/SDJLee/mercedes-benz/util"
 	"github.com/natefinch/lumberjack"
@@ -17,7 +21,14 @@ import (
 // If ELK stack is available, configurations are available in this package to push the logs into ELK stack.
 
 var slogger *zap.SugaredLogger
+
+// level is the minimum level of the logs, which can be changed at runtime
+var level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
 var queue = make(chan []byte, 10000)
+
+// pending counts the logs queued or being pushed to logstash. emitting is set once the emitter is connected to logstash, and failing
+// while the logs fail to be pushed.
+var pending, emitting, failing int64
 var tag string = "merc-benz-route-checker"
 
 type lumberjackSink struct {
@@ -46,7 +57,7 @@ func init() {
 	})
 	cfg := zap.Config{
 		Encoding:      "json",
-		Level:         zap.NewAtomicLevelAt(zapcore.DebugLevel),
+		Level:         level,
 		OutputPaths:   outputPath,
 		Development:   devMode,
 		EncoderConfig: encoderConfig,
@@ -110,6 +121,11 @@ func Logger() *zap.SugaredLogger {
 	return slogger
 }
 
+// Level returns the level of the logs. It serves GET and PUT requests with the {"level":"info"} JSON to read and change it.
+func Level() zap.AtomicLevel {
+	return level
+}
+
 func SubLogger(name string) *zap.SugaredLogger {
 	return slogger.Named(name)
 }
@@ -120,6 +136,7 @@ func logstashHook(e zapcore.Entry) error {
 	if err != nil {
 		return err
 	}
+	atomic.AddInt64(&pending, 1)
 	queue <- serialized
 	return nil
 }
@@ -136,15 +153,55 @@ func logstashEmitter() {
 			conn.Close()
 		}
 	}()
+	atomic.StoreInt64(&emitting, 1)
 	for msg := range queue {
 		_, err = conn.Write(msg)
 		if err != nil {
 			fmt.Println("failed to push log to logstash", err)
+			atomic.StoreInt64(&failing, 1)
+		} else {
+			atomic.StoreInt64(&failing, 0)
 		}
+		atomic.AddInt64(&pending, -1)
 	}
 
 }
 
+// CheckShipper returns an error when the logs are not shipped to logstash.
+func CheckShipper(ctx context.Context) error {
+	switch {
+	case atomic.LoadInt64(&emitting) == 0:
+		return errors.New("not connected to logstash")
+	case atomic.LoadInt64(&failing) == 1:
+		return errors.New("failed to push logs to logstash")
+	case len(queue) == cap(queue):
+		return errors.New("logstash queue is full")
+	}
+	return nil
+}
+
+// Flush waits until the queued logs are pushed to logstash, or ctx is done, in which case it returns the error of ctx. The logs are
+// not shipped when the emitter couldn't connect to logstash, so they aren't waited for.
+func Flush(ctx context.Context) error {
+	if slogger != nil {
+		// syncing stdout fails on some terminals, which is not worth reporting
+		_ = slogger.Sync()
+	}
+	if atomic.LoadInt64(&emitting) == 0 {
+		return nil
+	}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&pending) > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v logs are not shipped. %w", atomic.LoadInt64(&pending), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
 // formats the logs
 func format(e *zapcore.Entry) ([]byte, error) {
 	fields := make(map[string]string)
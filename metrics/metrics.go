@@ -4,6 +4,7 @@ import (
 	"time"
 
 	log "github.com/SDJLee/mercedes-benz/logger"
+	"github.com/SDJLee/mercedes-benz/util"
 	"github.com/gin-gonic/gin"
 )
 
@@ -24,12 +25,23 @@ func MonitorTimeElapsed(what string) func() {
 }
 
 // MeasureApiComputationTime is a middleware function that
-// reports the time elapsed for an API to execute.
+// reports the time elapsed for an API to execute along with the transaction ID of the request, and the authenticated client, the
+// subject of the client certificate and the tenant, if any.
 func MeasureApiComputationTime() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		defer func() {
-			metricsLogger.Infof("%s took %v\n", c.Request.URL.Path, time.Since(start))
+			apiLogger := metricsLogger.With(util.TransactionIdKey, c.GetInt64(util.TransactionIdKey))
+			if clientId := c.GetString(util.ClientIdKey); clientId != "" {
+				apiLogger = apiLogger.With(util.ClientIdKey, clientId)
+			}
+			if clientCert := c.GetString(util.ClientCertKey); clientCert != "" {
+				apiLogger = apiLogger.With(util.ClientCertKey, clientCert)
+			}
+			if tenant := c.GetString(util.TenantKey); tenant != "" {
+				apiLogger = apiLogger.With(util.TenantKey, tenant)
+			}
+			apiLogger.Infof("%s took %v\n", c.Request.URL.Path, time.Since(start))
 		}()
 		c.Next()
 	}
@@ -1,9 +1,12 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"sync/atomic"
 	"time"
 
 	log "github.com/SDJLee/mercedes-benz/logger"
@@ -14,35 +17,107 @@ var statsLogger = log.SubLogger("statsd")
 // makes a buffered queue of type string of max capacity = 100
 var queue = make(chan string, 100)
 
+// pending counts the metrics queued or being sent. failing is set while the metrics fail to be sent.
+var pending, failing int64
+
 func init() {
 	go statsdSender()
 }
 
 // counter metric
 func StatCount(metric string, value int) {
-	queue <- fmt.Sprintf("%s:%d|c", metric, value)
+	enqueue(fmt.Sprintf("%s:%d|c", metric, value))
 }
 
 // timer metric
 func StatTime(metric string) func() {
 	start := time.Now()
 	return func() {
-		queue <- fmt.Sprintf("%s:%d|ms", metric, time.Since(start)/1e6)
+		enqueue(fmt.Sprintf("%s:%d|ms", metric, time.Since(start)/1e6))
+	}
+}
+
+// gauge metric
+func StatGauge(metric string, value int) {
+	enqueue(fmt.Sprintf("%s:%d|g", metric, value))
+}
+
+// Prefix sends the metrics with their names prefixed, such as the metrics of a tenant. The empty prefix sends them as they are.
+type Prefix string
+
+func (p Prefix) StatCount(metric string, value int) {
+	StatCount(p.name(metric), value)
+}
+
+func (p Prefix) StatTime(metric string) func() {
+	return StatTime(p.name(metric))
+}
+
+func (p Prefix) StatGauge(metric string, value int) {
+	StatGauge(p.name(metric), value)
+}
+
+func (p Prefix) name(metric string) string {
+	if p == "" {
+		return metric
 	}
+	return string(p) + "." + metric
+}
+
+func enqueue(msg string) {
+	atomic.AddInt64(&pending, 1)
+	queue <- msg
 }
 
 // pushes metrics into graphite's udp port
 func statsdSender() {
 	for msg := range queue {
-		conn, err := net.Dial("udp", os.Getenv("GRAPHITE_URL"))
-		if err != nil {
-			continue
-		}
+		send(msg)
+		atomic.AddInt64(&pending, -1)
+	}
+}
+
+func send(msg string) {
+	conn, err := net.Dial("udp", os.Getenv("GRAPHITE_URL"))
+	if err != nil {
+		atomic.StoreInt64(&failing, 1)
+		return
+	}
+	_, err = conn.Write([]byte(msg + "\n"))
+	if err != nil {
+		statsLogger.Error(err)
+		atomic.StoreInt64(&failing, 1)
+	} else {
+		atomic.StoreInt64(&failing, 0)
+	}
+	_ = conn.Close()
+}
+
+// Check returns an error when the metrics are not sent to statsd. Statsd is reached over UDP, so only the address and the local
+// failures are checked.
+func Check(ctx context.Context) error {
+	if _, err := net.ResolveUDPAddr("udp", os.Getenv("GRAPHITE_URL")); err != nil {
+		return err
+	}
+	switch {
+	case atomic.LoadInt64(&failing) == 1:
+		return errors.New("failed to send metrics to statsd")
+	case len(queue) == cap(queue):
+		return errors.New("statsd queue is full")
+	}
+	return nil
+}
 
-		_, err = conn.Write([]byte(msg + "\n"))
-		if err != nil {
-			statsLogger.Error(err)
+// Flush waits until the queued metrics are sent, or ctx is done, in which case it returns the error of ctx.
+func Flush(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&pending) > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v metrics are not sent. %w", atomic.LoadInt64(&pending), ctx.Err())
+		case <-ticker.C:
 		}
-		_ = conn.Close()
 	}
+	return nil
 }
@@ -0,0 +1,31 @@
+package model
+
+// BatchItem is the result of a request in a batch. Index is the position of the request in the batch. Error is set when the request
+// in the batch is invalid, in which case there is no response, and InvalidParams are its fields that failed validation, if any.
+type BatchItem struct {
+	Index         int             `json:"index"`
+	Response      *Response       `json:"response,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	InvalidParams []*InvalidParam `json:"invalidParams,omitempty"`
+}
+
+// BatchSummary counts the results of a batch. Succeeded counts the responses without errors, of which ChargingRequired counts the ones
+// that need charging. Unreachable counts the responses with error 8888 and Failed counts the invalid requests and the responses with error 9999.
+type BatchSummary struct {
+	Total            int `json:"total"`
+	Succeeded        int `json:"succeeded"`
+	ChargingRequired int `json:"chargingRequired"`
+	Unreachable      int `json:"unreachable"`
+	Failed           int `json:"failed"`
+}
+
+// BatchProgress is a step of the request at Index in a batch, with the data of the step.
+type BatchProgress struct {
+	Index int         `json:"index"`
+	Data  interface{} `json:"data"`
+}
+
+type BatchResponse struct {
+	Results []*BatchItem `json:"results"`
+	Summary BatchSummary `json:"summary"`
+}
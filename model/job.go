@@ -0,0 +1,36 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// JobRequest submits a request or a batch of requests to be computed asynchronously. When CallbackURL is set, the job is posted to it once it is done.
+type JobRequest struct {
+	Request     *Request          `json:"request,omitempty"`
+	Batch       []json.RawMessage `json:"batch,omitempty"`
+	CallbackURL string            `json:"callbackUrl,omitempty"`
+}
+
+// Job is a request or a batch of requests computed asynchronously. The result is set once the job is completed. The job is computed
+// for the tenant that submitted it, if any.
+type Job struct {
+	ID          string            `json:"id"`
+	Status      string            `json:"status"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+	CallbackURL string            `json:"callbackUrl,omitempty"`
+	Tenant      string            `json:"tenant,omitempty"`
+	Request     *Request          `json:"request,omitempty"`
+	Batch       []json.RawMessage `json:"batch,omitempty"`
+	Result      *Response         `json:"result,omitempty"`
+	BatchResult *BatchResponse    `json:"batchResult,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// PlanRecord is a computed plan kept in the plan history. ChargeLevel, Distance and Stations are the upstream responses the plan was
+// computed with, and are nil when the plan didn't need them or failed before them. AlgorithmVersion, ReserveCharge, VehicleProfile and
+// PreferredWeight are the planner, the reserve, the profile of the vehicle and the weight of the preferred operators the plan was
+// computed with, so that it can be replayed. VehicleProfile is nil when no profile matched the VIN. Duration is the time taken to
+// compute the plan. Tenant is the tenant the plan was computed for, if any.
+type PlanRecord struct {
+	TransactionID    int64              `json:"transactionId,string"`
+	Tenant           string             `json:"tenant,omitempty"`
+	Vin              string             `json:"vin"`
+	CreatedAt        time.Time          `json:"createdAt"`
+	DurationMs       int64              `json:"durationMs"`
+	AlgorithmVersion string             `json:"algorithmVersion,omitempty"`
+	ReserveCharge    int64              `json:"reserveCharge"`
+	VehicleProfile   *VehicleProfile    `json:"vehicleProfile,omitempty"`
+	PreferredWeight  int64              `json:"preferredOperatorWeight,omitempty"`
+	Request          *Request           `json:"request"`
+	ChargeLevel      *ResChargeLevel    `json:"chargeLevel,omitempty"`
+	Distance         *ResTravelDistance `json:"distance,omitempty"`
+	Stations         *ResChargeStations `json:"stations,omitempty"`
+	Response         *Response          `json:"response"`
+}
+
+// PlanPage is a page of plans from the plan history, newest first. NextCursor fetches the next page and is empty on the last page.
+type PlanPage struct {
+	Plans      []*PlanRecord `json:"plans"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// PlanReplay is a plan recomputed with the inputs it was originally computed with. Differences are the fields of the response that
+// differ between the original and the replayed plan. There are no differences when the plan is reproduced.
+type PlanReplay struct {
+	TransactionID   int64             `json:"transactionId,string"`
+	OriginalVersion string            `json:"originalVersion"`
+	ReplayedVersion string            `json:"replayedVersion"`
+	Original        *Response         `json:"original"`
+	Replayed        *Response         `json:"replayed"`
+	Differences     []*PlanDifference `json:"differences"`
+}
+
+// PlanDifference is a field of the response with its original and replayed values. A value is null when the field is not in the response.
+type PlanDifference struct {
+	Field    string      `json:"field"`
+	Original interface{} `json:"original"`
+	Replayed interface{} `json:"replayed"`
+}
@@ -0,0 +1,26 @@
+package model
+
+// Problem is an error response in the RFC 7807 problem details format. Code is the machine-readable code of the problem, Endpoint
+// is the upstream endpoint that caused the problem, if any, and InvalidParams are the fields that failed validation, if any.
+type Problem struct {
+	Type          string          `json:"type"`
+	Title         string          `json:"title"`
+	Status        int             `json:"status"`
+	Detail        string          `json:"detail,omitempty"`
+	Instance      string          `json:"instance,omitempty"`
+	Code          string          `json:"code"`
+	TransactionID int64           `json:"transactionId,string,omitempty"`
+	Endpoint      string          `json:"endpoint,omitempty"`
+	InvalidParams []*InvalidParam `json:"invalid-params,omitempty"`
+}
+
+// InvalidParam is a field of the request that failed validation. Name is the path to the field in the request.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ResInvalidRequest is the v1 response for a request that failed validation.
+type ResInvalidRequest struct {
+	InvalidParams []*InvalidParam `json:"invalidParams"`
+}
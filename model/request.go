@@ -1,9 +1,24 @@
 package model
 
+// Request is validated on binding. The VIN should be 11 to 17 characters long with a valid check digit where it applies, and the source and
+// destination should be different locations of at most 100 characters.
 type Request struct {
-	Vin         string `json:"vin"`
-	Source      string `json:"source"`
-	Destination string `json:"destination"`
+	Vin         string `json:"vin" binding:"required,min=11,max=17,vinchars,vincheck"`
+	Source      string `json:"source" binding:"required,max=100,location"`
+	Destination string `json:"destination" binding:"required,max=100,location"`
+	// StationOrder is the order of the charging stations in response. It is either "name" for the lexicographic order of names,
+	// which is the default, or "driving" for the order the car reaches them.
+	StationOrder string `json:"stationOrder,omitempty" binding:"omitempty,oneof=name driving"`
+	Preferences
+}
+
+// Preferences are the options a driver sets to plan the route. Stations and operators to avoid and the maximum number of stops are
+// hard constraints. Preferred operators are a soft preference that is weighed against the charge a station provides.
+type Preferences struct {
+	AvoidStations   []string `json:"avoidStations,omitempty" binding:"max=50,dive,required,max=100"`
+	AvoidOperators  []string `json:"avoidOperators,omitempty" binding:"max=50,dive,required,max=100"`
+	PreferOperators []string `json:"preferOperators,omitempty" binding:"max=50,dive,required,max=100"`
+	MaxStops        int      `json:"maxStops,omitempty" binding:"min=0,max=50"`
 }
 
 type ReqTravelDistance struct {
@@ -13,18 +13,61 @@ type Station struct {
 	Name     string `json:"name"`
 	Limit    int64  `json:"limit"`
 	Distance int64  `json:"distance"`
+	// Detour is the distance in miles between the route and the station. It is 0 when the station is on the route.
+	Detour int64 `json:"detour,omitempty"`
+	// OpeningHours is the daily window in which the station is open, in "HH:MM-HH:MM" format. The station is open all day when it is empty.
+	OpeningHours string   `json:"openingHours,omitempty"`
+	Connectors   []string `json:"connectors,omitempty"`
+	// MaxPower is the maximum charging power of the station in kW.
+	MaxPower float64 `json:"maxPower,omitempty"`
+	Operator string  `json:"operator,omitempty"`
+	// Available is the live availability of the station. The station is considered available when it is null.
+	Available null.Bool `json:"available"`
+}
+
+// ResPreferences states the driver preferences applied to plan the route. PreferredStops are the stops operated by a preferred operator.
+// PreferencesRelaxed is true when the preferred operators were ignored to plan the route within MaxStops.
+type ResPreferences struct {
+	AvoidedStations    []string `json:"avoidedStations,omitempty"`
+	AvoidedOperators   []string `json:"avoidedOperators,omitempty"`
+	PreferredOperators []string `json:"preferredOperators,omitempty"`
+	PreferredStops     []string `json:"preferredStops,omitempty"`
+	MaxStops           int      `json:"maxStops,omitempty"`
+	PreferencesRelaxed bool     `json:"preferencesRelaxed,omitempty"`
+}
+
+// ResExcludedStation is a station left out of planning along with the reason for excluding it.
+type ResExcludedStation struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ResStop is a station where the car stops to recharge. DetourOverhead is the distance travelled off the route to reach the station and come back.
+// Charge is the charge to take at the station, which can be less than the station's limit when the rest of the trip doesn't need it.
+type ResStop struct {
+	Name           string `json:"name"`
+	Distance       int64  `json:"distance"`
+	Detour         int64  `json:"detour"`
+	DetourOverhead int64  `json:"detourOverhead"`
+	Charge         int64  `json:"charge"`
+	// MaxPower is the maximum charging power of the station in kW, when the upstream API reports it.
+	MaxPower float64 `json:"maxPower,omitempty"`
 }
 
 type Response struct {
-	TransactionID      int64       `json:"transactionId"`
-	Vin                null.String `json:"vin"`
-	Source             null.String `json:"source"`
-	Destination        null.String `json:"destination"`
-	Distance           null.Int    `json:"distance,omitempty"`
-	CurrentChargeLevel null.Int    `json:"currentChargeLevel,omitempty"`
-	IsChargingRequired null.Bool   `json:"isChargingRequired,omitempty"`
-	ChargingStations   []string    `json:"chargingStations,omitempty"`
-	Errors             []*ResError `json:"errors,omitempty"`
+	TransactionID      int64                 `json:"transactionId,string"`
+	Vin                null.String           `json:"vin"`
+	Source             null.String           `json:"source"`
+	Destination        null.String           `json:"destination"`
+	Distance           null.Int              `json:"distance,omitempty"`
+	CurrentChargeLevel null.Int              `json:"currentChargeLevel,omitempty"`
+	IsChargingRequired null.Bool             `json:"isChargingRequired,omitempty"`
+	ChargingStations   []string              `json:"chargingStations,omitempty"`
+	Stops              []*ResStop            `json:"stops,omitempty"`
+	DetourOverhead     null.Int              `json:"detourOverhead,omitempty"`
+	ExcludedStations   []*ResExcludedStation `json:"excludedStations,omitempty"`
+	AppliedPreferences *ResPreferences       `json:"appliedPreferences,omitempty"`
+	Errors             []*ResError           `json:"errors,omitempty"`
 }
 
 // { "source": "source name", "destination": "destination name""distance": "100 //distance between the source and destination in miles", "error": "It will be null if No Error" }
@@ -35,7 +78,7 @@ type ResTravelDistance struct {
 	Error       null.String `json:"error"`
 }
 
-//{ "vin": "vehicle identification number", "currentChargeLevel": "current battery charge level in percentage, 0<=charge<=100 eg: 1", "error": "It will be null if No Error" }
+// { "vin": "vehicle identification number", "currentChargeLevel": "current battery charge level in percentage, 0<=charge<=100 eg: 1", "error": "It will be null if No Error" }
 type ResChargeLevel struct {
 	Vin                string      `json:"vin"`
 	CurrentChargeLevel int64       `json:"currentChargeLevel"`
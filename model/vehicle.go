@@ -0,0 +1,8 @@
+package model
+
+// VehicleProfile describes the charging capabilities of the vehicles whose VIN starts with VinPrefix.
+type VehicleProfile struct {
+	Name       string   `json:"name"`
+	VinPrefix  string   `json:"vinPrefix"`
+	Connectors []string `json:"connectors"`
+}
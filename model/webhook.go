@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookEvent is the event posted to the webhook subscriptions to its type. Data is the plan the event is about.
+type WebhookEvent struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	CreatedAt time.Time  `json:"createdAt"`
+	Data      *PlanEvent `json:"data"`
+}
+
+// PlanEvent is the plan a webhook event is about. Stops is the number of charging stops of the plan and Errors are the errors of its
+// response, such as error 8888 for an unreachable destination.
+type PlanEvent struct {
+	TransactionID    int64       `json:"transactionId,string"`
+	Tenant           string      `json:"tenant,omitempty"`
+	Vin              string      `json:"vin"`
+	Source           string      `json:"source"`
+	Destination      string      `json:"destination"`
+	Distance         int64       `json:"distance,omitempty"`
+	Stops            int         `json:"stops"`
+	ChargingStations []string    `json:"chargingStations,omitempty"`
+	Errors           []*ResError `json:"errors,omitempty"`
+}
+
+// WebhookDelivery is the delivery of an event to a subscription. It is pending until the subscriber responds with a 2xx status, and
+// failed once every attempt has failed, in which case it is written to the dead-letter log. NextAttemptAt is the time of the next
+// attempt of a pending delivery, and LastStatusCode and LastError describe the last failed attempt.
+type WebhookDelivery struct {
+	ID             string     `json:"id"`
+	Subscription   string     `json:"subscription"`
+	EventID        string     `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"lastStatusCode,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket that holds up to Burst tokens and is refilled with Rate tokens per second. A request takes a token.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%g requests per second with bursts of %v", l.Rate, l.Burst)
+}
+
+// Result is the outcome of taking a token. RetryAfter is the time until the bucket has a token again when the request is not allowed.
+type Result struct {
+	Allowed    bool
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from the buckets of the keys.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// sweepInterval is the interval between the deletions of the buckets that are full, which are the same as no bucket.
+const sweepInterval = time.Minute
+
+// bucket has the tokens left at the last request. full is the time it takes to refill the empty bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Duration
+}
+
+// Memory keeps the buckets in memory. The limits are per replica, so it fits a single replica.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+		m.lastSweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		full := time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second))
+		b = &bucket{tokens: float64(limit.Burst), last: now, full: full}
+		m.buckets[key] = b
+	}
+	b.tokens = refill(b.tokens, now.Sub(b.last), limit)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return Result{Allowed: true}, nil
+	}
+	return Result{RetryAfter: waitTime(b.tokens, limit)}, nil
+}
+
+// sweep deletes the buckets idle for long enough to be full.
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if now.Sub(b.last) >= b.full {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func refill(tokens float64, elapsed time.Duration, limit Limit) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.Rate)
+}
+
+// waitTime is the time until the bucket with the tokens has a whole token.
+func waitTime(tokens float64, limit Limit) time.Duration {
+	return time.Duration(math.Ceil((1 - tokens) / limit.Rate * float64(time.Second)))
+}
@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryAllow(t *testing.T) {
+	m := NewMemory()
+	limit := Limit{Rate: 10, Burst: 2}
+
+	// the burst is allowed at once and the next request waits for the refill
+	for i := 0; i < 2; i++ {
+		if result, err := m.Allow(context.Background(), "client", limit); err != nil || !result.Allowed {
+			t.Fatalf("expected request %v of the burst to be allowed but got %+v %v", i, result, err)
+		}
+	}
+	result, err := m.Allow(context.Background(), "client", limit)
+	if err != nil || result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > 100*time.Millisecond {
+		t.Fatalf("expected the request over the burst to wait up to 100ms but got %+v %v", result, err)
+	}
+
+	// the buckets of the keys are separate
+	if result, _ := m.Allow(context.Background(), "other", limit); !result.Allowed {
+		t.Errorf("expected the request of another key to be allowed but got %+v", result)
+	}
+
+	time.Sleep(result.RetryAfter)
+	if result, _ := m.Allow(context.Background(), "client", limit); !result.Allowed {
+		t.Errorf("expected the request to be allowed after the refill but got %+v", result)
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	m := NewMemory()
+	limit := Limit{Rate: 1000, Burst: 1}
+	m.Allow(context.Background(), "idle", limit)
+	time.Sleep(5 * time.Millisecond)
+	m.Allow(context.Background(), "busy", limit)
+
+	// the bucket that is full again is the same as no bucket, so it is deleted
+	m.sweep(time.Now())
+	if _, ok := m.buckets["idle"]; ok {
+		t.Error("expected the full bucket to be deleted")
+	}
+	if _, ok := m.buckets["busy"]; !ok {
+		t.Error("expected the bucket being refilled to be kept")
+	}
+}
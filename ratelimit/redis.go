@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// tokenBucket takes a token from the bucket at KEYS[1] with the rate in ARGV[1], the burst in ARGV[2] and the time in milliseconds in
+// ARGV[3]. It returns 1 and 0 when the token is taken, or 0 and the milliseconds to wait for a token otherwise. The bucket expires once
+// it would be full again. HMSET is used over the multi-field HSET to work with Redis 3.
+var tokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(bucket[1])
+local last = tonumber(bucket[2])
+if tokens == nil or last == nil then
+	tokens = burst
+	last = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate / 1000)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, wait}
+`)
+
+// Redis keeps the buckets in Redis, so that the limits are shared by the replicas. The client is any Redis-compatible client that can run
+// scripts, such as redis.Client, redis.ClusterClient or redis.Ring. The time is taken from the replicas, which should have synced clocks.
+type Redis struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedis returns the limiter with the buckets in Redis under the key prefix.
+func NewRedis(client redis.Scripter, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+func (r *Redis) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	values, err := tokenBucket.Run(ctx, r.client, []string{r.prefix + key}, limit.Rate, limit.Burst, now).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 2 {
+		return Result{}, fmt.Errorf("unexpected token bucket result %v", values)
+	}
+	if values[0] == 1 {
+		return Result{Allowed: true}, nil
+	}
+	return Result{RetryAfter: time.Duration(values[1]) * time.Millisecond}, nil
+}
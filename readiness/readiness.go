@@ -0,0 +1,132 @@
+package readiness
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+)
+
+// Check checks a dependency. It returns an error when the dependency can't be used.
+type Check func(ctx context.Context) error
+
+// Component is the outcome of the last check of a dependency. A critical component that is down makes the service not ready.
+type Component struct {
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latencyMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Report is the readiness of the service with the components by name. The status is down when a critical component is down, and
+// degraded when another component is down.
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+// Checker runs the registered checks at once. The outcome of a check is reused for the cache duration, so frequent probes don't load
+// the dependencies, and each check is bounded by the timeout.
+type Checker struct {
+	cacheFor time.Duration
+	timeout  time.Duration
+	mu       sync.Mutex
+	checks   map[string]*entry
+}
+
+type entry struct {
+	check    Check
+	critical bool
+	mu       sync.Mutex
+	last     *Component
+}
+
+func New(cacheFor time.Duration, timeout time.Duration) *Checker {
+	return &Checker{cacheFor: cacheFor, timeout: timeout, checks: make(map[string]*entry)}
+}
+
+// Register adds the check of the component, replacing the check registered with the same name.
+func (c *Checker) Register(name string, critical bool, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = &entry{check: check, critical: critical}
+}
+
+// Invalidate drops the cached outcome of the checks, so that the next run checks every component.
+func (c *Checker) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.checks {
+		e.mu.Lock()
+		e.last = nil
+		e.mu.Unlock()
+	}
+}
+
+// Run checks the components whose cached outcome expired and reports all of them.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := make(map[string]*entry, len(c.checks))
+	for name, e := range c.checks {
+		checks[name] = e
+	}
+	c.mu.Unlock()
+
+	report := Report{Status: StatusUp, Components: make(map[string]Component, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, e := range checks {
+		wg.Add(1)
+		go func(name string, e *entry) {
+			defer wg.Done()
+			component := c.run(ctx, e)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[name] = component
+			if component.Status == StatusDown {
+				if component.Critical {
+					report.Status = StatusDown
+				} else if report.Status == StatusUp {
+					report.Status = StatusDegraded
+				}
+			}
+		}(name, e)
+	}
+	wg.Wait()
+	return report
+}
+
+// run checks the component unless its outcome is cached. Concurrent runs wait for the check in progress.
+func (c *Checker) run(ctx context.Context, e *entry) Component {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.last != nil && time.Since(e.last.CheckedAt) < c.cacheFor {
+		return *e.last
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	started := time.Now()
+	// a check that doesn't honour ctx is reported down on timeout and left to complete in the background
+	done := make(chan error, 1)
+	go func() {
+		done <- e.check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	component := Component{Status: StatusUp, Critical: e.critical, LatencyMs: time.Since(started).Milliseconds(), CheckedAt: started}
+	if err != nil {
+		component.Status, component.Error = StatusDown, err.Error()
+	}
+	e.last = &component
+	return component
+}
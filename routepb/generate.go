@@ -0,0 +1,5 @@
+// Package routepb has the protobuf messages and the gRPC service of the route checker, generated from route_checker.proto with buf,
+// protoc-gen-go v1.27.1 and protoc-gen-go-grpc v1.1.0.
+package routepb
+
+//go:generate buf generate --template buf.gen.yaml .
@@ -0,0 +1,843 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        (unknown)
+// source: route_checker.proto
+
+package routepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type StationOrder int32
+
+const (
+	// the stations are ordered by their names
+	StationOrder_STATION_ORDER_UNSPECIFIED StationOrder = 0
+	StationOrder_STATION_ORDER_NAME        StationOrder = 1
+	StationOrder_STATION_ORDER_DRIVING     StationOrder = 2
+)
+
+// Enum value maps for StationOrder.
+var (
+	StationOrder_name = map[int32]string{
+		0: "STATION_ORDER_UNSPECIFIED",
+		1: "STATION_ORDER_NAME",
+		2: "STATION_ORDER_DRIVING",
+	}
+	StationOrder_value = map[string]int32{
+		"STATION_ORDER_UNSPECIFIED": 0,
+		"STATION_ORDER_NAME":        1,
+		"STATION_ORDER_DRIVING":     2,
+	}
+)
+
+func (x StationOrder) Enum() *StationOrder {
+	p := new(StationOrder)
+	*p = x
+	return p
+}
+
+func (x StationOrder) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (StationOrder) Descriptor() protoreflect.EnumDescriptor {
+	return file_route_checker_proto_enumTypes[0].Descriptor()
+}
+
+func (StationOrder) Type() protoreflect.EnumType {
+	return &file_route_checker_proto_enumTypes[0]
+}
+
+func (x StationOrder) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use StationOrder.Descriptor instead.
+func (StationOrder) EnumDescriptor() ([]byte, []int) {
+	return file_route_checker_proto_rawDescGZIP(), []int{0}
+}
+
+type ComputeRouteRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Vin          string       `protobuf:"bytes,1,opt,name=vin,proto3" json:"vin,omitempty"`
+	Source       string       `protobuf:"bytes,2,opt,name=source,proto3" json:"source,omitempty"`
+	Destination  string       `protobuf:"bytes,3,opt,name=destination,proto3" json:"destination,omitempty"`
+	StationOrder StationOrder `protobuf:"varint,4,opt,name=station_order,json=stationOrder,proto3,enum=routechecker.v1.StationOrder" json:"station_order,omitempty"`
+	Preferences  *Preferences `protobuf:"bytes,5,opt,name=preferences,proto3" json:"preferences,omitempty"`
+}
+
+func (x *ComputeRouteRequest) Reset() {
+	*x = ComputeRouteRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_route_checker_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ComputeRouteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ComputeRouteRequest) ProtoMessage() {}
+
+func (x *ComputeRouteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_route_checker_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ComputeRouteRequest.ProtoReflect.Descriptor instead.
+func (*ComputeRouteRequest) Descriptor() ([]byte, []int) {
+	return file_route_checker_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ComputeRouteRequest) GetVin() string {
+	if x != nil {
+		return x.Vin
+	}
+	return ""
+}
+
+func (x *ComputeRouteRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *ComputeRouteRequest) GetDestination() string {
+	if x != nil {
+		return x.Destination
+	}
+	return ""
+}
+
+func (x *ComputeRouteRequest) GetStationOrder() StationOrder {
+	if x != nil {
+		return x.StationOrder
+	}
+	return StationOrder_STATION_ORDER_UNSPECIFIED
+}
+
+func (x *ComputeRouteRequest) GetPreferences() *Preferences {
+	if x != nil {
+		return x.Preferences
+	}
+	return nil
+}
+
+// Preferences are the stations and operators to avoid and the maximum number of stops, which are hard constraints, and the preferred operators.
+type Preferences struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	AvoidStations   []string `protobuf:"bytes,1,rep,name=avoid_stations,json=avoidStations,proto3" json:"avoid_stations,omitempty"`
+	AvoidOperators  []string `protobuf:"bytes,2,rep,name=avoid_operators,json=avoidOperators,proto3" json:"avoid_operators,omitempty"`
+	PreferOperators []string `protobuf:"bytes,3,rep,name=prefer_operators,json=preferOperators,proto3" json:"prefer_operators,omitempty"`
+	MaxStops        int32    `protobuf:"varint,4,opt,name=max_stops,json=maxStops,proto3" json:"max_stops,omitempty"`
+}
+
+func (x *Preferences) Reset() {
+	*x = Preferences{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_route_checker_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Preferences) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Preferences) ProtoMessage() {}
+
+func (x *Preferences) ProtoReflect() protoreflect.Message {
+	mi := &file_route_checker_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Preferences.ProtoReflect.Descriptor instead.
+func (*Preferences) Descriptor() ([]byte, []int) {
+	return file_route_checker_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Preferences) GetAvoidStations() []string {
+	if x != nil {
+		return x.AvoidStations
+	}
+	return nil
+}
+
+func (x *Preferences) GetAvoidOperators() []string {
+	if x != nil {
+		return x.AvoidOperators
+	}
+	return nil
+}
+
+func (x *Preferences) GetPreferOperators() []string {
+	if x != nil {
+		return x.PreferOperators
+	}
+	return nil
+}
+
+func (x *Preferences) GetMaxStops() int32 {
+	if x != nil {
+		return x.MaxStops
+	}
+	return 0
+}
+
+type ComputeRouteResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TransactionId      int64               `protobuf:"varint,1,opt,name=transaction_id,json=transactionId,proto3" json:"transaction_id,omitempty"`
+	Vin                string              `protobuf:"bytes,2,opt,name=vin,proto3" json:"vin,omitempty"`
+	Source             string              `protobuf:"bytes,3,opt,name=source,proto3" json:"source,omitempty"`
+	Destination        string              `protobuf:"bytes,4,opt,name=destination,proto3" json:"destination,omitempty"`
+	Distance           int64               `protobuf:"varint,5,opt,name=distance,proto3" json:"distance,omitempty"`
+	CurrentChargeLevel int64               `protobuf:"varint,6,opt,name=current_charge_level,json=currentChargeLevel,proto3" json:"current_charge_level,omitempty"`
+	IsChargingRequired bool                `protobuf:"varint,7,opt,name=is_charging_required,json=isChargingRequired,proto3" json:"is_charging_required,omitempty"`
+	ChargingStations   []string            `protobuf:"bytes,8,rep,name=charging_stations,json=chargingStations,proto3" json:"charging_stations,omitempty"`
+	Stops              []*Stop             `protobuf:"bytes,9,rep,name=stops,proto3" json:"stops,omitempty"`
+	DetourOverhead     int64               `protobuf:"varint,10,opt,name=detour_overhead,json=detourOverhead,proto3" json:"detour_overhead,omitempty"`
+	ExcludedStations   []*ExcludedStation  `protobuf:"bytes,11,rep,name=excluded_stations,json=excludedStations,proto3" json:"excluded_stations,omitempty"`
+	AppliedPreferences *AppliedPreferences `protobuf:"bytes,12,opt,name=applied_preferences,json=appliedPreferences,proto3" json:"applied_preferences,omitempty"`
+}
+
+func (x *ComputeRouteResponse) Reset() {
+	*x = ComputeRouteResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_route_checker_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ComputeRouteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ComputeRouteResponse) ProtoMessage() {}
+
+func (x *ComputeRouteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_route_checker_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ComputeRouteResponse.ProtoReflect.Descriptor instead.
+func (*ComputeRouteResponse) Descriptor() ([]byte, []int) {
+	return file_route_checker_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ComputeRouteResponse) GetTransactionId() int64 {
+	if x != nil {
+		return x.TransactionId
+	}
+	return 0
+}
+
+func (x *ComputeRouteResponse) GetVin() string {
+	if x != nil {
+		return x.Vin
+	}
+	return ""
+}
+
+func (x *ComputeRouteResponse) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *ComputeRouteResponse) GetDestination() string {
+	if x != nil {
+		return x.Destination
+	}
+	return ""
+}
+
+func (x *ComputeRouteResponse) GetDistance() int64 {
+	if x != nil {
+		return x.Distance
+	}
+	return 0
+}
+
+func (x *ComputeRouteResponse) GetCurrentChargeLevel() int64 {
+	if x != nil {
+		return x.CurrentChargeLevel
+	}
+	return 0
+}
+
+func (x *ComputeRouteResponse) GetIsChargingRequired() bool {
+	if x != nil {
+		return x.IsChargingRequired
+	}
+	return false
+}
+
+func (x *ComputeRouteResponse) GetChargingStations() []string {
+	if x != nil {
+		return x.ChargingStations
+	}
+	return nil
+}
+
+func (x *ComputeRouteResponse) GetStops() []*Stop {
+	if x != nil {
+		return x.Stops
+	}
+	return nil
+}
+
+func (x *ComputeRouteResponse) GetDetourOverhead() int64 {
+	if x != nil {
+		return x.DetourOverhead
+	}
+	return 0
+}
+
+func (x *ComputeRouteResponse) GetExcludedStations() []*ExcludedStation {
+	if x != nil {
+		return x.ExcludedStations
+	}
+	return nil
+}
+
+func (x *ComputeRouteResponse) GetAppliedPreferences() *AppliedPreferences {
+	if x != nil {
+		return x.AppliedPreferences
+	}
+	return nil
+}
+
+// Stop is a charging stop in driving order. charge is the charge to take at the stop, and max_power the maximum charging power of the
+// station in kW, or 0 when the upstream API doesn't report it.
+type Stop struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name           string  `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Distance       int64   `protobuf:"varint,2,opt,name=distance,proto3" json:"distance,omitempty"`
+	Detour         int64   `protobuf:"varint,3,opt,name=detour,proto3" json:"detour,omitempty"`
+	DetourOverhead int64   `protobuf:"varint,4,opt,name=detour_overhead,json=detourOverhead,proto3" json:"detour_overhead,omitempty"`
+	Charge         int64   `protobuf:"varint,5,opt,name=charge,proto3" json:"charge,omitempty"`
+	MaxPower       float64 `protobuf:"fixed64,6,opt,name=max_power,json=maxPower,proto3" json:"max_power,omitempty"`
+}
+
+func (x *Stop) Reset() {
+	*x = Stop{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_route_checker_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Stop) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stop) ProtoMessage() {}
+
+func (x *Stop) ProtoReflect() protoreflect.Message {
+	mi := &file_route_checker_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stop.ProtoReflect.Descriptor instead.
+func (*Stop) Descriptor() ([]byte, []int) {
+	return file_route_checker_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Stop) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Stop) GetDistance() int64 {
+	if x != nil {
+		return x.Distance
+	}
+	return 0
+}
+
+func (x *Stop) GetDetour() int64 {
+	if x != nil {
+		return x.Detour
+	}
+	return 0
+}
+
+func (x *Stop) GetDetourOverhead() int64 {
+	if x != nil {
+		return x.DetourOverhead
+	}
+	return 0
+}
+
+func (x *Stop) GetCharge() int64 {
+	if x != nil {
+		return x.Charge
+	}
+	return 0
+}
+
+func (x *Stop) GetMaxPower() float64 {
+	if x != nil {
+		return x.MaxPower
+	}
+	return 0
+}
+
+type ExcludedStation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name   string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Reason string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+func (x *ExcludedStation) Reset() {
+	*x = ExcludedStation{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_route_checker_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ExcludedStation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExcludedStation) ProtoMessage() {}
+
+func (x *ExcludedStation) ProtoReflect() protoreflect.Message {
+	mi := &file_route_checker_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExcludedStation.ProtoReflect.Descriptor instead.
+func (*ExcludedStation) Descriptor() ([]byte, []int) {
+	return file_route_checker_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ExcludedStation) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ExcludedStation) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type AppliedPreferences struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	AvoidedStations    []string `protobuf:"bytes,1,rep,name=avoided_stations,json=avoidedStations,proto3" json:"avoided_stations,omitempty"`
+	AvoidedOperators   []string `protobuf:"bytes,2,rep,name=avoided_operators,json=avoidedOperators,proto3" json:"avoided_operators,omitempty"`
+	PreferredOperators []string `protobuf:"bytes,3,rep,name=preferred_operators,json=preferredOperators,proto3" json:"preferred_operators,omitempty"`
+	PreferredStops     []string `protobuf:"bytes,4,rep,name=preferred_stops,json=preferredStops,proto3" json:"preferred_stops,omitempty"`
+	MaxStops           int32    `protobuf:"varint,5,opt,name=max_stops,json=maxStops,proto3" json:"max_stops,omitempty"`
+	PreferencesRelaxed bool     `protobuf:"varint,6,opt,name=preferences_relaxed,json=preferencesRelaxed,proto3" json:"preferences_relaxed,omitempty"`
+}
+
+func (x *AppliedPreferences) Reset() {
+	*x = AppliedPreferences{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_route_checker_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AppliedPreferences) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AppliedPreferences) ProtoMessage() {}
+
+func (x *AppliedPreferences) ProtoReflect() protoreflect.Message {
+	mi := &file_route_checker_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AppliedPreferences.ProtoReflect.Descriptor instead.
+func (*AppliedPreferences) Descriptor() ([]byte, []int) {
+	return file_route_checker_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *AppliedPreferences) GetAvoidedStations() []string {
+	if x != nil {
+		return x.AvoidedStations
+	}
+	return nil
+}
+
+func (x *AppliedPreferences) GetAvoidedOperators() []string {
+	if x != nil {
+		return x.AvoidedOperators
+	}
+	return nil
+}
+
+func (x *AppliedPreferences) GetPreferredOperators() []string {
+	if x != nil {
+		return x.PreferredOperators
+	}
+	return nil
+}
+
+func (x *AppliedPreferences) GetPreferredStops() []string {
+	if x != nil {
+		return x.PreferredStops
+	}
+	return nil
+}
+
+func (x *AppliedPreferences) GetMaxStops() int32 {
+	if x != nil {
+		return x.MaxStops
+	}
+	return 0
+}
+
+func (x *AppliedPreferences) GetPreferencesRelaxed() bool {
+	if x != nil {
+		return x.PreferencesRelaxed
+	}
+	return false
+}
+
+var File_route_checker_proto protoreflect.FileDescriptor
+
+var file_route_checker_proto_rawDesc = []byte{
+	0x0a, 0x13, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x5f, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x65, 0x72, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0f, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x63, 0x68, 0x65, 0x63,
+	0x6b, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x22, 0xe5, 0x01, 0x0a, 0x13, 0x43, 0x6f, 0x6d, 0x70, 0x75,
+	0x74, 0x65, 0x52, 0x6f, 0x75, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x10,
+	0x0a, 0x03, 0x76, 0x69, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x76, 0x69, 0x6e,
+	0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x74,
+	0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64,
+	0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x42, 0x0a, 0x0d, 0x73, 0x74,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x0e, 0x32, 0x1d, 0x2e, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x65, 0x72,
+	0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4f, 0x72, 0x64, 0x65, 0x72,
+	0x52, 0x0c, 0x73, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x12, 0x3e,
+	0x0a, 0x0b, 0x70, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x18, 0x05, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x63, 0x68, 0x65, 0x63, 0x6b,
+	0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65,
+	0x73, 0x52, 0x0b, 0x70, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x22, 0xa5,
+	0x01, 0x0a, 0x0b, 0x50, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x12, 0x25,
+	0x0a, 0x0e, 0x61, 0x76, 0x6f, 0x69, 0x64, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73,
+	0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0d, 0x61, 0x76, 0x6f, 0x69, 0x64, 0x53, 0x74, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x61, 0x76, 0x6f, 0x69, 0x64, 0x5f, 0x6f,
+	0x70, 0x65, 0x72, 0x61, 0x74, 0x6f, 0x72, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0e,
+	0x61, 0x76, 0x6f, 0x69, 0x64, 0x4f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x6f, 0x72, 0x73, 0x12, 0x29,
+	0x0a, 0x10, 0x70, 0x72, 0x65, 0x66, 0x65, 0x72, 0x5f, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x6f,
+	0x72, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0f, 0x70, 0x72, 0x65, 0x66, 0x65, 0x72,
+	0x4f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x6f, 0x72, 0x73, 0x12, 0x1b, 0x0a, 0x09, 0x6d, 0x61, 0x78,
+	0x5f, 0x73, 0x74, 0x6f, 0x70, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x6d, 0x61,
+	0x78, 0x53, 0x74, 0x6f, 0x70, 0x73, 0x22, 0xb1, 0x04, 0x0a, 0x14, 0x43, 0x6f, 0x6d, 0x70, 0x75,
+	0x74, 0x65, 0x52, 0x6f, 0x75, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x25, 0x0a, 0x0e, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x69,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0d, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x76, 0x69, 0x6e, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x03, 0x76, 0x69, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72,
+	0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65,
+	0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x64, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x12, 0x30,
+	0x0a, 0x14, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x5f, 0x63, 0x68, 0x61, 0x72, 0x67, 0x65,
+	0x5f, 0x6c, 0x65, 0x76, 0x65, 0x6c, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x12, 0x63, 0x75,
+	0x72, 0x72, 0x65, 0x6e, 0x74, 0x43, 0x68, 0x61, 0x72, 0x67, 0x65, 0x4c, 0x65, 0x76, 0x65, 0x6c,
+	0x12, 0x30, 0x0a, 0x14, 0x69, 0x73, 0x5f, 0x63, 0x68, 0x61, 0x72, 0x67, 0x69, 0x6e, 0x67, 0x5f,
+	0x72, 0x65, 0x71, 0x75, 0x69, 0x72, 0x65, 0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x12,
+	0x69, 0x73, 0x43, 0x68, 0x61, 0x72, 0x67, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x71, 0x75, 0x69, 0x72,
+	0x65, 0x64, 0x12, 0x2b, 0x0a, 0x11, 0x63, 0x68, 0x61, 0x72, 0x67, 0x69, 0x6e, 0x67, 0x5f, 0x73,
+	0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x09, 0x52, 0x10, 0x63,
+	0x68, 0x61, 0x72, 0x67, 0x69, 0x6e, 0x67, 0x53, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12,
+	0x2b, 0x0a, 0x05, 0x73, 0x74, 0x6f, 0x70, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x15,
+	0x2e, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x65, 0x72, 0x2e, 0x76, 0x31,
+	0x2e, 0x53, 0x74, 0x6f, 0x70, 0x52, 0x05, 0x73, 0x74, 0x6f, 0x70, 0x73, 0x12, 0x27, 0x0a, 0x0f,
+	0x64, 0x65, 0x74, 0x6f, 0x75, 0x72, 0x5f, 0x6f, 0x76, 0x65, 0x72, 0x68, 0x65, 0x61, 0x64, 0x18,
+	0x0a, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0e, 0x64, 0x65, 0x74, 0x6f, 0x75, 0x72, 0x4f, 0x76, 0x65,
+	0x72, 0x68, 0x65, 0x61, 0x64, 0x12, 0x4d, 0x0a, 0x11, 0x65, 0x78, 0x63, 0x6c, 0x75, 0x64, 0x65,
+	0x64, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x0b, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x20, 0x2e, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x65, 0x72, 0x2e,
+	0x76, 0x31, 0x2e, 0x45, 0x78, 0x63, 0x6c, 0x75, 0x64, 0x65, 0x64, 0x53, 0x74, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x52, 0x10, 0x65, 0x78, 0x63, 0x6c, 0x75, 0x64, 0x65, 0x64, 0x53, 0x74, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x73, 0x12, 0x54, 0x0a, 0x13, 0x61, 0x70, 0x70, 0x6c, 0x69, 0x65, 0x64, 0x5f,
+	0x70, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x18, 0x0c, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x23, 0x2e, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x65, 0x72,
+	0x2e, 0x76, 0x31, 0x2e, 0x41, 0x70, 0x70, 0x6c, 0x69, 0x65, 0x64, 0x50, 0x72, 0x65, 0x66, 0x65,
+	0x72, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x52, 0x12, 0x61, 0x70, 0x70, 0x6c, 0x69, 0x65, 0x64, 0x50,
+	0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x22, 0xac, 0x01, 0x0a, 0x04, 0x53,
+	0x74, 0x6f, 0x70, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x69, 0x73, 0x74, 0x61,
+	0x6e, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x64, 0x69, 0x73, 0x74, 0x61,
+	0x6e, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x64, 0x65, 0x74, 0x6f, 0x75, 0x72, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x06, 0x64, 0x65, 0x74, 0x6f, 0x75, 0x72, 0x12, 0x27, 0x0a, 0x0f, 0x64,
+	0x65, 0x74, 0x6f, 0x75, 0x72, 0x5f, 0x6f, 0x76, 0x65, 0x72, 0x68, 0x65, 0x61, 0x64, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x0e, 0x64, 0x65, 0x74, 0x6f, 0x75, 0x72, 0x4f, 0x76, 0x65, 0x72,
+	0x68, 0x65, 0x61, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x68, 0x61, 0x72, 0x67, 0x65, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x63, 0x68, 0x61, 0x72, 0x67, 0x65, 0x12, 0x1b, 0x0a, 0x09,
+	0x6d, 0x61, 0x78, 0x5f, 0x70, 0x6f, 0x77, 0x65, 0x72, 0x18, 0x06, 0x20, 0x01, 0x28, 0x01, 0x52,
+	0x08, 0x6d, 0x61, 0x78, 0x50, 0x6f, 0x77, 0x65, 0x72, 0x22, 0x3d, 0x0a, 0x0f, 0x45, 0x78, 0x63,
+	0x6c, 0x75, 0x64, 0x65, 0x64, 0x53, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04,
+	0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65,
+	0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x22, 0x94, 0x02, 0x0a, 0x12, 0x41, 0x70, 0x70,
+	0x6c, 0x69, 0x65, 0x64, 0x50, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x12,
+	0x29, 0x0a, 0x10, 0x61, 0x76, 0x6f, 0x69, 0x64, 0x65, 0x64, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0f, 0x61, 0x76, 0x6f, 0x69, 0x64,
+	0x65, 0x64, 0x53, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x2b, 0x0a, 0x11, 0x61, 0x76,
+	0x6f, 0x69, 0x64, 0x65, 0x64, 0x5f, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x6f, 0x72, 0x73, 0x18,
+	0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x10, 0x61, 0x76, 0x6f, 0x69, 0x64, 0x65, 0x64, 0x4f, 0x70,
+	0x65, 0x72, 0x61, 0x74, 0x6f, 0x72, 0x73, 0x12, 0x2f, 0x0a, 0x13, 0x70, 0x72, 0x65, 0x66, 0x65,
+	0x72, 0x72, 0x65, 0x64, 0x5f, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x6f, 0x72, 0x73, 0x18, 0x03,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x12, 0x70, 0x72, 0x65, 0x66, 0x65, 0x72, 0x72, 0x65, 0x64, 0x4f,
+	0x70, 0x65, 0x72, 0x61, 0x74, 0x6f, 0x72, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x70, 0x72, 0x65, 0x66,
+	0x65, 0x72, 0x72, 0x65, 0x64, 0x5f, 0x73, 0x74, 0x6f, 0x70, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28,
+	0x09, 0x52, 0x0e, 0x70, 0x72, 0x65, 0x66, 0x65, 0x72, 0x72, 0x65, 0x64, 0x53, 0x74, 0x6f, 0x70,
+	0x73, 0x12, 0x1b, 0x0a, 0x09, 0x6d, 0x61, 0x78, 0x5f, 0x73, 0x74, 0x6f, 0x70, 0x73, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x6d, 0x61, 0x78, 0x53, 0x74, 0x6f, 0x70, 0x73, 0x12, 0x2f,
+	0x0a, 0x13, 0x70, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x5f, 0x72, 0x65,
+	0x6c, 0x61, 0x78, 0x65, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x12, 0x70, 0x72, 0x65,
+	0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x52, 0x65, 0x6c, 0x61, 0x78, 0x65, 0x64, 0x2a,
+	0x60, 0x0a, 0x0c, 0x53, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x12,
+	0x1d, 0x0a, 0x19, 0x53, 0x54, 0x41, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x4f, 0x52, 0x44, 0x45, 0x52,
+	0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44, 0x10, 0x00, 0x12, 0x16,
+	0x0a, 0x12, 0x53, 0x54, 0x41, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x4f, 0x52, 0x44, 0x45, 0x52, 0x5f,
+	0x4e, 0x41, 0x4d, 0x45, 0x10, 0x01, 0x12, 0x19, 0x0a, 0x15, 0x53, 0x54, 0x41, 0x54, 0x49, 0x4f,
+	0x4e, 0x5f, 0x4f, 0x52, 0x44, 0x45, 0x52, 0x5f, 0x44, 0x52, 0x49, 0x56, 0x49, 0x4e, 0x47, 0x10,
+	0x02, 0x32, 0x6b, 0x0a, 0x0c, 0x52, 0x6f, 0x75, 0x74, 0x65, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x65,
+	0x72, 0x12, 0x5b, 0x0a, 0x0c, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x52, 0x6f, 0x75, 0x74,
+	0x65, 0x12, 0x24, 0x2e, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x65, 0x72,
+	0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x52, 0x6f, 0x75, 0x74, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x25, 0x2e, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x63,
+	0x68, 0x65, 0x63, 0x6b, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74,
+	0x65, 0x52, 0x6f, 0x75, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x29,
+	0x5a, 0x27, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x53, 0x44, 0x4a,
+	0x4c, 0x65, 0x65, 0x2f, 0x6d, 0x65, 0x72, 0x63, 0x65, 0x64, 0x65, 0x73, 0x2d, 0x62, 0x65, 0x6e,
+	0x7a, 0x2f, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x33,
+}
+
+var (
+	file_route_checker_proto_rawDescOnce sync.Once
+	file_route_checker_proto_rawDescData = file_route_checker_proto_rawDesc
+)
+
+func file_route_checker_proto_rawDescGZIP() []byte {
+	file_route_checker_proto_rawDescOnce.Do(func() {
+		file_route_checker_proto_rawDescData = protoimpl.X.CompressGZIP(file_route_checker_proto_rawDescData)
+	})
+	return file_route_checker_proto_rawDescData
+}
+
+var file_route_checker_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_route_checker_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_route_checker_proto_goTypes = []interface{}{
+	(StationOrder)(0),            // 0: routechecker.v1.StationOrder
+	(*ComputeRouteRequest)(nil),  // 1: routechecker.v1.ComputeRouteRequest
+	(*Preferences)(nil),          // 2: routechecker.v1.Preferences
+	(*ComputeRouteResponse)(nil), // 3: routechecker.v1.ComputeRouteResponse
+	(*Stop)(nil),                 // 4: routechecker.v1.Stop
+	(*ExcludedStation)(nil),      // 5: routechecker.v1.ExcludedStation
+	(*AppliedPreferences)(nil),   // 6: routechecker.v1.AppliedPreferences
+}
+var file_route_checker_proto_depIdxs = []int32{
+	0, // 0: routechecker.v1.ComputeRouteRequest.station_order:type_name -> routechecker.v1.StationOrder
+	2, // 1: routechecker.v1.ComputeRouteRequest.preferences:type_name -> routechecker.v1.Preferences
+	4, // 2: routechecker.v1.ComputeRouteResponse.stops:type_name -> routechecker.v1.Stop
+	5, // 3: routechecker.v1.ComputeRouteResponse.excluded_stations:type_name -> routechecker.v1.ExcludedStation
+	6, // 4: routechecker.v1.ComputeRouteResponse.applied_preferences:type_name -> routechecker.v1.AppliedPreferences
+	1, // 5: routechecker.v1.RouteChecker.ComputeRoute:input_type -> routechecker.v1.ComputeRouteRequest
+	3, // 6: routechecker.v1.RouteChecker.ComputeRoute:output_type -> routechecker.v1.ComputeRouteResponse
+	6, // [6:7] is the sub-list for method output_type
+	5, // [5:6] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_route_checker_proto_init() }
+func file_route_checker_proto_init() {
+	if File_route_checker_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_route_checker_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ComputeRouteRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_route_checker_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Preferences); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_route_checker_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ComputeRouteResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_route_checker_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Stop); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_route_checker_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ExcludedStation); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_route_checker_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AppliedPreferences); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_route_checker_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_route_checker_proto_goTypes,
+		DependencyIndexes: file_route_checker_proto_depIdxs,
+		EnumInfos:         file_route_checker_proto_enumTypes,
+		MessageInfos:      file_route_checker_proto_msgTypes,
+	}.Build()
+	File_route_checker_proto = out.File
+	file_route_checker_proto_rawDesc = nil
+	file_route_checker_proto_goTypes = nil
+	file_route_checker_proto_depIdxs = nil
+}
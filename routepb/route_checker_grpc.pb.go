@@ -0,0 +1,103 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package routepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// RouteCheckerClient is the client API for RouteChecker service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RouteCheckerClient interface {
+	// ComputeRoute plans the route with the minimum number of charging stops. The deadline of the call bounds the upstream calls.
+	ComputeRoute(ctx context.Context, in *ComputeRouteRequest, opts ...grpc.CallOption) (*ComputeRouteResponse, error)
+}
+
+type routeCheckerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRouteCheckerClient(cc grpc.ClientConnInterface) RouteCheckerClient {
+	return &routeCheckerClient{cc}
+}
+
+func (c *routeCheckerClient) ComputeRoute(ctx context.Context, in *ComputeRouteRequest, opts ...grpc.CallOption) (*ComputeRouteResponse, error) {
+	out := new(ComputeRouteResponse)
+	err := c.cc.Invoke(ctx, "/routechecker.v1.RouteChecker/ComputeRoute", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RouteCheckerServer is the server API for RouteChecker service.
+// All implementations must embed UnimplementedRouteCheckerServer
+// for forward compatibility
+type RouteCheckerServer interface {
+	// ComputeRoute plans the route with the minimum number of charging stops. The deadline of the call bounds the upstream calls.
+	ComputeRoute(context.Context, *ComputeRouteRequest) (*ComputeRouteResponse, error)
+	mustEmbedUnimplementedRouteCheckerServer()
+}
+
+// UnimplementedRouteCheckerServer must be embedded to have forward compatible implementations.
+type UnimplementedRouteCheckerServer struct {
+}
+
+func (UnimplementedRouteCheckerServer) ComputeRoute(context.Context, *ComputeRouteRequest) (*ComputeRouteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ComputeRoute not implemented")
+}
+func (UnimplementedRouteCheckerServer) mustEmbedUnimplementedRouteCheckerServer() {}
+
+// UnsafeRouteCheckerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RouteCheckerServer will
+// result in compilation errors.
+type UnsafeRouteCheckerServer interface {
+	mustEmbedUnimplementedRouteCheckerServer()
+}
+
+func RegisterRouteCheckerServer(s grpc.ServiceRegistrar, srv RouteCheckerServer) {
+	s.RegisterService(&RouteChecker_ServiceDesc, srv)
+}
+
+func _RouteChecker_ComputeRoute_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ComputeRouteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RouteCheckerServer).ComputeRoute(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/routechecker.v1.RouteChecker/ComputeRoute",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RouteCheckerServer).ComputeRoute(ctx, req.(*ComputeRouteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RouteChecker_ServiceDesc is the grpc.ServiceDesc for RouteChecker service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RouteChecker_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "routechecker.v1.RouteChecker",
+	HandlerType: (*RouteCheckerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ComputeRoute",
+			Handler:    _RouteChecker_ComputeRoute_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "route_checker.proto",
+}
@@ -0,0 +1,67 @@
+package tenant
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+)
+
+// validID are the IDs that can be used in metric names and cache keys as they are.
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Tenant is a brand served by the deployment in the tenants file. The upstream API is called at ApiAddress with ApiKey, if any, in the
+// X-API-Key header. VehicleProfiles and RateLimits are in the format of VEHICLE_PROFILES and RATE_LIMITS, and the global settings are
+// used when they are not set. Clients are the IDs of the authenticated clients that belong to the tenant. The metrics of the tenant are
+// prefixed with MetricPrefix, which is tenants.<id> when it is not set.
+type Tenant struct {
+	ID              string   `json:"id"`
+	ApiAddress      string   `json:"apiAddress"`
+	ApiKey          string   `json:"apiKey,omitempty"`
+	VehicleProfiles string   `json:"vehicleProfiles,omitempty"`
+	RateLimits      string   `json:"rateLimits,omitempty"`
+	Clients         []string `json:"clients,omitempty"`
+	MetricPrefix    string   `json:"metricPrefix,omitempty"`
+}
+
+// Load reads the tenants from the JSON file at the path, which has an array of Tenant.
+func Load(path string) ([]*Tenant, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants []*Tenant
+	if err := json.Unmarshal(content, &tenants); err != nil {
+		return nil, fmt.Errorf("invalid tenants file: %v", err)
+	}
+	return tenants, Validate(tenants)
+}
+
+// Validate checks that each tenant has a unique ID of letters, digits, underscores and hyphens and an API address, and that a client
+// belongs to one tenant at most. The metric prefix is defaulted.
+func Validate(tenants []*Tenant) error {
+	ids := make(map[string]bool, len(tenants))
+	clients := make(map[string]string)
+	for i, tenant := range tenants {
+		if !validID.MatchString(tenant.ID) {
+			return fmt.Errorf("tenant %v has an invalid id %q. expected letters, digits, underscores and hyphens", i, tenant.ID)
+		}
+		if ids[tenant.ID] {
+			return fmt.Errorf("tenant %v is a duplicate", tenant.ID)
+		}
+		ids[tenant.ID] = true
+		if tenant.ApiAddress == "" {
+			return fmt.Errorf("tenant %v has no api address", tenant.ID)
+		}
+		for _, client := range tenant.Clients {
+			if other, ok := clients[client]; ok {
+				return fmt.Errorf("client %v belongs to tenants %v and %v", client, other, tenant.ID)
+			}
+			clients[client] = tenant.ID
+		}
+		if tenant.MetricPrefix == "" {
+			tenant.MetricPrefix = "tenants." + tenant.ID
+		}
+	}
+	return nil
+}
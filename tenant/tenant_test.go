@@ -0,0 +1,35 @@
+package tenant
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		tenants []*Tenant
+		err     string
+	}{
+		{"valid", []*Tenant{{ID: "brand-a", ApiAddress: "http://a", Clients: []string{"fleet"}}, {ID: "brand_b", ApiAddress: "http://b"}}, ""},
+		{"invalid id", []*Tenant{{ID: "brand.a", ApiAddress: "http://a"}}, "invalid id"},
+		{"duplicate", []*Tenant{{ID: "brand-a", ApiAddress: "http://a"}, {ID: "brand-a", ApiAddress: "http://b"}}, "duplicate"},
+		{"no api address", []*Tenant{{ID: "brand-a"}}, "no api address"},
+		{"shared client", []*Tenant{{ID: "brand-a", ApiAddress: "http://a", Clients: []string{"fleet"}},
+			{ID: "brand-b", ApiAddress: "http://b", Clients: []string{"fleet"}}}, "belongs to tenants brand-a and brand-b"},
+	}
+	for _, testCase := range testCases {
+		err := Validate(testCase.tenants)
+		if testCase.err == "" && err != nil || testCase.err != "" && (err == nil || !strings.Contains(err.Error(), testCase.err)) {
+			t.Errorf("%v: expected error %q but got %v", testCase.name, testCase.err, err)
+		}
+	}
+
+	tenants := []*Tenant{{ID: "brand-a", ApiAddress: "http://a"}, {ID: "brand-b", ApiAddress: "http://b", MetricPrefix: "b"}}
+	if err := Validate(tenants); err != nil {
+		t.Fatal(err)
+	}
+	if tenants[0].MetricPrefix != "tenants.brand-a" || tenants[1].MetricPrefix != "b" {
+		t.Errorf("expected the metric prefix to be defaulted but got %v and %v", tenants[0].MetricPrefix, tenants[1].MetricPrefix)
+	}
+}
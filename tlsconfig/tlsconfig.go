@@ -0,0 +1,259 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/SDJLee/mercedes-benz/logger"
+)
+
+var tlsLogger = log.SubLogger("tls")
+
+const (
+	PolicyModern       = "modern"
+	PolicyIntermediate = "intermediate"
+	ClientAuthRequire  = "require"
+	ClientAuthOptional = "optional"
+)
+
+// modernSuites are the TLS 1.2 suites with forward secrecy and authenticated encryption. The TLS 1.3 suites are not configurable.
+var modernSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+}
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Options configures the TLS of the server. MinVersion is one of 1.0 to 1.3, 1.2 by default. CipherPolicy is modern by default,
+// intermediate for all the suites Go considers secure, or a comma-separated list of suite names. The client certificates are verified
+// against the CA bundle in ClientCAFile when set, and ClientAuth tells whether they are required, the default, or optional.
+type Options struct {
+	CertFile     string
+	KeyFile      string
+	MinVersion   string
+	CipherPolicy string
+	ClientCAFile string
+	ClientAuth   string
+}
+
+// Reloader serves the certificate and the client CA bundle of the files, and reloads them when the files change, so that renewed
+// certificates are served without a restart.
+type Reloader struct {
+	options      Options
+	minVersion   uint16
+	cipherSuites []uint16
+	clientAuth   tls.ClientAuthType
+	mu           sync.RWMutex
+	certificate  *tls.Certificate
+	clientCAs    *x509.CertPool
+	modified     map[string]time.Time
+}
+
+// New loads the certificate and the client CA bundle. It fails on invalid options or files, so that the server doesn't start without
+// the intended TLS.
+func New(options Options) (*Reloader, error) {
+	if options.CertFile == "" || options.KeyFile == "" {
+		return nil, errors.New("both the certificate and the key files are required")
+	}
+	r := &Reloader{options: options, modified: make(map[string]time.Time)}
+	var err error
+	if r.minVersion, err = minVersion(options.MinVersion); err != nil {
+		return nil, err
+	}
+	if r.cipherSuites, err = cipherSuites(options.CipherPolicy); err != nil {
+		return nil, err
+	}
+	if r.clientAuth, err = clientAuth(options); err != nil {
+		return nil, err
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func minVersion(version string) (uint16, error) {
+	if version == "" {
+		return tls.VersionTLS12, nil
+	}
+	if v, ok := versions[version]; ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q. expected one of 1.0, 1.1, 1.2 and 1.3", version)
+}
+
+func cipherSuites(policy string) ([]uint16, error) {
+	switch policy {
+	case "", PolicyModern:
+		return modernSuites, nil
+	case PolicyIntermediate:
+		var suites []uint16
+		for _, suite := range tls.CipherSuites() {
+			suites = append(suites, suite.ID)
+		}
+		return suites, nil
+	}
+	byName := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		byName[suite.Name] = suite.ID
+	}
+	var suites []uint16
+	for _, name := range strings.Split(policy, ",") {
+		id, ok := byName[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", strings.TrimSpace(name))
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+func clientAuth(options Options) (tls.ClientAuthType, error) {
+	if options.ClientCAFile == "" {
+		if options.ClientAuth != "" {
+			return tls.NoClientCert, errors.New("client authentication needs the client CA bundle")
+		}
+		return tls.NoClientCert, nil
+	}
+	switch options.ClientAuth {
+	case "", ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client authentication %q. expected %v or %v", options.ClientAuth, ClientAuthRequire,
+		ClientAuthOptional)
+}
+
+// Reload reads the certificate and the client CA bundle again. The files in use are kept when the new ones are invalid.
+func (r *Reloader) Reload() error {
+	certificate, err := tls.LoadX509KeyPair(r.options.CertFile, r.options.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the certificate: %w", err)
+	}
+	var pool *x509.CertPool
+	if r.options.ClientCAFile != "" {
+		bundle, err := ioutil.ReadFile(r.options.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to load the client CA bundle: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return errors.New("the client CA bundle has no certificate")
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certificate, r.clientCAs = &certificate, pool
+	r.modified = r.modTimes()
+	return nil
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.options.CertFile, r.options.KeyFile}
+	if r.options.ClientCAFile != "" {
+		files = append(files, r.options.ClientCAFile)
+	}
+	return files
+}
+
+func (r *Reloader) modTimes() map[string]time.Time {
+	modified := make(map[string]time.Time)
+	for _, file := range r.files() {
+		if info, err := os.Stat(file); err == nil {
+			modified[file] = info.ModTime()
+		}
+	}
+	return modified
+}
+
+// changed reports whether a file was modified since it was loaded.
+func (r *Reloader) changed() bool {
+	current := r.modTimes()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for file, modified := range current {
+		if !modified.Equal(r.modified[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads the files when they change, checking every interval until ctx is done. Files are checked by their modification time,
+// which also catches the files replaced through a symlink, as mounted secrets are.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !r.changed() {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			tlsLogger.Error("failed to reload TLS files. the previous ones are still served", err)
+			continue
+		}
+		tlsLogger.Info("reloaded TLS files")
+	}
+}
+
+// Config returns the TLS config serving the current certificate and verifying the clients against the current CA bundle. nextProtos
+// are the protocols negotiated with ALPN, such as h2 for gRPC.
+func (r *Reloader) Config(nextProtos ...string) *tls.Config {
+	config := r.base(nextProtos)
+	if r.clientAuth != tls.NoClientCert {
+		// the CA bundle can't be swapped in a config in use, so each handshake gets a config with the current one
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			forClient := r.base(nextProtos)
+			r.mu.RLock()
+			forClient.ClientCAs = r.clientCAs
+			r.mu.RUnlock()
+			return forClient, nil
+		}
+	}
+	return config
+}
+
+func (r *Reloader) base(nextProtos []string) *tls.Config {
+	return &tls.Config{
+		MinVersion:   r.minVersion,
+		CipherSuites: r.cipherSuites,
+		ClientAuth:   r.clientAuth,
+		NextProtos:   nextProtos,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.certificate, nil
+		},
+	}
+}
+
+// ClientSubject returns the subject of the client certificate verified in the handshake, or an empty string when the client sent none.
+func ClientSubject(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.String()
+}
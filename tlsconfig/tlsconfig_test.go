@@ -0,0 +1,128 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate with the common name and its key to the files.
+func writeCert(t *testing.T, certFile string, keyFile string, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	if v, err := minVersion(""); err != nil || v != tls.VersionTLS12 {
+		t.Errorf("expected TLS 1.2 by default but got %v %v", v, err)
+	}
+	if _, err := minVersion("1.4"); err == nil {
+		t.Error("expected the unknown version to be rejected")
+	}
+	if suites, err := cipherSuites(""); err != nil || len(suites) != len(modernSuites) {
+		t.Errorf("expected the modern suites by default but got %v %v", suites, err)
+	}
+	if suites, err := cipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"); err != nil || len(suites) != 2 {
+		t.Errorf("expected the listed suites but got %v %v", suites, err)
+	}
+	if _, err := cipherSuites("TLS_RSA_WITH_RC4_128_SHA"); err == nil {
+		t.Error("expected the insecure suite to be rejected")
+	}
+
+	testCases := []struct {
+		options  Options
+		expected tls.ClientAuthType
+		valid    bool
+	}{
+		{Options{}, tls.NoClientCert, true},
+		{Options{ClientAuth: ClientAuthRequire}, tls.NoClientCert, false},
+		{Options{ClientCAFile: "ca.pem"}, tls.RequireAndVerifyClientCert, true},
+		{Options{ClientCAFile: "ca.pem", ClientAuth: ClientAuthOptional}, tls.VerifyClientCertIfGiven, true},
+		{Options{ClientCAFile: "ca.pem", ClientAuth: "sometimes"}, tls.NoClientCert, false},
+	}
+	for _, testCase := range testCases {
+		actual, err := clientAuth(testCase.options)
+		if (err == nil) != testCase.valid || actual != testCase.expected {
+			t.Errorf("%+v: expected %v but got %v %v", testCase.options, testCase.expected, actual, err)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "first")
+	r, err := New(Options{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := func() string {
+		certificate, err := r.Config().GetCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+	if r.changed() || served() != "first" {
+		t.Fatalf("expected the loaded certificate to be served unchanged but got %v", served())
+	}
+
+	// the renewed certificate is detected by its modification time and served
+	writeCert(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if !r.changed() {
+		t.Fatal("expected the renewed certificate to be detected")
+	}
+	if err := r.Reload(); err != nil || served() != "second" {
+		t.Fatalf("expected the renewed certificate to be served but got %v %v", served(), err)
+	}
+
+	// an invalid file keeps the certificate in use
+	if err := ioutil.WriteFile(certFile, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil || served() != "second" {
+		t.Errorf("expected the invalid certificate to be rejected and the previous one served but got %v %v", served(), err)
+	}
+}
@@ -0,0 +1,16 @@
+package util
+
+// ConfigKeys are the settings read from the config file and the environment, as reported by the effective configuration of the admin
+// API. A new setting should be added here.
+var ConfigKeys = []string{
+	AppEnv, BasePath, ApiAddress, LogPath, Port, ServerReadTimeout, ServerWriteTimeout, ShutdownDelay, ShutdownTimeout, ShipLogs,
+	GraphiteUrl, LogstashUrl, VehicleProfiles, AverageSpeed, PreferredOpWeight, ReserveCharge, BatchConcurrency, BatchMaxSize, JobsPath,
+	JobsWorkers, JobsQueueSize, JobsRetention, JobsCallbackHosts, JobsCallbackTries, RequestTimeout, IdGeneratorKind, NodeId,
+	IdempotencyTTL, HistoryPath, HistoryRetention, GrpcPort, AuthApiKeysPath, AuthJwksPath, AuthJwtAlgorithm, AuthJwtIssuer,
+	AuthJwtAudience, AuthClientCerts, RateLimits, RateLimitBackend, RateLimitRedisUrl, ConcurrencyLimit, ConcurrencyMin, ConcurrencyMax,
+	ConcurrencyQueue, ConcurrencyWait, ConcurrencyLatency, BreakerFailures, BreakerOpenMs, ReadinessCacheMs, ReadinessTimeoutMs,
+	TlsCertPath, TlsKeyPath, TlsMinVersion, TlsCipherPolicy, TlsClientCaPath, TlsClientAuth, TlsReloadSeconds, AdminPort,
+	AdminBindAddress, AdminApiKeysPath, TenantsPath, WebhooksPath, WebhookAttempts, WebhookBackoffMs, WebhookTimeoutMs, WebhookDeadLetter,
+	TrustedProxies, MaxBodyBytes, SwaggerUIPath, WebhookWorkers, WebhookQueueSize, WebhookStatePath, ChargingPower,
+	MilesPerKwh,
+}
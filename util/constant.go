@@ -13,13 +13,213 @@ const (
 	Port               = "PORT"
 	ServerReadTimeout  = "SERVER_READ_TIMEOUT"
 	ServerWriteTimeout = "SERVER_WRITE_TIMEOUT"
+	ShutdownDelay      = "SHUTDOWN_DELAY"
+	ShutdownTimeout    = "SHUTDOWN_TIMEOUT"
+	DefaultShutDelay   = 5
+	DefaultShutTimeout = 30
 	ApiHealthCheck     = "health"
 	ApiComputeRoute    = "/compute-route"
+	ApiOpenAPI         = "openapi.json"
+	ApiDocs            = "docs"
+	ApiComputeBatch    = "/compute-route/batch"
+	ApiComputeStream   = "/compute-route/stream"
+	ApiBatchStream     = "/compute-route/batch/stream"
+	ApiJobs            = "/jobs"
+	ApiJob             = "/jobs/:id"
 	ApiBasePath        = "/api"
 	ApiV1              = "/v1"
+	ApiV2              = "/v2"
 	ErrUnreachableId   = 8888
 	ErrUnreachableMsg  = "Unable to reach the destination with the current charge level"
 	ErrTechExpId       = 9999
 	ErrTechExpMsg      = "Technical Exception"
+	ErrMaxStopsMsg     = "Unable to reach the destination within the maximum stops"
 	ShipLogs           = "SHIPLOGS"
+	VehicleProfiles    = "VEHICLE_PROFILES"
+	AverageSpeed       = "AVERAGE_SPEED"
+	DefaultAvgSpeed    = 50
+	ChargingPower      = "CHARGING_POWER"
+	DefaultChargePower = 50
+	MilesPerKwh        = "MILES_PER_KWH"
+	DefaultMilesPerKwh = 3
+	ExclUnavailable    = "station is unavailable"
+	ExclClosed         = "station is closed at estimated arrival"
+	ExclIncompatible   = "no compatible connector"
+	ExclAvoided        = "avoided by driver preference"
+	PreferredOpWeight  = "PREFERRED_OPERATOR_WEIGHT"
+	DefaultPrefWeight  = 10
+	ReserveCharge      = "RESERVE_CHARGE"
+	OrderByName        = "name"
+	OrderByDriving     = "driving"
+	BatchConcurrency   = "BATCH_CONCURRENCY"
+	BatchMaxSize       = "BATCH_MAX_SIZE"
+	DefaultBatchConc   = 8
+	DefaultBatchSize   = 500
+	JobsPath           = "JOBS_PATH"
+	JobsWorkers        = "JOBS_WORKERS"
+	JobsQueueSize      = "JOBS_QUEUE_SIZE"
+	DefaultJobsDir     = "merc-benz-route-checker-jobs"
+	DefaultJobsWorkers = 4
+	DefaultJobsQueue   = 100
+	JobsRetention      = "JOBS_RETENTION_DAYS"
+	DefaultJobsRetain  = 7
+	JobsCallbackHosts  = "JOBS_CALLBACK_HOSTS"
+	JobsCallbackTries  = "JOBS_CALLBACK_ATTEMPTS"
+	DefaultCbTries     = 3
+	PhaseChargeLevel   = "chargeLevel"
+	PhaseDistance      = "distance"
+	PhaseStations      = "stations"
+	PhasePlan          = "plan"
+	PhaseResponse      = "response"
+	PhaseSummary       = "summary"
+	RequestTimeout     = "REQUEST_TIMEOUT"
+	DefaultReqTimeout  = 10
+	EndpointCharge     = "charge-level"
+	EndpointDistance   = "distance"
+	EndpointStations   = "charging-stations"
+	ErrCodeInvalidReq  = "invalid-request"
+	ErrCodeInvalidVin  = "invalid-vin"
+	ErrCodeUnknownLoc  = "unknown-location"
+	ErrCodeUpstream    = "upstream-%s-failure"
+	ErrCodeTimeout     = "upstream-timeout"
+	ErrCodeUnreachable = "unreachable"
+	ErrCodeMaxStops    = "too-many-stops"
+	ErrCodeInternal    = "internal-error"
+	ProblemTypeFormat  = "/api/problems/%s"
+	ProblemContentType = "application/problem+json"
+	IdGeneratorKind    = "ID_GENERATOR"
+	IdGenSnowflake     = "snowflake"
+	IdGenCounter       = "counter"
+	NodeId             = "NODE_ID"
+	TransactionHeader  = "X-Transaction-Id"
+	TransactionIdKey   = "transactionId"
+	IdempotencyHeader  = "Idempotency-Key"
+	IdempotentReplayed = "Idempotent-Replayed"
+	IdempotencyTTL     = "IDEMPOTENCY_TTL"
+	DefaultIdemTTL     = 86400
+	ErrCodeIdempotency = "idempotency-conflict"
+	TechFailureKey     = "technicalFailure"
+	ErrCodeTooLarge    = "payload-too-large"
+	MaxBodyBytes       = "MAX_BODY_BYTES"
+	DefaultMaxBody     = 10 << 20
+	ApiPlans           = "/plans"
+	ApiPlan            = "/plans/:id"
+	HistoryPath        = "HISTORY_PATH"
+	HistoryRetention   = "HISTORY_RETENTION_DAYS"
+	DefaultHistoryFile = "merc-benz-route-checker-history.db"
+	DefaultRetention   = 30
+	MaxHistoryLimit    = 500
+	ApiPlanReplay      = "/plans/:id/replay"
+	AlgorithmLegacy    = "1"
+	AlgorithmLatest    = "2"
+	GrpcPort           = "GRPC_PORT"
+	DefaultGrpcPort    = 9090
+	GrpcErrorDomain    = "route-checker"
+	GrpcTransactionKey = "x-transaction-id"
+	AuthApiKeysPath    = "AUTH_API_KEYS_PATH"
+	AuthJwksPath       = "AUTH_JWKS_PATH"
+	AuthJwtAlgorithm   = "AUTH_JWT_ALGORITHM"
+	AuthJwtIssuer      = "AUTH_JWT_ISSUER"
+	AuthJwtAudience    = "AUTH_JWT_AUDIENCE"
+	DefaultJwtAlg      = "RS256"
+	ApiKeyHeader       = "X-API-Key"
+	GrpcApiKeyKey      = "x-api-key"
+	ClientIdKey        = "clientId"
+	ScopeComputeRoute  = "compute-route"
+	ScopeBatch         = "batch"
+	ScopeAdmin         = "admin"
+	ErrCodeUnauthed    = "unauthorized"
+	ErrCodeForbidden   = "forbidden"
+	RateLimits         = "RATE_LIMITS"
+	RateLimitBackend   = "RATE_LIMIT_BACKEND"
+	RateLimitRedisUrl  = "RATE_LIMIT_REDIS_URL"
+	RateLimitMemory    = "memory"
+	RateLimitRedis     = "redis"
+	RateLimitPrefix    = "route-checker:ratelimit:"
+	LimitByClient      = "client"
+	LimitByVin         = "vin"
+	LimitByIp          = "ip"
+	TrustedProxies     = "TRUSTED_PROXIES"
+	RouteComputeRoute  = "compute-route"
+	RouteBatch         = "batch"
+	RouteStream        = "stream"
+	RouteJobs          = "jobs"
+	RoutePlans         = "plans"
+	ErrCodeRateLimited = "rate-limited"
+	ConcurrencyLimit   = "CONCURRENCY_LIMIT"
+	ConcurrencyMin     = "CONCURRENCY_MIN_LIMIT"
+	ConcurrencyMax     = "CONCURRENCY_MAX_LIMIT"
+	ConcurrencyQueue   = "CONCURRENCY_QUEUE_SIZE"
+	ConcurrencyWait    = "CONCURRENCY_QUEUE_TIMEOUT_MS"
+	ConcurrencyLatency = "CONCURRENCY_LATENCY_MS"
+	DefaultConcLimit   = 20
+	DefaultConcMin     = 4
+	DefaultConcMax     = 200
+	DefaultConcQueue   = 50
+	DefaultConcWait    = 1000
+	DefaultConcLatency = 5000
+	ErrCodeOverloaded  = "overloaded"
+	ApiHealthLive      = "health/live"
+	ApiHealthReady     = "health/ready"
+	BreakerFailures    = "BREAKER_FAILURES"
+	BreakerOpenMs      = "BREAKER_OPEN_MS"
+	DefaultBrkFailures = 5
+	DefaultBrkOpenMs   = 30000
+	ReadinessCacheMs   = "READINESS_CACHE_MS"
+	ReadinessTimeoutMs = "READINESS_TIMEOUT_MS"
+	DefaultReadyCache  = 5000
+	DefaultReadyWait   = 2000
+	GraphiteUrl        = "GRAPHITE_URL"
+	LogstashUrl        = "LOGSTASH_URL"
+	TlsCertPath        = "TLS_CERT_PATH"
+	TlsKeyPath         = "TLS_KEY_PATH"
+	TlsMinVersion      = "TLS_MIN_VERSION"
+	TlsCipherPolicy    = "TLS_CIPHER_POLICY"
+	TlsClientCaPath    = "TLS_CLIENT_CA_PATH"
+	TlsClientAuth      = "TLS_CLIENT_AUTH"
+	TlsReloadSeconds   = "TLS_RELOAD_SECONDS"
+	DefaultTlsReload   = 10
+	AuthClientCerts    = "AUTH_CLIENT_CERTS_PATH"
+	ClientCertKey      = "clientCert"
+	AdminPort          = "ADMIN_PORT"
+	AdminBindAddress   = "ADMIN_BIND_ADDRESS"
+	AdminApiKeysPath   = "ADMIN_API_KEYS_PATH"
+	DefaultAdminPort   = 9091
+	DefaultAdminBind   = "127.0.0.1"
+	AdminPprof         = "/debug/pprof/*name"
+	AdminLogLevel      = "/admin/log-level"
+	AdminCache         = "/admin/caches/:name"
+	AdminBreakers      = "/admin/breakers"
+	AdminBreakerReset  = "/admin/breakers/reset"
+	AdminConfig        = "/admin/config"
+	AdminBuild         = "/admin/build"
+	Redacted           = "[redacted]"
+	TenantsPath        = "TENANTS_PATH"
+	TenantHeader       = "X-Tenant-Id"
+	GrpcTenantKey      = "x-tenant-id"
+	TenantKey          = "tenant"
+	WebhooksPath       = "WEBHOOKS_PATH"
+	WebhookAttempts    = "WEBHOOK_MAX_ATTEMPTS"
+	WebhookBackoffMs   = "WEBHOOK_BACKOFF_MS"
+	WebhookTimeoutMs   = "WEBHOOK_TIMEOUT_MS"
+	WebhookDeadLetter  = "WEBHOOK_DEAD_LETTER_PATH"
+	DefaultHookTries   = 5
+	DefaultHookBackoff = 1000
+	DefaultHookTimeout = 10000
+	WebhookWorkers     = "WEBHOOK_WORKERS"
+	WebhookQueueSize   = "WEBHOOK_QUEUE_SIZE"
+	WebhookStatePath   = "WEBHOOK_STATE_PATH"
+	DefaultHookWorkers = 4
+	DefaultHookQueue   = 1000
+	DefaultHookState   = "merc-benz-route-checker-webhooks"
+	DefaultDeadLetter  = "merc-benz-route-checker-webhooks.dead.jsonl"
+	EventUnreachable   = "plan.unreachable"
+	EventTooManyStops  = "plan.too-many-stops"
+	WebhookEventHeader = "X-Webhook-Event"
+	WebhookIdHeader    = "X-Webhook-Delivery"
+	SignatureHeader    = "X-Webhook-Signature"
+	AdminWebhooks      = "/admin/webhooks/deliveries"
+	ApiDocsAssets      = "docs/assets/:file"
+	SwaggerUIPath      = "SWAGGER_UI_PATH"
+	DefaultSwaggerUI   = "swagger-ui"
 )
@@ -0,0 +1,88 @@
+package util
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IdGenerator generates the transaction IDs.
+type IdGenerator interface {
+	NextId() int64
+}
+
+const (
+	// snowflakeEpoch is the start of the Snowflake timestamps, 2021-01-01T00:00:00Z, in milliseconds
+	snowflakeEpoch    = 1609459200000
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeSeqMask  = 1<<snowflakeSeqBits - 1
+	MaxNodeId         = 1<<snowflakeNodeBits - 1
+)
+
+// NewIdGenerator returns the generator of the kind. The Snowflake generator is the default. The counter generator is not
+// unique across restarts and replicas, and is meant for local development only.
+func NewIdGenerator(kind string, nodeId int64) (IdGenerator, error) {
+	switch kind {
+	case IdGenSnowflake, "":
+		return NewSnowflake(nodeId)
+	case IdGenCounter:
+		return &Counter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown id generator %q", kind)
+	}
+}
+
+// Snowflake generates 64-bit IDs made of the milliseconds since snowflakeEpoch in 41 bits, the node ID in 10 bits and a sequence
+// in 12 bits. The IDs are unique across restarts as the time moves on, and across replicas as long as each replica has its own
+// node ID. The IDs of a generator increase, even when the clock moves backwards.
+type Snowflake struct {
+	mu       sync.Mutex
+	nodeId   int64
+	lastTime int64
+	sequence int64
+	now      func() int64
+}
+
+func NewSnowflake(nodeId int64) (*Snowflake, error) {
+	if nodeId < 0 || nodeId > MaxNodeId {
+		return nil, fmt.Errorf("node id %v should be within 0 and %v", nodeId, MaxNodeId)
+	}
+	return &Snowflake{
+		nodeId: nodeId,
+		now: func() int64 {
+			return time.Now().UnixNano() / int64(time.Millisecond)
+		},
+	}, nil
+}
+
+func (s *Snowflake) NextId() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	// the clock moved backwards. the IDs continue from the last time to stay unique
+	if now < s.lastTime {
+		now = s.lastTime
+	}
+	if now == s.lastTime {
+		s.sequence = (s.sequence + 1) & snowflakeSeqMask
+		// the sequence is exhausted within the millisecond. the IDs borrow the next millisecond
+		if s.sequence == 0 {
+			now++
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.lastTime = now
+	return (now-snowflakeEpoch)<<(snowflakeNodeBits+snowflakeSeqBits) | s.nodeId<<snowflakeSeqBits | s.sequence
+}
+
+// Counter generates sequential IDs starting from 1 on every start.
+type Counter struct {
+	last int64
+}
+
+func (c *Counter) NextId() int64 {
+	return atomic.AddInt64(&c.last, 1)
+}
@@ -4,9 +4,11 @@ import (
 	"container/heap"
 )
 
+// QueueItem is an item in the priority queue. Order breaks the tie between items of equal Priority.
 type QueueItem struct {
 	Value    string
 	Priority int64
+	Order    int64
 	Index    int
 	Data     interface{}
 }
@@ -15,9 +17,16 @@ type PriorityQueue []*QueueItem
 
 func (pq PriorityQueue) Len() int { return len(pq) }
 
+// Less orders the items so that Pop gives us the highest priority first. Items of equal priority are popped in the ascending
+// order of Order and then in the lexicographic order of Value, so the order doesn't depend on the order the items were pushed.
 func (pq PriorityQueue) Less(i, j int) bool {
-	// Pop gives us the highest priority first
-	return pq[i].Priority > pq[j].Priority
+	if pq[i].Priority != pq[j].Priority {
+		return pq[i].Priority > pq[j].Priority
+	}
+	if pq[i].Order != pq[j].Order {
+		return pq[i].Order < pq[j].Order
+	}
+	return pq[i].Value < pq[j].Value
 }
 
 func (pq PriorityQueue) Swap(i, j int) {
@@ -0,0 +1,9 @@
+package util
+
+// The version, commit and build time of the binary. They are set at build time with
+// -ldflags "-X github.com/SDJLee/mercedes-benz/util.Version=<version> ...", as the Makefile does.
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
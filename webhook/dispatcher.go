@@ -0,0 +1,496 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/SDJLee/mercedes-benz/logger"
+	"github.com/SDJLee/mercedes-benz/metrics"
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+)
+
+// maxBackoff bounds the delay between two attempts.
+const maxBackoff = 5 * time.Minute
+
+var logger = log.SubLogger("webhook")
+
+var (
+	errStopped        = errors.New("stopped before the event was delivered")
+	errQueueFull      = errors.New("delivery queue is full")
+	errNoSubscription = errors.New("subscription no longer exists")
+)
+
+// Config configures the deliveries. An event is posted up to MaxAttempts times, Backoff after the first failed attempt and twice as
+// long after each next one. Each attempt is bounded by Timeout. The deliveries are queued, up to QueueSize, for Workers workers to post
+// them. The deliveries that fail every attempt, or don't fit in the queue, are appended to the dead-letter log at DeadLetterPath as JSON
+// lines. The pending deliveries are persisted in StateDir, when set, so that the deliveries waiting for an attempt when the service
+// stops are posted again on the next start. The last History deliveries are kept for their status.
+type Config struct {
+	MaxAttempts    int
+	Backoff        time.Duration
+	Timeout        time.Duration
+	Workers        int
+	QueueSize      int
+	DeadLetterPath string
+	StateDir       string
+	History        int
+}
+
+// Dispatcher delivers the events to their subscriptions in the background.
+type Dispatcher struct {
+	subscriptions []*Subscription
+	config        Config
+	client        *http.Client
+	queue         chan *task
+
+	mu         sync.Mutex
+	deliveries []*model.WebhookDelivery
+	retries    map[string]*retry
+
+	deadLetter sync.Mutex
+	workers    sync.WaitGroup
+	stopping   chan struct{}
+	stopOnce   sync.Once
+}
+
+// task is a delivery of an event to a subscription.
+type task struct {
+	subscription *Subscription
+	delivery     *model.WebhookDelivery
+	body         []byte
+}
+
+// retry is a task waiting for its next attempt.
+type retry struct {
+	task  *task
+	timer *time.Timer
+}
+
+// letter is a delivery along with its event, as written to the dead-letter log and persisted in the state directory.
+type letter struct {
+	Delivery *model.WebhookDelivery `json:"delivery"`
+	Event    json.RawMessage        `json:"event"`
+}
+
+// New returns the dispatcher of the subscriptions and starts its workers. The unset values of config are defaulted. The pending
+// deliveries persisted in the state directory are posted again, at the time of their next attempt.
+func New(subscriptions []*Subscription, config Config) *Dispatcher {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = util.DefaultHookTries
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = util.DefaultHookBackoff * time.Millisecond
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = util.DefaultHookTimeout * time.Millisecond
+	}
+	if config.Workers <= 0 {
+		config.Workers = util.DefaultHookWorkers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = util.DefaultHookQueue
+	}
+	if config.History <= 0 {
+		config.History = 1000
+	}
+	d := &Dispatcher{
+		subscriptions: subscriptions,
+		config:        config,
+		client:        &http.Client{},
+		queue:         make(chan *task, config.QueueSize),
+		retries:       make(map[string]*retry),
+		stopping:      make(chan struct{}),
+	}
+	d.workers.Add(config.Workers)
+	for i := 0; i < config.Workers; i++ {
+		go d.work()
+	}
+	d.resume()
+	return d
+}
+
+// resume schedules the pending deliveries persisted in the state directory. A delivery to a subscription that no longer exists fails.
+// Files that can't be read are skipped.
+func (d *Dispatcher) resume() {
+	if d.config.StateDir == "" {
+		return
+	}
+	if err := os.MkdirAll(d.config.StateDir, 0755); err != nil {
+		logger.Errorf("failed to create the webhook state directory. pending deliveries will not be persisted. %v", err)
+		return
+	}
+	files, err := ioutil.ReadDir(d.config.StateDir)
+	if err != nil {
+		logger.Errorf("failed to read the webhook state directory. %v", err)
+		return
+	}
+	bySubscription := make(map[string]*Subscription, len(d.subscriptions))
+	for _, subscription := range d.subscriptions {
+		bySubscription[subscription.ID] = subscription
+	}
+	resumed := 0
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(d.config.StateDir, file.Name()))
+		if err != nil {
+			logger.Errorf("failed to read pending delivery %v. %v", file.Name(), err)
+			continue
+		}
+		pending := &letter{}
+		if err := json.Unmarshal(content, pending); err != nil || pending.Delivery == nil {
+			logger.Errorf("failed to parse pending delivery %v. %v", file.Name(), err)
+			continue
+		}
+		t := &task{subscription: bySubscription[pending.Delivery.Subscription], delivery: pending.Delivery, body: pending.Event}
+		d.track(t.delivery)
+		if t.subscription == nil {
+			d.update(t.delivery, func(delivery *model.WebhookDelivery) {
+				delivery.Status = model.DeliveryFailed
+				delivery.NextAttemptAt = nil
+				delivery.LastError = errNoSubscription.Error()
+			})
+			d.fail(t)
+			continue
+		}
+		var at time.Time
+		if t.delivery.NextAttemptAt != nil {
+			at = *t.delivery.NextAttemptAt
+		}
+		d.schedule(t, at)
+		resumed++
+	}
+	if resumed > 0 {
+		logger.Infof("resumed %v pending webhook deliveries", resumed)
+	}
+}
+
+// Publish delivers the event to the subscriptions to its type that accept it. It returns right away and the event is delivered in the
+// background. A delivery that doesn't fit in the queue goes to the dead-letter log. The events published once the dispatcher is closed
+// are dropped.
+func (d *Dispatcher) Publish(event *model.WebhookEvent, accept func(subscription *Subscription) bool) {
+	select {
+	case <-d.stopping:
+		logger.Warnf("dropped %v event %v published after shutdown", event.Type, event.ID)
+		return
+	default:
+	}
+	var body []byte
+	for _, subscription := range d.subscriptions {
+		if !subscription.Subscribes(event.Type) || !accept(subscription) {
+			continue
+		}
+		if body == nil {
+			var err error
+			if body, err = json.Marshal(event); err != nil {
+				logger.Errorf("failed to serialize %v event %v. %v", event.Type, event.ID, err)
+				return
+			}
+		}
+		id, err := newId()
+		if err != nil {
+			logger.Errorf("failed to deliver %v event %v. %v", event.Type, event.ID, err)
+			return
+		}
+		now := time.Now().UTC()
+		t := &task{subscription: subscription, body: body, delivery: &model.WebhookDelivery{
+			ID:           id,
+			Subscription: subscription.ID,
+			EventID:      event.ID,
+			EventType:    event.Type,
+			Status:       model.DeliveryPending,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}}
+		d.track(t.delivery)
+		d.persist(t)
+		d.enqueue(t)
+	}
+}
+
+// enqueue queues the task for the workers. A task that doesn't fit in the queue fails to the dead-letter log. A task is not queued
+// once the dispatcher is closed, and is left persisted to be posted on the next start.
+func (d *Dispatcher) enqueue(t *task) {
+	select {
+	case <-d.stopping:
+		d.abandon(t)
+		return
+	default:
+	}
+	select {
+	case d.queue <- t:
+	default:
+		d.update(t.delivery, func(delivery *model.WebhookDelivery) {
+			delivery.Status = model.DeliveryFailed
+			delivery.NextAttemptAt = nil
+			delivery.LastError = errQueueFull.Error()
+		})
+		metrics.StatCount("counters.webhooks.overflow", 1)
+		d.fail(t)
+	}
+}
+
+// schedule queues the task at the time of its next attempt.
+func (d *Dispatcher) schedule(t *task, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.retries[t.delivery.ID] = &retry{task: t, timer: time.AfterFunc(time.Until(at), func() {
+		d.mu.Lock()
+		delete(d.retries, t.delivery.ID)
+		d.mu.Unlock()
+		d.enqueue(t)
+	})}
+}
+
+func (d *Dispatcher) work() {
+	defer d.workers.Done()
+	for {
+		// a stopped worker doesn't take another delivery even if one is queued
+		select {
+		case <-d.stopping:
+			return
+		default:
+		}
+		select {
+		case <-d.stopping:
+			return
+		case t := <-d.queue:
+			d.attempt(t)
+		}
+	}
+}
+
+// attempt posts the event once. A failed attempt is retried after the backoff until every attempt fails, in which case the delivery
+// goes to the dead-letter log.
+func (d *Dispatcher) attempt(t *task) {
+	attempt := d.get(t.delivery).Attempts + 1
+	statusCode, err := d.post(t.subscription, t.delivery.ID, t.delivery.EventType, t.body)
+	var next *time.Time
+	if err != nil && attempt < d.config.MaxAttempts {
+		at := time.Now().UTC().Add(d.backoff(attempt))
+		next = &at
+	}
+	d.update(t.delivery, func(delivery *model.WebhookDelivery) {
+		delivery.Attempts = attempt
+		delivery.LastStatusCode = statusCode
+		delivery.NextAttemptAt = next
+		delivery.LastError = ""
+		switch {
+		case err == nil:
+			delivery.Status = model.DeliveryDelivered
+		case next == nil:
+			delivery.Status = model.DeliveryFailed
+			delivery.LastError = err.Error()
+		default:
+			delivery.LastError = err.Error()
+		}
+	})
+	if err == nil {
+		metrics.StatCount("counters.webhooks.delivered", 1)
+		d.forget(t)
+		return
+	}
+	logger.Warnf("attempt %v of delivery %v to webhook %v failed. %v", attempt, t.delivery.ID, t.subscription.ID, err)
+	if next == nil {
+		d.fail(t)
+		return
+	}
+	metrics.StatCount("counters.webhooks.retried", 1)
+	d.persist(t)
+	d.schedule(t, *next)
+}
+
+// post posts the signed event to the subscription. It fails unless the subscriber responds with a 2xx status.
+func (d *Dispatcher) post(subscription *Subscription, deliveryId string, eventType string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.Timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, "POST", subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(util.WebhookEventHeader, eventType)
+	request.Header.Set(util.WebhookIdHeader, deliveryId)
+	request.Header.Set(util.SignatureHeader, Sign(subscription.Secret, time.Now(), body))
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	// the body is drained so that the connection is reused
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("webhook responded with status %v", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// backoff returns the delay after the failed attempt.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	backoff := d.config.Backoff
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+// fail appends the failed delivery and its event to the dead-letter log, so that it can be delivered again by hand.
+func (d *Dispatcher) fail(t *task) {
+	metrics.StatCount("counters.webhooks.failed", 1)
+	copied := d.get(t.delivery)
+	logger.Errorf("delivery %v of %v event %v to webhook %v failed after %v attempts. %v", copied.ID, copied.EventType, copied.EventID,
+		copied.Subscription, copied.Attempts, copied.LastError)
+	defer d.forget(t)
+	line, err := json.Marshal(&letter{Delivery: copied, Event: t.body})
+	if err != nil {
+		logger.Errorf("failed to serialize delivery %v for the dead-letter log. %v", copied.ID, err)
+		return
+	}
+	d.deadLetter.Lock()
+	defer d.deadLetter.Unlock()
+	file, err := os.OpenFile(d.config.DeadLetterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Errorf("failed to open the dead-letter log. %v", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		logger.Errorf("failed to write delivery %v to the dead-letter log. %v", copied.ID, err)
+	}
+}
+
+// abandon leaves the pending delivery to the next start when it is persisted, and fails it to the dead-letter log otherwise.
+func (d *Dispatcher) abandon(t *task) {
+	if d.config.StateDir != "" {
+		return
+	}
+	d.update(t.delivery, func(delivery *model.WebhookDelivery) {
+		delivery.Status = model.DeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.LastError = errStopped.Error()
+	})
+	d.fail(t)
+}
+
+// persist writes the pending delivery into its file in the state directory. The file is written in a temporary file and renamed, so a
+// crash doesn't leave a partial file. A delivery that can't be persisted is still posted.
+func (d *Dispatcher) persist(t *task) {
+	if d.config.StateDir == "" {
+		return
+	}
+	content, err := json.Marshal(&letter{Delivery: d.get(t.delivery), Event: t.body})
+	if err != nil {
+		logger.Errorf("failed to serialize pending delivery %v. %v", t.delivery.ID, err)
+		return
+	}
+	file := filepath.Join(d.config.StateDir, t.delivery.ID+".json")
+	if err := ioutil.WriteFile(file+".tmp", content, 0600); err == nil {
+		err = os.Rename(file+".tmp", file)
+	}
+	if err != nil {
+		logger.Errorf("failed to persist pending delivery %v. %v", t.delivery.ID, err)
+	}
+}
+
+// forget removes the delivery that is no longer pending from the state directory.
+func (d *Dispatcher) forget(t *task) {
+	if d.config.StateDir == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(d.config.StateDir, t.delivery.ID+".json")); err != nil && !os.IsNotExist(err) {
+		logger.Errorf("failed to remove pending delivery %v. %v", t.delivery.ID, err)
+	}
+}
+
+// track keeps the delivery for its status. The oldest deliveries are forgotten beyond the history size.
+func (d *Dispatcher) track(delivery *model.WebhookDelivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deliveries = append(d.deliveries, delivery)
+	if extra := len(d.deliveries) - d.config.History; extra > 0 {
+		d.deliveries = append(d.deliveries[:0:0], d.deliveries[extra:]...)
+	}
+}
+
+// update changes the delivery with fn.
+func (d *Dispatcher) update(delivery *model.WebhookDelivery, fn func(delivery *model.WebhookDelivery)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn(delivery)
+	delivery.UpdatedAt = time.Now().UTC()
+}
+
+// get returns a copy of the delivery.
+func (d *Dispatcher) get(delivery *model.WebhookDelivery) *model.WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	copied := *delivery
+	return &copied
+}
+
+// Deliveries returns a copy of the deliveries kept for their status, newest first.
+func (d *Dispatcher) Deliveries() []*model.WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	deliveries := make([]*model.WebhookDelivery, 0, len(d.deliveries))
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		copied := *d.deliveries[i]
+		deliveries = append(deliveries, &copied)
+	}
+	return deliveries
+}
+
+// Close stops the deliveries. The attempts in flight complete until ctx is done. The deliveries queued or waiting for their next attempt
+// are left in the state directory to be posted on the next start, or fail to the dead-letter log when there is none.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.stopOnce.Do(func() {
+		close(d.stopping)
+	})
+	d.mu.Lock()
+	waiting := make([]*task, 0, len(d.retries))
+	for id, r := range d.retries {
+		if r.timer.Stop() {
+			waiting = append(waiting, r.task)
+		}
+		delete(d.retries, id)
+	}
+	d.mu.Unlock()
+	for _, t := range waiting {
+		d.abandon(t)
+	}
+	done := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		// the workers are stopped, so the queued deliveries are not taken anymore
+		for {
+			select {
+			case t := <-d.queue:
+				d.abandon(t)
+			default:
+				close(done)
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
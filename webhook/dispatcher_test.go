@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+)
+
+// subscriber is a webhook subscriber that responds with its status, 200 by default. The requests wait while it is blocked.
+type subscriber struct {
+	*httptest.Server
+	mu      sync.Mutex
+	status  int
+	blocked chan struct{}
+	arrived chan struct{}
+}
+
+func newSubscriber() *subscriber {
+	s := &subscriber{status: http.StatusOK, arrived: make(chan struct{}, 100)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.arrived <- struct{}{}
+		s.mu.Lock()
+		blocked, status := s.blocked, s.status
+		s.mu.Unlock()
+		if blocked != nil {
+			<-blocked
+		}
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *subscriber) respond(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func testSubscription(url string) *Subscription {
+	return &Subscription{ID: "fleet", URL: url, Secret: "secret", Events: []string{util.EventUnreachable}}
+}
+
+func publish(t *testing.T, d *Dispatcher) {
+	event, err := NewEvent(util.EventUnreachable, &model.PlanEvent{Vin: "W1K2062161F0046"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Publish(event, func(subscription *Subscription) bool { return true })
+}
+
+// await waits until the deliveries of the dispatcher are done.
+func await(t *testing.T, d *Dispatcher, done func(deliveries []*model.WebhookDelivery) bool) []*model.WebhookDelivery {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries := d.Deliveries()
+		if done(deliveries) {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries not done in time: %+v", deliveries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func deadLetters(t *testing.T, path string) []*letter {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var letters []*letter
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		l := &letter{}
+		if err := json.Unmarshal(scanner.Bytes(), l); err != nil {
+			t.Fatal(err)
+		}
+		letters = append(letters, l)
+	}
+	return letters
+}
+
+func TestDispatcherQueueFull(t *testing.T) {
+	s := newSubscriber()
+	defer s.Close()
+	unblock := make(chan struct{})
+	s.blocked = unblock
+	dir, err := ioutil.TempDir("", "webhooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	deadLetter := filepath.Join(dir, "dead.jsonl")
+	d := New([]*Subscription{testSubscription(s.URL)}, Config{Workers: 1, QueueSize: 1, DeadLetterPath: deadLetter})
+	defer d.Close(context.Background())
+
+	// the worker is busy with the first delivery and the queue holds the second one, so the third one is dead-lettered
+	publish(t, d)
+	<-s.arrived
+	publish(t, d)
+	publish(t, d)
+	letters := deadLetters(t, deadLetter)
+	if len(letters) != 1 || letters[0].Delivery.LastError != errQueueFull.Error() {
+		t.Fatalf("expected the delivery over the queue size to be dead-lettered but got %+v", letters)
+	}
+
+	close(unblock)
+	deliveries := await(t, d, func(deliveries []*model.WebhookDelivery) bool {
+		for _, delivery := range deliveries {
+			if delivery.Status == model.DeliveryPending {
+				return false
+			}
+		}
+		return true
+	})
+	delivered := 0
+	for _, delivery := range deliveries {
+		if delivery.Status == model.DeliveryDelivered {
+			delivered++
+		}
+	}
+	if delivered != 2 {
+		t.Errorf("expected the queued deliveries to be delivered but got %+v", deliveries)
+	}
+}
+
+func TestDispatcherResume(t *testing.T) {
+	s := newSubscriber()
+	defer s.Close()
+	s.respond(http.StatusServiceUnavailable)
+	dir, err := ioutil.TempDir("", "webhooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := Config{MaxAttempts: 3, Backoff: 100 * time.Millisecond, DeadLetterPath: filepath.Join(dir, "dead.jsonl"),
+		StateDir: filepath.Join(dir, "pending")}
+	d := New([]*Subscription{testSubscription(s.URL)}, config)
+
+	// the delivery waiting for its retry is persisted on shutdown instead of being dead-lettered
+	publish(t, d)
+	await(t, d, func(deliveries []*model.WebhookDelivery) bool {
+		return len(deliveries) == 1 && deliveries[0].Attempts == 1 && deliveries[0].NextAttemptAt != nil
+	})
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(config.StateDir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("expected the pending delivery to be persisted but got %v", files)
+	}
+	if letters := deadLetters(t, config.DeadLetterPath); len(letters) != 0 {
+		t.Fatalf("expected the pending delivery not to be dead-lettered but got %+v", letters)
+	}
+
+	// the next start retries it
+	s.respond(http.StatusOK)
+	d = New([]*Subscription{testSubscription(s.URL)}, config)
+	defer d.Close(context.Background())
+	deliveries := await(t, d, func(deliveries []*model.WebhookDelivery) bool {
+		return len(deliveries) == 1 && deliveries[0].Status == model.DeliveryDelivered
+	})
+	if deliveries[0].Attempts != 2 {
+		t.Errorf("expected the delivery to succeed on its second attempt but got %+v", deliveries[0])
+	}
+	await(t, d, func(deliveries []*model.WebhookDelivery) bool {
+		files, _ := filepath.Glob(filepath.Join(config.StateDir, "*.json"))
+		return len(files) == 0
+	})
+
+	// a pending delivery to a removed subscription is dead-lettered
+	d.Close(context.Background())
+	d = New([]*Subscription{testSubscription("http://127.0.0.1:1")}, Config{MaxAttempts: 2, Backoff: time.Hour,
+		DeadLetterPath: config.DeadLetterPath, StateDir: config.StateDir})
+	publish(t, d)
+	await(t, d, func(deliveries []*model.WebhookDelivery) bool {
+		return len(deliveries) == 1 && deliveries[0].NextAttemptAt != nil
+	})
+	d.Close(context.Background())
+	d = New(nil, config)
+	defer d.Close(context.Background())
+	letters := deadLetters(t, config.DeadLetterPath)
+	if len(letters) != 1 || letters[0].Delivery.LastError != errNoSubscription.Error() {
+		t.Errorf("expected the delivery to the removed subscription to be dead-lettered but got %+v", letters)
+	}
+}
@@ -0,0 +1,158 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SDJLee/mercedes-benz/model"
+	"github.com/SDJLee/mercedes-benz/util"
+)
+
+// Events are the types of events that can be subscribed to.
+var Events = []string{util.EventUnreachable, util.EventTooManyStops}
+
+var errSignature = errors.New("invalid signature")
+
+// Subscription posts the events of the types in Events to URL, signed with Secret. The subscription of a Tenant only gets the events
+// of its plans. MaxStops is the number of stops above which a plan is posted as plan.too-many-stops.
+type Subscription struct {
+	ID       string   `json:"id"`
+	URL      string   `json:"url"`
+	Secret   string   `json:"secret"`
+	Events   []string `json:"events"`
+	Tenant   string   `json:"tenant,omitempty"`
+	MaxStops int      `json:"maxStops,omitempty"`
+}
+
+// Subscribes reports whether the subscription is to the type of events.
+func (s *Subscription) Subscribes(eventType string) bool {
+	for _, subscribed := range s.Events {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads the subscriptions from the JSON file at the path, which has an array of Subscription.
+func Load(path string) ([]*Subscription, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var subscriptions []*Subscription
+	if err := json.Unmarshal(content, &subscriptions); err != nil {
+		return nil, fmt.Errorf("invalid webhooks file: %v", err)
+	}
+	return subscriptions, Validate(subscriptions)
+}
+
+// Validate checks that each subscription has a unique ID, an absolute http(s) URL, a secret and known events, and a positive MaxStops
+// when it subscribes to plan.too-many-stops.
+func Validate(subscriptions []*Subscription) error {
+	ids := make(map[string]bool, len(subscriptions))
+	for i, subscription := range subscriptions {
+		if subscription.ID == "" {
+			return fmt.Errorf("webhook %v has no id", i)
+		}
+		if ids[subscription.ID] {
+			return fmt.Errorf("webhook %v is a duplicate", subscription.ID)
+		}
+		ids[subscription.ID] = true
+		target, err := url.Parse(subscription.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("webhook %v has an invalid url", subscription.ID)
+		}
+		if subscription.Secret == "" {
+			return fmt.Errorf("webhook %v has no secret", subscription.ID)
+		}
+		if len(subscription.Events) == 0 {
+			return fmt.Errorf("webhook %v has no events", subscription.ID)
+		}
+		for _, event := range subscription.Events {
+			if !knownEvent(event) {
+				return fmt.Errorf("webhook %v has unknown event %q", subscription.ID, event)
+			}
+		}
+		if subscription.Subscribes(util.EventTooManyStops) && subscription.MaxStops <= 0 {
+			return fmt.Errorf("webhook %v should have a positive maxStops for %v", subscription.ID, util.EventTooManyStops)
+		}
+	}
+	return nil
+}
+
+func knownEvent(event string) bool {
+	for _, known := range Events {
+		if known == event {
+			return true
+		}
+	}
+	return false
+}
+
+// NewEvent returns the event of the type about the plan, with a random ID.
+func NewEvent(eventType string, plan *model.PlanEvent) (*model.WebhookEvent, error) {
+	id, err := newId()
+	if err != nil {
+		return nil, err
+	}
+	return &model.WebhookEvent{ID: id, Type: eventType, CreatedAt: time.Now().UTC(), Data: plan}, nil
+}
+
+// Sign returns the signature of the body posted at the time, in the "t=<unix time>,v1=<hex HMAC-SHA256>" format of the
+// X-Webhook-Signature header. The HMAC is computed with the secret over the unix time, a dot and the body, so that a delivery can't be
+// replayed later with another time.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + hex.EncodeToString(mac(secret, unix, body))
+}
+
+// Verify checks the signature of the body, in the format of Sign, with the secret. The signature should be made within tolerance of now.
+func Verify(secret string, signature string, body []byte, tolerance time.Duration) error {
+	var unix, signed string
+	for _, part := range strings.Split(signature, ",") {
+		switch {
+		case strings.HasPrefix(part, "t="):
+			unix = strings.TrimPrefix(part, "t=")
+		case strings.HasPrefix(part, "v1="):
+			signed = strings.TrimPrefix(part, "v1=")
+		}
+	}
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return errSignature
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("signature is %v old", age)
+	}
+	decoded, err := hex.DecodeString(signed)
+	if err != nil || !hmac.Equal(decoded, mac(secret, unix, body)) {
+		return errSignature
+	}
+	return nil
+}
+
+func mac(secret string, unix string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(unix + "."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+func newId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}